@@ -5,17 +5,37 @@
 package gonetio
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net"
+	"os"
 	"runtime/debug"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultTLSHandshakeTimeout = 10 * time.Second // default tls handshake timeout
+)
+
+// error type
+var (
+	ErrUnixSocketInUse = errors.New("Unix socket is in use by another process")
+	ErrUnixSocketPath  = errors.New("Unix socket path exists and is not a socket")
 )
 
 type AcceptorConf struct {
-	listenPort            int // listen port
-	connSendChanSizeLimit int // each connection packet send queue size
-	keepAliveMinTime      int // in seconds, the min time duration between two package, valid only when the value is positive
+	listenPort            int              // listen port
+	unixPath              string           // listen to the unix socket path instead of the port when not empty
+	connSendChanSizeLimit int              // each connection packet send queue size
+	keepAliveMinTime      int              // in seconds, the min time duration between two package, valid only when the value is positive
+	tlsConfig             *tls.Config      // serve tls when not nil
+	tlsHandshakeTimeout   time.Duration    // tls handshake timeout, no timeout when not positive
+	writeBatch            writeBatchConfig // the write coalescing config of the connections
+	sendQueue             sendQueueConfig  // the overflow policy and the watermarks of the connections
 }
 
 // new config
@@ -24,16 +44,44 @@ func NewConfig(port int, sendQueueSize int, keepAliveMinTimeDuration int) *Accep
 		listenPort:            port,
 		connSendChanSizeLimit: sendQueueSize,
 		keepAliveMinTime:      keepAliveMinTimeDuration,
+		tlsConfig:             nil,
+		tlsHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		writeBatch:            defaultWriteBatchConfig(),
+		sendQueue:             defaultSendQueueConfig(),
 	}
 }
 
+// new unix socket config
+// listen to the unix domain socket path instead of a tcp port
+func NewUnixConfig(path string, sendQueueSize int, keepAliveMinTimeDuration int) *AcceptorConf {
+	conf := NewConfig(0, sendQueueSize, keepAliveMinTimeDuration)
+	conf.unixPath = path
+	return conf
+}
+
+// set the tls config, the acceptor serves tls when it's not nil
+// the config must contain at least one certificate or set GetCertificate
+func (this *AcceptorConf) SetTLSConfig(config *tls.Config) {
+	this.tlsConfig = config
+}
+
+// set the tls handshake timeout
+func (this *AcceptorConf) SetTLSHandshakeTimeout(timeout time.Duration) {
+	this.tlsHandshakeTimeout = timeout
+}
+
 type TcpAcceptor struct {
 	nextConID   uint32
-	config      *AcceptorConf    // the acceptor config
-	filterChain *IoFilterChain   // filter chain
-	listener    *net.TCPListener // listener
-	exitChan    chan struct{}    // notify all goroutines to shutdown
-	waitGroup   *sync.WaitGroup  // wait for all goroutines to stop
+	config      *AcceptorConf      // the acceptor config
+	filterChain *IoFilterChain     // filter chain
+	listener    net.Listener       // listener
+	exitChan    chan struct{}      // notify all goroutines to shutdown
+	waitGroup   *sync.WaitGroup    // wait for all goroutines to stop
+	conns       *TcpconnectionPool // the live connections
+	stopFlag    int32              // stop accepting flag
+	stopOnce    sync.Once          // make sure the acceptor stop just once
+	metrics     *metrics           // the counters of all the connections
+	logger      FieldLogger        // the logger
 }
 
 // create new acceptor instance
@@ -45,17 +93,36 @@ func NewAcceptor(conf *AcceptorConf) *TcpAcceptor {
 		listener:    nil,
 		exitChan:    make(chan struct{}),
 		waitGroup:   &sync.WaitGroup{},
+		conns:       NewTcpconnectionPool(),
+		stopFlag:    0,
+		metrics:     newMetrics(),
+		logger:      DefaultLogger(),
 	}
 }
 
+// set the logger, it must be called before Start
+// the connections log to its child with the conID and the remote addr attached
+func (this *TcpAcceptor) SetLogger(logger FieldLogger) {
+	this.logger = logger
+}
+
+// get the logger
+func (this *TcpAcceptor) GetLogger() FieldLogger {
+	return this.logger
+}
+
+// get the stats snapshot of the acceptor
+func (this *TcpAcceptor) Stats() Stats {
+	return this.metrics.stats(this.conns.snapshot())
+}
+
 // get io filter chain
 func (this *TcpAcceptor) GetFilterChain() *IoFilterChain {
 	return this.filterChain
 }
 
 func (this *TcpAcceptor) generateNextConID() uint32 {
-	this.nextConID = atomic.AddUint32(&this.nextConID, 1)
-	return this.nextConID
+	return atomic.AddUint32(&this.nextConID, 1)
 }
 
 // the acceptor main loop
@@ -67,62 +134,160 @@ func (this *TcpAcceptor) acceptLoop() {
 		}
 		this.waitGroup.Done()
 
-		LogInfo("acceptor loop exit")
+		this.logger.Log(LvlInfo, "acceptor loop exit")
 
 		if p := recover(); p != nil {
-			LogError("panic recover, p: %v", p)
-			LogError("stack: %s", debug.Stack())
+			this.logger.Log(LvlError, "panic recover", "panic", p, "stack", string(debug.Stack()))
 		}
 	}()
 
-	LogInfo("acceptor loop start")
+	this.logger.Log(LvlInfo, "acceptor loop start")
 
 	for {
 		select {
 		case <-this.exitChan:
-			LogInfo("accept loop receive exit signal, exit")
+			this.logger.Log(LvlInfo, "accept loop receive exit signal, exit")
 			return
 		default:
 		}
 
-		conn, err := this.listener.AcceptTCP()
+		conn, err := this.listener.Accept()
 		if err != nil {
-			LogError("accept loop, error:%s.", err.Error())
+			if this.isStopping() {
+				this.logger.Log(LvlInfo, "accept loop listener closed, exit")
+				return
+			}
+			this.logger.Log(LvlError, "accept failed", "err", err)
+			this.metrics.addAcceptError()
 			continue
 		}
 
-		addr := conn.RemoteAddr().String()
-		LogInfo("accept a new connection[%s].", addr)
+		this.metrics.addAccept()
+
+		this.logger.Log(LvlInfo, "accept a new connection", "remote", conn.RemoteAddr().String())
+
+		if this.config.tlsConfig == nil {
+			this.startConn(conn)
+		} else {
+			// handshake out of the accept loop, a slow client won't block the others
+			tlsConn := tls.Server(conn, this.config.tlsConfig)
+			asyncDo(func() {
+				this.startConn(tlsConn)
+			}, this.waitGroup)
+		}
+	}
+
+}
+
+// start the accepted connection
+func (this *TcpAcceptor) startConn(conn net.Conn) {
+	tcpCon := newConn(conn, this)
+
+	if err := tcpCon.handshake(this.config.tlsHandshakeTimeout); err != nil {
+		this.logger.Log(LvlError, "tls handshake failed", "remote", conn.RemoteAddr().String(), "err", err)
+		this.metrics.addAcceptError()
+		conn.Close()
+		return
+	}
 
-		tcpCon := newConn(conn, this)
-		tcpCon.SetConID(this.generateNextConID())
-		tcpCon.SetIoFilterChain(this.filterChain.NewInstanceAndClone(tcpCon))
-		tcpCon.Start()
+	if this.isStopping() {
+		conn.Close()
+		return
 	}
 
+	tcpCon.SetConID(this.generateNextConID())
+	tcpCon.SetIoFilterChain(this.filterChain.NewInstanceAndClone(tcpCon))
+	tcpCon.setCloseCallback(this.conns.RemoveCon)
+	this.conns.AddCon(tcpCon)
+	tcpCon.Start()
+}
+
+// set the listener to accept from instead of listening to the config port
+// it must be called before Start, any net.Listener works, like the unix
+// listener or the wrapped listeners such as limit or proxy protocol listeners
+func (this *TcpAcceptor) SetListener(l net.Listener) {
+	this.listener = l
+}
+
+// get the address the acceptor listen to, nil before started
+func (this *TcpAcceptor) Addr() net.Addr {
+	if this.listener == nil {
+		return nil
+	}
+	return this.listener.Addr()
 }
 
 // the acceptor start
 func (this *TcpAcceptor) Start() bool {
 
+	if this.listener != nil {
+		this.logger.Log(LvlInfo, "acceptor listen", "addr", this.listener.Addr().String())
+
+		this.waitGroup.Add(1)
+		go this.acceptLoop()
+
+		return true
+	}
+
+	if this.config.unixPath != "" {
+		return this.startUnix()
+	}
+
 	var err error = nil
 	var addr *net.TCPAddr = nil
 
 	addr, err = net.ResolveTCPAddr("tcp", ":"+strconv.Itoa(this.config.listenPort))
 
 	if err != nil {
-		LogError("resolve tcp addr failed, port:%d error:%s.", this.config.listenPort, err.Error())
+		this.logger.Log(LvlError, "resolve tcp addr failed", "port", this.config.listenPort, "err", err)
 		return false
 	}
 
 	this.listener, err = net.ListenTCP("tcp", addr)
 
 	if err != nil {
-		LogError("bind to port[%d] failed, error:%s.", this.config.listenPort, err.Error())
+		this.logger.Log(LvlError, "bind to port failed", "port", this.config.listenPort, "err", err)
+		return false
+	}
+
+	this.logger.Log(LvlInfo, "acceptor listen", "port", this.config.listenPort)
+
+	this.waitGroup.Add(1)
+	go this.acceptLoop()
+
+	return true
+}
+
+// is the acceptor stopping
+func (this *TcpAcceptor) isStopping() bool {
+	return atomic.LoadInt32(&this.stopFlag) == 1
+}
+
+// stop accepting new connections, close the listener
+func (this *TcpAcceptor) stopAccept() {
+	atomic.StoreInt32(&this.stopFlag, 1)
+	if this.listener != nil {
+		this.listener.Close()
+	}
+}
+
+// start listening to the unix socket
+func (this *TcpAcceptor) startUnix() bool {
+	path := this.config.unixPath
+
+	if err := removeStaleUnixSocket(path, this.logger); err != nil {
+		this.logger.Log(LvlError, "clean unix socket failed", "path", path, "err", err)
+		return false
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		this.logger.Log(LvlError, "listen to unix socket failed", "path", path, "err", err)
 		return false
 	}
 
-	LogInfo("acceptor listen to port[%d].", this.config.listenPort)
+	this.listener = listener
+	this.logger.Log(LvlInfo, "acceptor listen", "unix", path)
 
 	this.waitGroup.Add(1)
 	go this.acceptLoop()
@@ -130,9 +295,102 @@ func (this *TcpAcceptor) Start() bool {
 	return true
 }
 
+// remove the socket file left by a process which did not exit cleanly
+// the file is kept if it's not a socket, or some process still listens to it
+func removeStaleUnixSocket(path string, logger FieldLogger) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return ErrUnixSocketPath
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return ErrUnixSocketInUse
+	}
+
+	logger.Log(LvlInfo, "remove stale unix socket", "path", path)
+	return os.Remove(path)
+}
+
 // stop
+// the connections exit abruptly, use Shutdown to stop gracefully
 func (this *TcpAcceptor) Stop() {
-	close(this.exitChan)
+	this.stopOnce.Do(func() {
+		this.stopAccept()
+		close(this.exitChan)
+	})
+}
+
+// shutdown gracefully
+// stop accepting immediately, fire the closing event on every connection
+// and close it after its send queue flushed. the remained connections are
+// force closed when the context is done, and the context error is returned
+func (this *TcpAcceptor) Shutdown(ctx context.Context) error {
+	this.stopAccept()
+	this.logger.Log(LvlInfo, "acceptor shutdown", "drainConns", this.conns.Size())
+
+	var err error = nil
+	for err == nil {
+		// a connection in tls handshake may be added after the snapshot, so check again,
+		// the closed ones may stay in the pool a moment before removed, skip them
+		cons := make([]*Tcpcon, 0, int(this.conns.Size()))
+		for _, con := range this.conns.snapshot() {
+			if !con.isDone() {
+				cons = append(cons, con)
+			}
+		}
+		if len(cons) == 0 {
+			break
+		}
+
+		for _, con := range cons {
+			con.drain()
+		}
+
+		for _, con := range cons {
+			select {
+			case <-con.Done():
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		cons := this.conns.snapshot()
+		this.logger.Log(LvlWarn, "acceptor shutdown, force close the connections", "err", err, "conns", len(cons))
+		for _, con := range cons {
+			con.Close()
+		}
+	}
+
+	this.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		this.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
 }
 
 // wait for stop
@@ -0,0 +1,306 @@
+// File Acceptor test
+
+package gonetio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// say goodbye when the connection closing, the goodbye is size bytes
+type goodbyeHandler struct {
+	IoHandlerImp
+	size    int
+	closing int32
+}
+
+func newGoodbyeHandler(size int) *goodbyeHandler {
+	handler := &goodbyeHandler{size: size}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *goodbyeHandler) ConnClosing(filter *IoFilter) {
+	atomic.AddInt32(&this.closing, 1)
+	filter.GetCon().Write(bytes.NewBuffer(bytes.Repeat([]byte("b"), this.size)))
+}
+
+// the handlers are shared by all the connections of the test
+func (this *goodbyeHandler) Clone() IoHandler {
+	return this
+}
+
+// start the acceptor at a random loopback port
+func startTestAcceptor(t *testing.T, handler IoHandler) *TcpAcceptor {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acceptor := NewAcceptor(NewConfig(0, 16, 0))
+	acceptor.SetListener(listener)
+	acceptor.GetFilterChain().AddLast("handler", handler)
+	if !acceptor.Start() {
+		t.Fatal("acceptor start failed")
+	}
+
+	t.Cleanup(acceptor.Stop)
+	return acceptor
+}
+
+// dial the clients, wait for the acceptor to add them all
+func dialClients(t *testing.T, acceptor *TcpAcceptor, count int) []net.Conn {
+	clients := make([]net.Conn, 0, count)
+	for i := 0; i < count; i++ {
+		client, err := net.Dial("tcp", acceptor.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		clients = append(clients, client)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for int(acceptor.conns.Size()) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections accepted, expect %d", acceptor.conns.Size(), count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return clients
+}
+
+// the connections say goodbye, and close after it's flushed
+func TestAcceptorShutdownDrain(t *testing.T) {
+	handler := newGoodbyeHandler(3)
+	acceptor := startTestAcceptor(t, handler)
+	clients := dialClients(t, acceptor, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := acceptor.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown err %v", err)
+	}
+
+	if closing := atomic.LoadInt32(&handler.closing); closing != 3 {
+		t.Fatalf("ConnClosing fired %d times, expect 3", closing)
+	}
+	for i, client := range clients {
+		client.SetReadDeadline(time.Now().Add(3 * time.Second))
+		data, err := io.ReadAll(client)
+		if err != nil || string(data) != "bbb" {
+			t.Fatalf("client %d read %q, err %v, expect the goodbye then EOF", i, data, err)
+		}
+	}
+	if size := acceptor.conns.Size(); size != 0 {
+		t.Fatalf("%d connections left after the shutdown", size)
+	}
+}
+
+// the clients never read the large goodbye, the connections are force closed at the deadline
+func TestAcceptorShutdownTimeout(t *testing.T) {
+	handler := newGoodbyeHandler(64 * 1024 * 1024)
+	acceptor := startTestAcceptor(t, handler)
+	clients := dialClients(t, acceptor, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := acceptor.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown err %v, expect context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("shutdown returned after %v", elapsed)
+	}
+
+	// the force closed connections are removed, the clients see the close
+	deadline := time.Now().Add(3 * time.Second)
+	for acceptor.conns.Size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections left after the forced close", acceptor.conns.Size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i, client := range clients {
+		client.SetReadDeadline(time.Now().Add(3 * time.Second))
+		// EOF or reset, but not the read timeout
+		_, err := io.Copy(io.Discard, client)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatalf("client %d read err %v, expect the connection closed", i, err)
+		}
+	}
+}
+
+// the closed connection still in the pool doesn't hold the shutdown
+func TestAcceptorShutdownSkipClosed(t *testing.T) {
+	acceptor := NewAcceptor(NewConfig(0, 16, 0))
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	con := NewConnFull(local, 16, &sync.WaitGroup{}, 0)
+	con.SetConID(1)
+	con.SetIoFilterChain(NewIoFilterChain(con))
+	con.Start()
+	con.Close()
+
+	// no close callback, it stays in the pool
+	acceptor.conns.AddCon(con)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := acceptor.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown err %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown returned after %v", elapsed)
+	}
+}
+
+// record the connections opened, echo the messages
+type openRecorder struct {
+	IoHandlerImp
+	opened   chan *Tcpcon
+	received chan string
+	echo     bool
+}
+
+func newOpenRecorder(echo bool) *openRecorder {
+	handler := &openRecorder{
+		opened:   make(chan *Tcpcon, 4),
+		received: make(chan string, 16),
+		echo:     echo,
+	}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *openRecorder) ConnOpened(filter *IoFilter) {
+	this.opened <- filter.GetCon()
+}
+
+func (this *openRecorder) MessageReceived(filter *IoFilter, obj BaseObject) {
+	input := obj.(*bytes.Buffer)
+	if this.echo {
+		filter.GetCon().Write(bytes.NewBuffer(append([]byte{}, input.Bytes()...)))
+	} else {
+		this.received <- input.String()
+	}
+	input.Reset()
+}
+
+// the handlers are shared by all the connections of the test
+func (this *openRecorder) Clone() IoHandler {
+	return this
+}
+
+// start the acceptor listening to the unix socket path
+func startUnixAcceptor(t *testing.T, path string, handler IoHandler) *TcpAcceptor {
+	acceptor := NewAcceptor(NewUnixConfig(path, 16, 0))
+	acceptor.GetFilterChain().AddLast("handler", handler)
+	if !acceptor.Start() {
+		t.Fatal("unix acceptor start failed")
+	}
+
+	t.Cleanup(acceptor.Stop)
+	return acceptor
+}
+
+func TestUnixAcceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo.sock")
+	server := newOpenRecorder(true)
+	acceptor := startUnixAcceptor(t, path, server)
+	if acceptor.Addr() == nil || acceptor.Addr().Network() != "unix" || acceptor.Addr().String() != path {
+		t.Fatalf("acceptor addr %v", acceptor.Addr())
+	}
+
+	client := newOpenRecorder(false)
+	connector := NewUnixConnector("unix", 16, 0)
+	connector.GetIoFilterChain().AddLast("handler", client)
+	connector.AsyncConnect(path)
+	defer connector.Stop()
+
+	waitFor(t, server.opened, "the server opened")
+	waitFor(t, client.opened, "the client opened").Write(bytes.NewBufferString("hello"))
+
+	got := ""
+	for got != "hello" {
+		got += waitFor(t, client.received, "the echo")
+		if len(got) > len("hello") {
+			t.Fatalf("client received %q", got)
+		}
+	}
+}
+
+func TestRemoveStaleUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// the socket file left by a listener closed without unlinking
+	stale := filepath.Join(dir, "stale.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+
+	// the socket some process still listens to
+	inUse := filepath.Join(dir, "inuse.sock")
+	live, err := net.Listen("unix", inUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		err     error
+		removed bool // the file is gone after the check
+	}{
+		{"not exist", filepath.Join(dir, "none.sock"), nil, true},
+		{"stale", stale, nil, true},
+		{"in use", inUse, ErrUnixSocketInUse, false},
+		{"regular file", regular, ErrUnixSocketPath, false},
+	}
+
+	for _, test := range tests {
+		err := removeStaleUnixSocket(test.path, DefaultLogger())
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: err %v, expect %v", test.name, err, test.err)
+		}
+
+		_, statErr := os.Lstat(test.path)
+		if removed := os.IsNotExist(statErr); removed != test.removed {
+			t.Fatalf("%s: removed %v, expect %v", test.name, removed, test.removed)
+		}
+	}
+
+	// the acceptor doesn't take the path over
+	for _, path := range []string{inUse, regular} {
+		acceptor := NewAcceptor(NewUnixConfig(path, 16, 0))
+		if acceptor.Start() {
+			acceptor.Stop()
+			t.Fatalf("the acceptor started on %s", path)
+		}
+	}
+
+	// it listens to the stale path again
+	startUnixAcceptor(t, stale, newOpenRecorder(true))
+}
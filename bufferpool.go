@@ -0,0 +1,69 @@
+// File BufferPool
+
+package gonetio
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	minBufferClassSize = 256     // the size of the smallest class
+	bufferClassCount   = 8       // the classes are 256, 1k, 4k, 16k, 64k, 256k, 1m and 4m
+	bufferClassShift   = 2       // each class is 4 times of the previous one
+	recvBufferSize     = 1 << 16 // the recv buffer size of the connection
+)
+
+// the pools of the size classes
+var bufferPools [bufferClassCount]sync.Pool
+
+// get the size of the class
+func bufferClassSize(class int) int {
+	return minBufferClassSize << (uint(class) * bufferClassShift)
+}
+
+// get the smallest class holds the size, -1 if it's larger than all the classes
+func bufferClassOf(size int) int {
+	for class := 0; class < bufferClassCount; class++ {
+		if size <= bufferClassSize(class) {
+			return class
+		}
+	}
+	return -1
+}
+
+// get an empty buffer with the capacity at least the size from the pool
+// the buffer larger than the largest class is allocated directly
+func GetBuffer(size int) *bytes.Buffer {
+	class := bufferClassOf(size)
+	if class < 0 {
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+
+	if buffer, ok := bufferPools[class].Get().(*bytes.Buffer); ok {
+		return buffer
+	}
+	return bytes.NewBuffer(make([]byte, 0, bufferClassSize(class)))
+}
+
+// put the buffer back to the pool, it must not be used any more
+// the buffer goes to the largest class its capacity holds,
+// the one smaller than the smallest class or larger than the largest class is dropped
+func PutBuffer(buffer *bytes.Buffer) {
+	if buffer == nil {
+		return
+	}
+
+	capacity := buffer.Cap()
+	if capacity < minBufferClassSize || capacity > bufferClassSize(bufferClassCount-1) {
+		return
+	}
+
+	class := bufferClassCount - 1
+	for bufferClassSize(class) > capacity {
+		class--
+	}
+
+	buffer.Reset()
+	bufferPools[class].Put(buffer)
+}
@@ -0,0 +1,143 @@
+// File DelimiterFrameDecoder
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"gonetio"
+)
+
+// the nul delimiter
+func NulDelimiter() []byte {
+	return []byte{0}
+}
+
+// the line delimiters, "\r\n" and "\n"
+func LineDelimiters() [][]byte {
+	return [][]byte{[]byte("\r\n"), []byte("\n")}
+}
+
+// the frame decoder splits the frames by the delimiters
+// when more than one delimiter found, the one makes the shortest frame is used
+// a frame longer than maxFrameLength is discarded until the next delimiter
+// and the error is fired through the chain
+type DelimiterFrameDecoder struct {
+	ProtocolDecoder
+	delimiters     [][]byte // the delimiters
+	maxFrameLength int      // the max frame length, the delimiter excluded
+	stripDelimiter bool     // flag weather strip the delimiter from the frame
+	maxDelimiter   int      // the max delimiter length
+	scanned        int      // the bytes already scanned with no delimiter found
+	discarding     bool     // discarding a too long frame
+}
+
+// new delimiter frame decoder
+func NewDelimiterFrameDecoder(maxFrameLength int, stripDelimiter bool, delimiters ...[]byte) *DelimiterFrameDecoder {
+	if len(delimiters) == 0 {
+		panic("delimiter frame decoder needs at least one delimiter")
+	}
+
+	maxDelimiter := 0
+	copied := make([][]byte, 0, len(delimiters))
+	for _, delimiter := range delimiters {
+		if len(delimiter) == 0 {
+			panic("delimiter frame decoder with an empty delimiter")
+		}
+		if len(delimiter) > maxDelimiter {
+			maxDelimiter = len(delimiter)
+		}
+		copied = append(copied, append([]byte{}, delimiter...))
+	}
+
+	handler := &DelimiterFrameDecoder{
+		delimiters:     copied,
+		maxFrameLength: maxFrameLength,
+		stripDelimiter: stripDelimiter,
+		maxDelimiter:   maxDelimiter,
+		scanned:        0,
+		discarding:     false,
+	}
+	handler.SetBoundType(gonetio.InBound)
+	handler.SetDecoder(handler)
+	return handler
+}
+
+// new line frame decoder, the lines end with "\n" or "\r\n"
+func NewLineFrameDecoder(maxFrameLength int, stripDelimiter bool) *DelimiterFrameDecoder {
+	return NewDelimiterFrameDecoder(maxFrameLength, stripDelimiter, LineDelimiters()...)
+}
+
+// find the delimiter makes the shortest frame, from the offset
+func (this *DelimiterFrameDecoder) indexOf(data []byte, offset int) (int, []byte) {
+	index := -1
+	var found []byte = nil
+	for _, delimiter := range this.delimiters {
+		i := bytes.Index(data[offset:], delimiter)
+		if i >= 0 && (index < 0 || offset+i < index) {
+			index = offset + i
+			found = delimiter
+		}
+	}
+	return index, found
+}
+
+func (this *DelimiterFrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	inputBuffer := obj.(*bytes.Buffer)
+
+	for {
+		data := inputBuffer.Bytes()
+
+		// a delimiter may be split across reads, rescan its possible head
+		offset := this.scanned - this.maxDelimiter + 1
+		if offset < 0 {
+			offset = 0
+		}
+
+		index, delimiter := this.indexOf(data, offset)
+		if index < 0 {
+			this.scanned = len(data)
+			if this.scanned > this.maxFrameLength+this.maxDelimiter-1 {
+				// keep the bytes which may be the head of a delimiter
+				keep := this.maxDelimiter - 1
+				inputBuffer.Next(len(data) - keep)
+				this.scanned = keep
+
+				if !this.discarding {
+					this.discarding = true
+					filter.ExceptionCaught(fmt.Errorf("%w: frame length exceeds %d, discard it", ErrFrameTooLarge, this.maxFrameLength))
+				}
+			}
+			return nil
+		}
+
+		this.scanned = 0
+		frameEnd := index + len(delimiter)
+
+		if this.discarding {
+			this.discarding = false
+			inputBuffer.Next(frameEnd)
+			continue
+		}
+
+		if index > this.maxFrameLength {
+			inputBuffer.Next(frameEnd)
+			filter.ExceptionCaught(fmt.Errorf("%w: frame length %d, max frame size %d", ErrFrameTooLarge, index, this.maxFrameLength))
+			continue
+		}
+
+		frame := inputBuffer.Next(frameEnd)
+		if this.stripDelimiter {
+			frame = frame[:index]
+		}
+
+		frameBuffer := this.NewFrameBuffer(filter, len(frame))
+		frameBuffer.Write(frame)
+		return frameBuffer
+	}
+}
+
+// Clone
+func (this *DelimiterFrameDecoder) Clone() gonetio.IoHandler {
+	return NewDelimiterFrameDecoder(this.maxFrameLength, this.stripDelimiter, this.delimiters...)
+}
@@ -0,0 +1,45 @@
+// File DelimiterFrameDecoder test
+
+package codec
+
+import (
+	"testing"
+)
+
+func TestDelimiterFrameDecoder(t *testing.T) {
+	bars := []byte("||")
+
+	tests := []struct {
+		name    string
+		decoder *DelimiterFrameDecoder
+		chunks  [][]byte
+		frames  []string
+		err     error
+	}{
+		{"lines", NewLineFrameDecoder(16, true),
+			[][]byte{[]byte("a\nb\r\n\n")}, []string{"a", "b", ""}, nil},
+		{"keep delimiter", NewLineFrameDecoder(16, false),
+			[][]byte{[]byte("a\nb\r\n")}, []string{"a\n", "b\r\n"}, nil},
+		{"split crlf", NewLineFrameDecoder(16, true),
+			[][]byte{[]byte("a\r"), []byte("\nb\n")}, []string{"a", "b"}, nil},
+		{"split delimiter", NewDelimiterFrameDecoder(16, true, bars),
+			[][]byte{[]byte("ab|"), []byte("|cd||")}, []string{"ab", "cd"}, nil},
+		{"byte by byte", NewDelimiterFrameDecoder(16, true, bars),
+			splitEvery([]byte("ab||c|d||"), 1), []string{"ab", "c|d"}, nil},
+		{"no delimiter", NewLineFrameDecoder(16, true),
+			[][]byte{[]byte("abc")}, nil, nil},
+		{"max length", NewLineFrameDecoder(3, true),
+			[][]byte{[]byte("abc\n")}, []string{"abc"}, nil},
+		{"too long", NewLineFrameDecoder(3, true),
+			[][]byte{[]byte("abcd\nok\n")}, []string{"ok"}, ErrFrameTooLarge},
+		{"too long discarding", NewLineFrameDecoder(3, true),
+			[][]byte{[]byte("abcdef"), []byte("ghij"), []byte("k\nok\n")}, []string{"ok"}, ErrFrameTooLarge},
+		{"too long split delimiter", NewDelimiterFrameDecoder(3, true, bars),
+			[][]byte{[]byte("abcdef|"), []byte("|ok||")}, []string{"ok"}, ErrFrameTooLarge},
+	}
+
+	for _, test := range tests {
+		collector := decodeChunks(test.decoder, test.chunks...)
+		checkDecoded(t, test.name, collector, test.frames, test.err)
+	}
+}
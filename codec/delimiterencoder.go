@@ -0,0 +1,58 @@
+// File DelimiterFrameEncoder
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"gonetio"
+)
+
+// the frame encoder appends the delimiter to the message
+// the message can be a *bytes.Buffer or a string
+type DelimiterFrameEncoder struct {
+	ProtocolEncoder
+	delimiter []byte // the delimiter
+}
+
+// new delimiter frame encoder
+func NewDelimiterFrameEncoder(delimiter []byte) *DelimiterFrameEncoder {
+	handler := &DelimiterFrameEncoder{
+		delimiter: append([]byte{}, delimiter...),
+	}
+	handler.SetBoundType(gonetio.OutBound)
+	handler.SetEncoder(handler)
+	return handler
+}
+
+// new line frame encoder, the lines end with "\r\n" if useCRLF, or "\n"
+func NewLineFrameEncoder(useCRLF bool) *DelimiterFrameEncoder {
+	if useCRLF {
+		return NewDelimiterFrameEncoder([]byte("\r\n"))
+	}
+	return NewDelimiterFrameEncoder([]byte("\n"))
+}
+
+func (this *DelimiterFrameEncoder) Encode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	var body []byte = nil
+	switch input := obj.(type) {
+	case *bytes.Buffer:
+		body = input.Bytes()
+	case string:
+		body = []byte(input)
+	default:
+		encodeFailed(filter, fmt.Errorf("%w: %T", ErrUnsupportedMessage, obj))
+		return nil
+	}
+
+	totalBuffer := this.NewFrameBuffer(filter, len(body)+len(this.delimiter))
+	totalBuffer.Write(body)
+	totalBuffer.Write(this.delimiter)
+
+	return totalBuffer
+}
+
+// Clone
+func (this *DelimiterFrameEncoder) Clone() gonetio.IoHandler {
+	return NewDelimiterFrameEncoder(this.delimiter)
+}
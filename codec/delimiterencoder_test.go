@@ -0,0 +1,36 @@
+// File DelimiterFrameEncoder test
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDelimiterFrameEncoder(t *testing.T) {
+	tests := []struct {
+		encoder *DelimiterFrameEncoder
+		encoded string
+	}{
+		{NewLineFrameEncoder(false), "a\n\nbc\n"},
+		{NewLineFrameEncoder(true), "a\r\n\r\nbc\r\n"},
+		{NewDelimiterFrameEncoder([]byte("||")), "a||||bc||"},
+	}
+
+	for _, test := range tests {
+		data := encodeFrames(t, test.encoder, "a", "", "bc")
+		if string(data) != test.encoded {
+			t.Fatalf("encoded %q, expect %q", data, test.encoded)
+		}
+
+		collector := decodeChunks(NewDelimiterFrameDecoder(16, true, test.encoder.delimiter), splitEvery(data, 1)...)
+		checkDecoded(t, fmt.Sprintf("delimiter %q", test.encoder.delimiter), collector, []string{"a", "", "bc"}, nil)
+	}
+}
+
+func TestDelimiterFrameEncoderUnsupported(t *testing.T) {
+	if err := sendFailed(t, NewLineFrameEncoder(false), 42); !errors.Is(err, ErrUnsupportedMessage) {
+		t.Fatalf("send int err %v, expect ErrUnsupportedMessage", err)
+	}
+}
@@ -7,9 +7,19 @@ package codec
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"gonetio"
 )
 
+// error type
+var (
+	ErrFrameLengthNegative = errors.New("Frame length is negative")
+	ErrFrameTooLarge       = errors.New("Frame length extends the max frame size")
+	ErrUnsupportedMessage  = errors.New("Unsupported message type to encode")
+	ErrVarintOverlong      = errors.New("Varint length field is too long")
+)
+
 const (
 	MaxBufferSize = 5 * 1024 * 1024 // max package size 5m
 )
@@ -17,6 +27,7 @@ const (
 const (
 	StateReadLength = 0 // state read packet length
 	StateReadBody   = 1 // state read packet body
+	StateFailed     = 2 // state the stream is broken, discard all the input
 )
 
 type FrameDecoderState struct {
@@ -31,7 +42,11 @@ type FrameDecoder struct {
 	state             *FrameDecoderState // state of the decoder
 }
 
+// the length is little endian, the packetLengthSize must be 1, 2, 3, 4 or 8
+// use LengthFieldFrameDecoder for the other layouts
 func NewFrameDecoder(packetLengthSize int, containLength bool) *FrameDecoder {
+	checkLengthFieldLength(packetLengthSize)
+
 	handler := &FrameDecoder{
 		lengthSize:        packetLengthSize,
 		containLengthMode: containLength,
@@ -50,30 +65,27 @@ func (this *FrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObjec
 	inputBuffer := obj.(*bytes.Buffer)
 	inputLen := inputBuffer.Len()
 
+	if this.state.state == StateFailed {
+		inputBuffer.Reset()
+		return nil
+	}
+
 	if this.state.state == StateReadLength {
 		if inputLen >= this.lengthSize {
 			lengthBuffer := inputBuffer.Next(this.lengthSize)
-			this.state.msgLen = int(binary.LittleEndian.Uint32(lengthBuffer))
+			this.state.msgLen = int(readLengthField(binary.LittleEndian, lengthBuffer, this.lengthSize))
 
 			if this.containLengthMode {
 				this.state.msgLen -= this.lengthSize
 			}
 
 			if this.state.msgLen < 0 {
-				gonetio.LogError("FrameDecoder of con[%s], message body size[%d] is negtive, something wrong, force close the connection.",
-					filter.GetCon().RemoteAddr(), this.state.msgLen)
-
-				filter.GetCon().Close()
-
+				this.fail(filter, inputBuffer, fmt.Errorf("%w: body size %d", ErrFrameLengthNegative, this.state.msgLen))
 				return nil
 			}
 
 			if this.state.msgLen >= MaxBufferSize {
-				gonetio.LogError("FrameDecoder of con[%s], message body size[%d] extend max buffer size[%d], something is wrong, force close the connection.",
-					filter.GetCon().RemoteAddr(), this.state.msgLen, MaxBufferSize)
-
-				filter.GetCon().Close()
-
+				this.fail(filter, inputBuffer, fmt.Errorf("%w: body size %d, max size %d", ErrFrameTooLarge, this.state.msgLen, MaxBufferSize))
 				return nil
 			}
 
@@ -85,7 +97,8 @@ func (this *FrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObjec
 	if this.state.state == StateReadBody {
 		inputLen := inputBuffer.Len()
 		if inputLen >= this.state.msgLen {
-			msgBodyBuffer := bytes.NewBuffer(inputBuffer.Next(this.state.msgLen))
+			msgBodyBuffer := this.NewFrameBuffer(filter, this.state.msgLen)
+			msgBodyBuffer.Write(inputBuffer.Next(this.state.msgLen))
 
 			this.state.state = StateReadLength
 
@@ -96,6 +109,15 @@ func (this *FrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObjec
 	return nil
 }
 
+// the stream can't be framed any more, discard the input from now on
+// and fire the error through the chain, the handlers decide whether to close the connection
+func (this *FrameDecoder) fail(filter *gonetio.IoFilter, inputBuffer *bytes.Buffer, err error) {
+	this.state.state = StateFailed
+	inputBuffer.Reset()
+
+	filter.ExceptionCaught(err)
+}
+
 // Clone
 func (this *FrameDecoder) Clone() gonetio.IoHandler {
 	return NewFrameDecoder(this.lengthSize, this.containLengthMode)
@@ -0,0 +1,112 @@
+// File FrameDecoder test
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gonetio"
+	"sync"
+	"testing"
+)
+
+// collect the frames and the errors fired by the decoder
+type frameCollector struct {
+	gonetio.IoHandlerImp
+	frames []string
+	errs   []error
+}
+
+func (this *frameCollector) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.frames = append(this.frames, obj.(*bytes.Buffer).String())
+}
+
+func (this *frameCollector) ExceptionCaught(filter *gonetio.IoFilter, err error) {
+	this.errs = append(this.errs, err)
+}
+
+func (this *frameCollector) Clone() gonetio.IoHandler {
+	return &frameCollector{}
+}
+
+// feed the chunks to the decoder one by one, the same as the connection reads them
+func decodeChunks(decoder gonetio.IoHandler, chunks ...[]byte) *frameCollector {
+	collector := &frameCollector{}
+	collector.SetBoundType(gonetio.InBound)
+
+	chain := gonetio.NewIoFilterChain(gonetio.NewConn(nil, 0, &sync.WaitGroup{}, 0))
+	chain.AddLast("decoder", decoder)
+	chain.AddLast("collector", collector)
+
+	input := &bytes.Buffer{}
+	for _, chunk := range chunks {
+		input.Write(chunk)
+		chain.FireMessageReceived(input)
+	}
+	return collector
+}
+
+// split the data to the chunks of n bytes
+func splitEvery(data []byte, n int) [][]byte {
+	chunks := make([][]byte, 0, len(data)/n+1)
+	for len(data) > n {
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return append(chunks, data)
+}
+
+// check the frames and the error decoded, expect no error if err is nil
+func checkDecoded(t *testing.T, name string, collector *frameCollector, frames []string, err error) {
+	t.Helper()
+
+	if len(collector.frames) != len(frames) {
+		t.Fatalf("%s: frames %q, expect %q", name, collector.frames, frames)
+	}
+	for i := range frames {
+		if collector.frames[i] != frames[i] {
+			t.Fatalf("%s: frames %q, expect %q", name, collector.frames, frames)
+		}
+	}
+
+	if err == nil {
+		if len(collector.errs) != 0 {
+			t.Fatalf("%s: unexpected errors %v", name, collector.errs)
+		}
+		return
+	}
+
+	if len(collector.errs) != 1 || !errors.Is(collector.errs[0], err) {
+		t.Fatalf("%s: errors %v, expect one %v", name, collector.errs, err)
+	}
+}
+
+func TestFrameDecoder(t *testing.T) {
+	tooLarge := []byte{0, 0, 0, 0}
+	putLengthField(binary.LittleEndian, tooLarge, 4, MaxBufferSize)
+
+	tests := []struct {
+		name          string
+		lengthSize    int
+		containLength bool
+		chunks        [][]byte
+		frames        []string
+		err           error
+	}{
+		{"whole", 2, false, [][]byte{{3, 0, 'a', 'b', 'c', 1, 0, 'd'}}, []string{"abc", "d"}, nil},
+		{"byte by byte", 2, false, splitEvery([]byte{3, 0, 'a', 'b', 'c', 1, 0, 'd'}, 1), []string{"abc", "d"}, nil},
+		{"split length", 4, false, [][]byte{{3, 0}, {0, 0, 'a'}, {'b', 'c'}}, []string{"abc"}, nil},
+		{"contain length", 2, true, [][]byte{{5, 0, 'a', 'b', 'c'}}, []string{"abc"}, nil},
+		{"empty body", 1, false, [][]byte{{0, 1, 'a'}}, []string{"", "a"}, nil},
+		{"half frame", 2, false, [][]byte{{3, 0, 'a', 'b'}}, nil, nil},
+		{"negative", 2, true, [][]byte{{1, 0, 'a'}}, nil, ErrFrameLengthNegative},
+		{"too large", 4, false, [][]byte{tooLarge}, nil, ErrFrameTooLarge},
+		{"discard after failed", 4, false, [][]byte{tooLarge, {1, 0, 0, 0, 'a'}}, nil, ErrFrameTooLarge},
+	}
+
+	for _, test := range tests {
+		collector := decodeChunks(NewFrameDecoder(test.lengthSize, test.containLength), test.chunks...)
+		checkDecoded(t, test.name, collector, test.frames, test.err)
+	}
+}
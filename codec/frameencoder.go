@@ -7,6 +7,7 @@ package codec
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"gonetio"
 )
 
@@ -17,7 +18,11 @@ type FrameEncoder struct {
 }
 
 // new FrameEncoder
+// the length is little endian, the packetLengthSize must be 1, 2, 3, 4 or 8
+// use LengthFieldFrameEncoder for the other layouts
 func NewFrameEncoder(packetLengthSize int, containLength bool) *FrameEncoder {
+	checkLengthFieldLength(packetLengthSize)
+
 	handler := &FrameEncoder{
 		lengthSize:        packetLengthSize,
 		containLengthMode: containLength,
@@ -36,12 +41,17 @@ func (this *FrameEncoder) Encode(filter *gonetio.IoFilter, obj gonetio.BaseObjec
 		frameLength += this.lengthSize
 	}
 
-	frameBuffer := make([]byte, this.lengthSize)
-	binary.LittleEndian.PutUint32(frameBuffer[:], uint32(frameLength))
+	if uint64(frameLength) > maxLengthFieldValue(this.lengthSize) {
+		encodeFailed(filter, fmt.Errorf("%w: frame length %d doesn't fit in %d bytes", ErrFrameTooLarge, frameLength, this.lengthSize))
+		return nil
+	}
+
+	var frameBuffer [8]byte
+	putLengthField(binary.LittleEndian, frameBuffer[:], this.lengthSize, uint64(frameLength))
 
 	// write frame buffer
-	totalBuffer := bytes.NewBuffer([]byte{})
-	totalBuffer.Write(frameBuffer)
+	totalBuffer := this.NewFrameBuffer(filter, this.lengthSize+intputLength)
+	totalBuffer.Write(frameBuffer[:this.lengthSize])
 
 	// write body buffer
 	totalBuffer.Write(input.Bytes())
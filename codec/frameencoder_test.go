@@ -0,0 +1,112 @@
+// File FrameEncoder test
+
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gonetio"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// start a connection over the pipe with the handlers, return the connection and the peer
+func startPipeCon(t *testing.T, handlers ...gonetio.IoHandler) (*gonetio.Tcpcon, net.Conn) {
+	local, remote := net.Pipe()
+	con := gonetio.NewConnFull(local, 64, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	for i, handler := range handlers {
+		chain.AddLast(string(rune('a'+i)), handler)
+	}
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	t.Cleanup(func() {
+		con.Close()
+		remote.Close()
+	})
+	return con, remote
+}
+
+// send the messages through the encoder, return the bytes the peer read
+func encodeFrames(t *testing.T, encoder gonetio.IoHandler, messages ...string) []byte {
+	t.Helper()
+
+	con, remote := startPipeCon(t, encoder)
+	read := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(remote)
+		read <- data
+	}()
+
+	for _, message := range messages {
+		if err := con.SendAsync(bytes.NewBufferString(message)).Wait(); err != nil {
+			t.Fatalf("send %q failed, %v", message, err)
+		}
+	}
+
+	// all the messages are written to the peer
+	con.Close()
+	return <-read
+}
+
+// send the message the encoder fails on, return the error of the send
+// the failure goes to the writer only, no exception is fired to the in bound handlers
+func sendFailed(t *testing.T, encoder gonetio.IoHandler, obj gonetio.BaseObject) error {
+	t.Helper()
+
+	collector := &frameCollector{}
+	collector.SetBoundType(gonetio.InBound)
+	con, _ := startPipeCon(t, collector, encoder)
+
+	err := con.Send(obj)
+	if len(collector.errs) != 0 {
+		t.Fatalf("send %T, unexpected exceptions %v", obj, collector.errs)
+	}
+	return err
+}
+
+func TestFrameEncoderRoundTrip(t *testing.T) {
+	messages := []string{"", "a", strings.Repeat("x", 255), strings.Repeat("y", 300)}
+
+	tests := []struct {
+		lengthSize    int
+		containLength bool
+	}{
+		{2, false},
+		{2, true},
+		{3, false},
+		{4, true},
+		{8, false},
+	}
+
+	for _, test := range tests {
+		data := encodeFrames(t, NewFrameEncoder(test.lengthSize, test.containLength), messages...)
+		collector := decodeChunks(NewFrameDecoder(test.lengthSize, test.containLength), splitEvery(data, 7)...)
+		checkDecoded(t, fmt.Sprintf("length size %d, contain length %v", test.lengthSize, test.containLength), collector, messages, nil)
+	}
+}
+
+func TestFrameEncoderTooLarge(t *testing.T) {
+	tests := []struct {
+		lengthSize    int
+		containLength bool
+		payload       int
+	}{
+		{1, false, 256},
+		{1, true, 255},
+		{2, false, 1 << 16},
+		{3, true, 1<<24 - 2},
+	}
+
+	for _, test := range tests {
+		err := sendFailed(t, NewFrameEncoder(test.lengthSize, test.containLength), bytes.NewBuffer(make([]byte, test.payload)))
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("length size %d, payload %d, err %v, expect ErrFrameTooLarge", test.lengthSize, test.payload, err)
+		}
+	}
+}
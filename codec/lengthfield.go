@@ -0,0 +1,73 @@
+// File LengthField
+
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// check the length field size, only 1, 2, 3, 4 and 8 bytes are supported
+func checkLengthFieldLength(size int) {
+	switch size {
+	case 1, 2, 3, 4, 8:
+	default:
+		panic(fmt.Sprintf("unsupported length field length %d, expect 1, 2, 3, 4 or 8", size))
+	}
+}
+
+// is the byte order big endian
+func isBigEndian(order binary.ByteOrder) bool {
+	return order.Uint16([]byte{0, 1}) == 1
+}
+
+// the max value the length field can hold
+func maxLengthFieldValue(size int) uint64 {
+	if size >= 8 {
+		return ^uint64(0)
+	}
+	return uint64(1)<<(uint(size)*8) - 1
+}
+
+// read the length field
+func readLengthField(order binary.ByteOrder, data []byte, size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(order.Uint16(data))
+	case 3:
+		if isBigEndian(order) {
+			return uint64(data[0])<<16 | uint64(data[1])<<8 | uint64(data[2])
+		}
+		return uint64(data[2])<<16 | uint64(data[1])<<8 | uint64(data[0])
+	case 4:
+		return uint64(order.Uint32(data))
+	case 8:
+		return order.Uint64(data)
+	}
+
+	panic(fmt.Sprintf("unsupported length field length %d", size))
+}
+
+// put the length field
+func putLengthField(order binary.ByteOrder, data []byte, size int, value uint64) {
+	switch size {
+	case 1:
+		data[0] = byte(value)
+	case 2:
+		order.PutUint16(data, uint16(value))
+	case 3:
+		if isBigEndian(order) {
+			data[0], data[1], data[2] = byte(value>>16), byte(value>>8), byte(value)
+		} else {
+			data[0], data[1], data[2] = byte(value), byte(value>>8), byte(value>>16)
+		}
+	case 4:
+		order.PutUint32(data, uint32(value))
+	case 8:
+		order.PutUint64(data, value)
+	default:
+		panic(fmt.Sprintf("unsupported length field length %d", size))
+	}
+}
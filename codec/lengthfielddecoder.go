@@ -0,0 +1,107 @@
+// File LengthFieldFrameDecoder
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gonetio"
+)
+
+// the frame decoder splits the frames by the length field in the header
+// the whole frame length is lengthFieldOffset + lengthFieldLength + length field value + lengthAdjustment,
+// the first initialBytesToStrip bytes of the frame are stripped from the output
+// e.g. a 2 bytes message id followed by a 4 bytes big endian body length, keep the header:
+// NewLengthFieldFrameDecoder(binary.BigEndian, maxLen, 2, 4, 0, 0)
+type LengthFieldFrameDecoder struct {
+	ProtocolDecoder
+	byteOrder           binary.ByteOrder // the byte order of the length field
+	maxFrameLength      int              // the max length of the whole frame
+	lengthFieldOffset   int              // the offset of the length field
+	lengthFieldLength   int              // the size of the length field, 1, 2, 3, 4 or 8
+	lengthAdjustment    int              // the value added to the length field value
+	initialBytesToStrip int              // the bytes stripped from the head of the frame
+	failed              bool             // the stream is broken, discard all the input
+}
+
+// new length field frame decoder
+func NewLengthFieldFrameDecoder(byteOrder binary.ByteOrder, maxFrameLength int, lengthFieldOffset int, lengthFieldLength int,
+	lengthAdjustment int, initialBytesToStrip int) *LengthFieldFrameDecoder {
+
+	checkLengthFieldLength(lengthFieldLength)
+
+	handler := &LengthFieldFrameDecoder{
+		byteOrder:           byteOrder,
+		maxFrameLength:      maxFrameLength,
+		lengthFieldOffset:   lengthFieldOffset,
+		lengthFieldLength:   lengthFieldLength,
+		lengthAdjustment:    lengthAdjustment,
+		initialBytesToStrip: initialBytesToStrip,
+		failed:              false,
+	}
+	handler.SetBoundType(gonetio.InBound)
+	handler.SetDecoder(handler)
+	return handler
+}
+
+func (this *LengthFieldFrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	inputBuffer := obj.(*bytes.Buffer)
+
+	if this.failed {
+		inputBuffer.Reset()
+		return nil
+	}
+
+	lengthFieldEndOffset := this.lengthFieldOffset + this.lengthFieldLength
+	data := inputBuffer.Bytes()
+	if len(data) < lengthFieldEndOffset {
+		return nil
+	}
+
+	lengthValue := readLengthField(this.byteOrder, data[this.lengthFieldOffset:], this.lengthFieldLength)
+	if lengthValue > uint64(this.maxFrameLength) {
+		this.fail(filter, inputBuffer, fmt.Errorf("%w: length field %d, max frame size %d", ErrFrameTooLarge, lengthValue, this.maxFrameLength))
+		return nil
+	}
+
+	frameLength := int(lengthValue) + this.lengthAdjustment + lengthFieldEndOffset
+	if frameLength < lengthFieldEndOffset {
+		this.fail(filter, inputBuffer, fmt.Errorf("%w: frame length %d is less than the length field end offset %d", ErrFrameLengthNegative, frameLength, lengthFieldEndOffset))
+		return nil
+	}
+
+	if frameLength > this.maxFrameLength {
+		this.fail(filter, inputBuffer, fmt.Errorf("%w: frame length %d, max frame size %d", ErrFrameTooLarge, frameLength, this.maxFrameLength))
+		return nil
+	}
+
+	if frameLength < this.initialBytesToStrip {
+		this.fail(filter, inputBuffer, fmt.Errorf("%w: frame length %d is less than the bytes to strip %d", ErrFrameLengthNegative, frameLength, this.initialBytesToStrip))
+		return nil
+	}
+
+	if len(data) < frameLength {
+		return nil
+	}
+
+	inputBuffer.Next(this.initialBytesToStrip)
+	frameBuffer := this.NewFrameBuffer(filter, frameLength-this.initialBytesToStrip)
+	frameBuffer.Write(inputBuffer.Next(frameLength - this.initialBytesToStrip))
+	return frameBuffer
+}
+
+// the stream can't be framed any more, discard the input from now on
+// and fire the error through the chain
+func (this *LengthFieldFrameDecoder) fail(filter *gonetio.IoFilter, inputBuffer *bytes.Buffer, err error) {
+	this.failed = true
+	inputBuffer.Reset()
+
+	filter.ExceptionCaught(err)
+}
+
+// Clone
+func (this *LengthFieldFrameDecoder) Clone() gonetio.IoHandler {
+	return NewLengthFieldFrameDecoder(this.byteOrder, this.maxFrameLength, this.lengthFieldOffset, this.lengthFieldLength,
+		this.lengthAdjustment, this.initialBytesToStrip)
+}
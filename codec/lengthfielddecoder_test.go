@@ -0,0 +1,49 @@
+// File LengthFieldFrameDecoder test
+
+package codec
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestLengthFieldFrameDecoder(t *testing.T) {
+	// a 2 bytes message id followed by a 4 bytes big endian body length
+	frame := []byte{0, 7, 0, 0, 0, 3, 'a', 'b', 'c'}
+
+	tests := []struct {
+		name    string
+		decoder *LengthFieldFrameDecoder
+		chunks  [][]byte
+		frames  []string
+		err     error
+	}{
+		{"keep header", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 2, 4, 0, 0),
+			[][]byte{frame}, []string{string(frame)}, nil},
+		{"strip header", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 2, 4, 0, 6),
+			[][]byte{frame, frame}, []string{"abc", "abc"}, nil},
+		{"byte by byte", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 2, 4, 0, 6),
+			splitEvery(append(append([]byte{}, frame...), frame...), 1), []string{"abc", "abc"}, nil},
+		{"little endian", NewLengthFieldFrameDecoder(binary.LittleEndian, 16, 0, 2, 0, 2),
+			[][]byte{{2, 0, 'a', 'b'}}, []string{"ab"}, nil},
+		{"length includes header", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 0, 2, -2, 2),
+			[][]byte{{0, 4, 'a', 'b'}}, []string{"ab"}, nil},
+		{"half frame", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 2, 4, 0, 0),
+			[][]byte{frame[:8]}, nil, nil},
+		{"length field too large", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 0, 4, 0, 0),
+			[][]byte{{0, 0, 1, 0}}, nil, ErrFrameTooLarge},
+		{"frame too large", NewLengthFieldFrameDecoder(binary.BigEndian, 8, 2, 4, 0, 0),
+			[][]byte{frame}, nil, ErrFrameTooLarge},
+		{"negative frame", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 0, 2, -4, 0),
+			[][]byte{{0, 1, 'a'}}, nil, ErrFrameLengthNegative},
+		{"strip beyond frame", NewLengthFieldFrameDecoder(binary.BigEndian, 16, 0, 1, 0, 4),
+			[][]byte{{1, 'a'}}, nil, ErrFrameLengthNegative},
+		{"discard after failed", NewLengthFieldFrameDecoder(binary.BigEndian, 8, 2, 4, 0, 0),
+			[][]byte{frame, {0, 7, 0, 0, 0, 0}}, nil, ErrFrameTooLarge},
+	}
+
+	for _, test := range tests {
+		collector := decodeChunks(test.decoder, test.chunks...)
+		checkDecoded(t, test.name, collector, test.frames, test.err)
+	}
+}
@@ -0,0 +1,68 @@
+// File LengthFieldFrameEncoder
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gonetio"
+)
+
+// the frame encoder prepends the length field to the message
+// the length field value is message length + lengthAdjustment, plus lengthFieldLength if lengthIncludesLengthField
+type LengthFieldFrameEncoder struct {
+	ProtocolEncoder
+	byteOrder                 binary.ByteOrder // the byte order of the length field
+	lengthFieldLength         int              // the size of the length field, 1, 2, 3, 4 or 8
+	lengthAdjustment          int              // the value added to the length field value
+	lengthIncludesLengthField bool             // flag weather the length field value contains the length field size
+}
+
+// new length field frame encoder
+func NewLengthFieldFrameEncoder(byteOrder binary.ByteOrder, lengthFieldLength int, lengthAdjustment int, lengthIncludesLengthField bool) *LengthFieldFrameEncoder {
+	checkLengthFieldLength(lengthFieldLength)
+
+	handler := &LengthFieldFrameEncoder{
+		byteOrder:                 byteOrder,
+		lengthFieldLength:         lengthFieldLength,
+		lengthAdjustment:          lengthAdjustment,
+		lengthIncludesLengthField: lengthIncludesLengthField,
+	}
+	handler.SetBoundType(gonetio.OutBound)
+	handler.SetEncoder(handler)
+	return handler
+}
+
+func (this *LengthFieldFrameEncoder) Encode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	input := obj.(*bytes.Buffer)
+
+	length := input.Len() + this.lengthAdjustment
+	if this.lengthIncludesLengthField {
+		length += this.lengthFieldLength
+	}
+
+	if length < 0 {
+		encodeFailed(filter, fmt.Errorf("%w: length field %d", ErrFrameLengthNegative, length))
+		return nil
+	}
+
+	if uint64(length) > maxLengthFieldValue(this.lengthFieldLength) {
+		encodeFailed(filter, fmt.Errorf("%w: length field %d doesn't fit in %d bytes", ErrFrameTooLarge, length, this.lengthFieldLength))
+		return nil
+	}
+
+	var lengthField [8]byte
+	putLengthField(this.byteOrder, lengthField[:], this.lengthFieldLength, uint64(length))
+
+	totalBuffer := this.NewFrameBuffer(filter, this.lengthFieldLength+input.Len())
+	totalBuffer.Write(lengthField[:this.lengthFieldLength])
+	totalBuffer.Write(input.Bytes())
+
+	return totalBuffer
+}
+
+// Clone
+func (this *LengthFieldFrameEncoder) Clone() gonetio.IoHandler {
+	return NewLengthFieldFrameEncoder(this.byteOrder, this.lengthFieldLength, this.lengthAdjustment, this.lengthIncludesLengthField)
+}
@@ -0,0 +1,64 @@
+// File LengthFieldFrameEncoder test
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLengthFieldFrameEncoderRoundTrip(t *testing.T) {
+	messages := []string{"", "abc", strings.Repeat("x", 300)}
+
+	tests := []struct {
+		byteOrder         binary.ByteOrder
+		lengthFieldLength int
+		lengthAdjustment  int
+		includesLength    bool
+	}{
+		{binary.BigEndian, 2, 0, false},
+		{binary.LittleEndian, 3, 0, false},
+		{binary.BigEndian, 4, 0, true},
+		{binary.BigEndian, 4, 2, false},
+		{binary.LittleEndian, 8, 0, true},
+	}
+
+	for _, test := range tests {
+		encoder := NewLengthFieldFrameEncoder(test.byteOrder, test.lengthFieldLength, test.lengthAdjustment, test.includesLength)
+		data := encodeFrames(t, encoder, messages...)
+
+		// the decoder adds the adjustment to the field value to get the body length
+		adjustment := -test.lengthAdjustment
+		if test.includesLength {
+			adjustment -= test.lengthFieldLength
+		}
+		decoder := NewLengthFieldFrameDecoder(test.byteOrder, 1024, 0, test.lengthFieldLength, adjustment, test.lengthFieldLength)
+
+		collector := decodeChunks(decoder, splitEvery(data, 5)...)
+		checkDecoded(t, fmt.Sprintf("%v %d bytes length field", test.byteOrder, test.lengthFieldLength), collector, messages, nil)
+	}
+}
+
+func TestLengthFieldFrameEncoderFailed(t *testing.T) {
+	tests := []struct {
+		lengthFieldLength int
+		lengthAdjustment  int
+		message           string
+		err               error
+	}{
+		{1, 0, strings.Repeat("x", 256), ErrFrameTooLarge},
+		{2, 1, strings.Repeat("x", 1<<16-1), ErrFrameTooLarge},
+		{2, -2, "a", ErrFrameLengthNegative},
+	}
+
+	for _, test := range tests {
+		err := sendFailed(t, NewLengthFieldFrameEncoder(binary.BigEndian, test.lengthFieldLength, test.lengthAdjustment, false), bytes.NewBufferString(test.message))
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%d bytes length field, message of %d bytes, err %v, expect %v", test.lengthFieldLength, len(test.message), err, test.err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// File MessageCodec
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gonetio"
+)
+
+// error type
+var (
+	ErrMessageHeader = errors.New("Message header is broken")
+	ErrMessageBody   = errors.New("Message body serialize failed")
+)
+
+// the message with the header, fired and written when the sequence number is enabled
+type Envelope struct {
+	ID   uint32      // the message id, looked up by the body type on write
+	Seq  uint32      // the sequence number
+	Body interface{} // the typed message, a pointer to the registered type
+}
+
+// the typed message codec, it works on whole frames, so add it after a frame decoder/encoder
+// the frame is: uint32 message id, uint32 sequence number if enabled, then the body
+// the in bound frame is fired as a pointer to the registered type, or a *Envelope if the sequence number enabled
+// the out bound message can be a registered typed message, a *Envelope, or a *bytes.Buffer which is written as it is
+type MessageCodec struct {
+	gonetio.IoHandlerAdaptor
+	registry   *MessageRegistry // the message registry, shared by the cloned codecs
+	serializer Serializer       // the body serializer
+	seqEnabled bool             // flag weather the header carries the sequence number
+	byteOrder  binary.ByteOrder // the byte order of the header, little endian default
+}
+
+// new message codec
+func NewMessageCodec(registry *MessageRegistry, serializer Serializer, seqEnabled bool) *MessageCodec {
+	handler := &MessageCodec{
+		registry:   registry,
+		serializer: serializer,
+		seqEnabled: seqEnabled,
+		byteOrder:  binary.LittleEndian,
+	}
+	handler.SetBoundType(gonetio.InBound | gonetio.OutBound)
+	return handler
+}
+
+// set the byte order of the header
+func (this *MessageCodec) SetByteOrder(byteOrder binary.ByteOrder) {
+	this.byteOrder = byteOrder
+}
+
+// get the message registry
+func (this *MessageCodec) GetRegistry() *MessageRegistry {
+	return this.registry
+}
+
+// get the header size
+func (this *MessageCodec) headerSize() int {
+	if this.seqEnabled {
+		return 8
+	}
+	return 4
+}
+
+// The event fired when receive message from the connection
+func (this *MessageCodec) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	input := obj.(*bytes.Buffer)
+	data := input.Bytes()
+	input.Reset()
+
+	if len(data) < this.headerSize() {
+		filter.ExceptionCaught(fmt.Errorf("%w: frame length %d, header size %d", ErrMessageHeader, len(data), this.headerSize()))
+		return
+	}
+
+	id := this.byteOrder.Uint32(data)
+	msg, err := this.registry.NewMessage(id)
+	if err != nil {
+		filter.ExceptionCaught(err)
+		return
+	}
+
+	if err := this.serializer.Unmarshal(data[this.headerSize():], msg); err != nil {
+		filter.ExceptionCaught(fmt.Errorf("%w: unmarshal message %d, %s", ErrMessageBody, id, err.Error()))
+		return
+	}
+
+	if !this.seqEnabled {
+		filter.MessageReceived(msg)
+		return
+	}
+
+	filter.MessageReceived(&Envelope{
+		ID:   id,
+		Seq:  this.byteOrder.Uint32(data[4:]),
+		Body: msg,
+	})
+}
+
+// Fire Write
+func (this *MessageCodec) FireWrite(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	if buffer, ok := obj.(*bytes.Buffer); ok {
+		filter.FireWrite(buffer)
+		return
+	}
+
+	var seq uint32 = 0
+	body := obj
+	if envelope, ok := obj.(*Envelope); ok {
+		seq = envelope.Seq
+		body = envelope.Body
+	}
+
+	buffer, err := this.encode(filter, body, seq)
+	if err != nil {
+		encodeFailed(filter, err)
+		return
+	}
+
+	filter.FireWrite(buffer)
+	releaseWriteBuffer(filter, buffer)
+}
+
+// encode the message with the header
+// the id is looked up by the body type, so an envelope can't lie about it
+func (this *MessageCodec) encode(filter *gonetio.IoFilter, body interface{}, seq uint32) (*bytes.Buffer, error) {
+	id, err := this.registry.GetID(body)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := this.serializer.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: marshal message %d, %s", ErrMessageBody, id, err.Error())
+	}
+
+	var header [8]byte
+	this.byteOrder.PutUint32(header[:], id)
+	if this.seqEnabled {
+		this.byteOrder.PutUint32(header[4:], seq)
+	}
+
+	buffer := newWriteBuffer(filter, this.headerSize()+len(data))
+	buffer.Write(header[:this.headerSize()])
+	buffer.Write(data)
+
+	return buffer, nil
+}
+
+// Clone
+func (this *MessageCodec) Clone() gonetio.IoHandler {
+	handler := NewMessageCodec(this.registry, this.serializer, this.seqEnabled)
+	handler.byteOrder = this.byteOrder
+	return handler
+}
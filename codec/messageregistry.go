@@ -0,0 +1,102 @@
+// File MessageRegistry
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// error type
+var (
+	ErrMessageIDDuplicate   = errors.New("Message id already registered")
+	ErrMessageTypeDuplicate = errors.New("Message type already registered")
+	ErrMessageNotRegistered = errors.New("Message not registered")
+)
+
+// the registry of the message id and the go type
+// it's safe to share the registry between the connections
+type MessageRegistry struct {
+	mtx   *sync.RWMutex
+	types map[uint32]reflect.Type // <id, struct type>
+	ids   map[reflect.Type]uint32 // <struct type, id>
+}
+
+// new message registry
+func NewMessageRegistry() *MessageRegistry {
+	return &MessageRegistry{
+		mtx:   &sync.RWMutex{},
+		types: make(map[uint32]reflect.Type),
+		ids:   make(map[reflect.Type]uint32),
+	}
+}
+
+// get the struct type of the message, the message can be a value or a pointer
+func messageType(msg interface{}) reflect.Type {
+	t := reflect.TypeOf(msg)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// register the message type with the id, the message is a value or a pointer of the type
+// e.g. registry.Register(1, &LoginRequest{})
+func (this *MessageRegistry) Register(id uint32, msg interface{}) error {
+	t := messageType(msg)
+	if t == nil {
+		return fmt.Errorf("%w: nil message of id %d", ErrMessageNotRegistered, id)
+	}
+
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if old, ok := this.types[id]; ok {
+		return fmt.Errorf("%w: id %d, type %s", ErrMessageIDDuplicate, id, old.String())
+	}
+
+	if old, ok := this.ids[t]; ok {
+		return fmt.Errorf("%w: type %s, id %d", ErrMessageTypeDuplicate, t.String(), old)
+	}
+
+	this.types[id] = t
+	this.ids[t] = id
+	return nil
+}
+
+// get the id of the message, the message can be a value or a pointer
+func (this *MessageRegistry) GetID(msg interface{}) (uint32, error) {
+	t := messageType(msg)
+
+	this.mtx.RLock()
+	defer this.mtx.RUnlock()
+
+	id, ok := this.ids[t]
+	if !ok {
+		return 0, fmt.Errorf("%w: type %v", ErrMessageNotRegistered, t)
+	}
+	return id, nil
+}
+
+// get the type registered with the id
+func (this *MessageRegistry) GetType(id uint32) (reflect.Type, error) {
+	this.mtx.RLock()
+	defer this.mtx.RUnlock()
+
+	t, ok := this.types[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrMessageNotRegistered, id)
+	}
+	return t, nil
+}
+
+// new a message of the id, return a pointer to the zero value of the type
+func (this *MessageRegistry) NewMessage(id uint32) (interface{}, error) {
+	t, err := this.GetType(id)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.New(t).Interface(), nil
+}
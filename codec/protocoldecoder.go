@@ -5,6 +5,7 @@
 package codec
 
 import (
+	"bytes"
 	"gonetio"
 )
 
@@ -14,7 +15,8 @@ type Decoder interface {
 
 type ProtocolDecoder struct {
 	gonetio.IoHandlerAdaptor
-	decoder Decoder // the real decoder
+	decoder Decoder       // the real decoder
+	frame   *bytes.Buffer // the pooled frame decoded, released after the next filters handled it
 }
 
 func (this *ProtocolDecoder) SetDecoder(dcoder Decoder) {
@@ -25,13 +27,38 @@ func (this *ProtocolDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseOb
 	return obj
 }
 
+// get an empty buffer for the frame to decode, the decoder returns it from Decode
+// it's a pooled one released after the next filters handled it if the chain uses the pooled buffers,
+// otherwise the handlers can keep it
+func (this *ProtocolDecoder) NewFrameBuffer(filter *gonetio.IoFilter, size int) *bytes.Buffer {
+	if !filter.GetChain().IsPooledBuffers() {
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+
+	this.frame = gonetio.GetBuffer(size)
+	return this.frame
+}
+
 func (this *ProtocolDecoder) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
 	for {
 		outObject := this.decoder.Decode(filter, obj)
 		if outObject != nil {
 			filter.MessageReceived(outObject)
+			this.releaseFrame(outObject)
 		} else {
 			break
 		}
 	}
 }
+
+// release the pooled frame if it's the object fired
+func (this *ProtocolDecoder) releaseFrame(obj gonetio.BaseObject) {
+	if this.frame == nil {
+		return
+	}
+
+	if buffer, ok := obj.(*bytes.Buffer); ok && buffer == this.frame {
+		gonetio.PutBuffer(buffer)
+	}
+	this.frame = nil
+}
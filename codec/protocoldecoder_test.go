@@ -0,0 +1,64 @@
+// File ProtocolDecoder test
+
+package codec
+
+import (
+	"bytes"
+	"gonetio"
+	"sync"
+	"testing"
+)
+
+// keep the frames decoded after the events returned
+type retainingHandler struct {
+	gonetio.IoHandlerImp
+	frames []*bytes.Buffer
+}
+
+func (this *retainingHandler) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.frames = append(this.frames, obj.(*bytes.Buffer))
+}
+
+func (this *retainingHandler) Clone() gonetio.IoHandler {
+	return &retainingHandler{}
+}
+
+func TestProtocolDecoderPooledBuffers(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	input := &bytes.Buffer{}
+	for _, message := range messages {
+		input.Write([]byte{byte(len(message)), 0})
+		input.WriteString(message)
+	}
+
+	tests := []struct {
+		pooled bool
+		expect []string // the frames the handler kept
+	}{
+		// the frames are the handler's, they stay intact
+		{false, messages},
+		// the frames are released to the pool after the events returned
+		{true, []string{"", "", ""}},
+	}
+
+	for _, test := range tests {
+		handler := &retainingHandler{}
+		handler.SetBoundType(gonetio.InBound)
+
+		chain := gonetio.NewIoFilterChain(gonetio.NewConn(nil, 0, &sync.WaitGroup{}, 0))
+		chain.SetPooledBuffers(test.pooled)
+		chain.AddLast("decoder", NewFrameDecoder(2, false))
+		chain.AddLast("handler", handler)
+		chain.FireMessageReceived(bytes.NewBuffer(input.Bytes()))
+
+		if len(handler.frames) != len(test.expect) {
+			t.Fatalf("pooled %v, %d frames, expect %d", test.pooled, len(handler.frames), len(test.expect))
+		}
+		for i, frame := range handler.frames {
+			if frame.String() != test.expect[i] {
+				t.Fatalf("pooled %v, frame %d is %q, expect %q", test.pooled, i, frame.String(), test.expect[i])
+			}
+		}
+	}
+}
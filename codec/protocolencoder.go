@@ -5,6 +5,7 @@
 package codec
 
 import (
+	"bytes"
 	"gonetio"
 )
 
@@ -25,6 +26,45 @@ func (this *ProtocolEncoder) Encode(filter *gonetio.IoFilter, obj gonetio.BaseOb
 	return obj
 }
 
+// get an empty buffer for the encoded output, the encoder returns it from Encode
+// it's a pooled one if the chain uses the pooled buffers, released after it's written to the connection, or after the next filters consumed it
+func (this *ProtocolEncoder) NewFrameBuffer(filter *gonetio.IoFilter, size int) *bytes.Buffer {
+	return newWriteBuffer(filter, size)
+}
+
+// release the pooled out bound buffer if it's not in the send queue
+func releaseWriteBuffer(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	if buffer, ok := obj.(*bytes.Buffer); ok && filter.GetCon() != nil {
+		filter.GetCon().ReleaseWriteBuffer(buffer)
+	}
+}
+
+// fail the write future with the error, the writer gets it from the future
+// it's an out bound failure, so no in bound exception is fired, it's only logged if the write has no future
+func encodeFailed(filter *gonetio.IoFilter, err error) {
+	if !filter.FailWrite(err) {
+		filter.Logger().Log(gonetio.LvlWarn, "message encode failed", "err", err)
+	}
+}
+
+// get an empty buffer for the out bound message from the connection of the filter
+func newWriteBuffer(filter *gonetio.IoFilter, size int) *bytes.Buffer {
+	if con := filter.GetCon(); con != nil {
+		return con.NewWriteBuffer(size)
+	}
+	return bytes.NewBuffer(make([]byte, 0, size))
+}
+
+// the encoder returns nil when the object can't be encoded, nothing is written then,
+// and the write future fails with ErrEncodeFailed
+// the pooled output is released after the next filters consumed it, unless it's in the send queue
 func (this *ProtocolEncoder) FireWrite(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
-	filter.FireWrite(this.encoder.Encode(filter, obj))
+	outObject := this.encoder.Encode(filter, obj)
+	if outObject == nil {
+		filter.FailWrite(gonetio.ErrEncodeFailed)
+		return
+	}
+
+	filter.FireWrite(outObject)
+	releaseWriteBuffer(filter, outObject)
 }
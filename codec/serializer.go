@@ -0,0 +1,93 @@
+// File Serializer
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// the message body serializer
+// the implementations must be safe for concurrent use
+type Serializer interface {
+	// marshal the message to the bytes
+	Marshal(msg interface{}) ([]byte, error)
+
+	// unmarshal the bytes to the message, the msg is a pointer
+	Unmarshal(data []byte, msg interface{}) error
+}
+
+// the serializer of encoding/binary, for the fixed size structs
+type BinarySerializer struct {
+	byteOrder binary.ByteOrder
+}
+
+// new binary serializer
+func NewBinarySerializer(byteOrder binary.ByteOrder) *BinarySerializer {
+	return &BinarySerializer{
+		byteOrder: byteOrder,
+	}
+}
+
+func (this *BinarySerializer) Marshal(msg interface{}) ([]byte, error) {
+	size := binary.Size(msg)
+	if size < 0 {
+		return nil, fmt.Errorf("binary body %T is not fixed size", msg)
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, size))
+	if err := binary.Write(buffer, this.byteOrder, msg); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (this *BinarySerializer) Unmarshal(data []byte, msg interface{}) error {
+	size := binary.Size(msg)
+	if size != len(data) {
+		return fmt.Errorf("binary body size %d, expect %d", len(data), size)
+	}
+	return binary.Read(bytes.NewReader(data), this.byteOrder, msg)
+}
+
+// the serializer of encoding/gob
+// each message carries its own type info, no state between the messages
+type GobSerializer struct {
+}
+
+// new gob serializer
+func NewGobSerializer() *GobSerializer {
+	return &GobSerializer{}
+}
+
+func (this *GobSerializer) Marshal(msg interface{}) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	if err := gob.NewEncoder(buffer).Encode(msg); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (this *GobSerializer) Unmarshal(data []byte, msg interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(msg)
+}
+
+// the serializer of encoding/json
+type JsonSerializer struct {
+}
+
+// new json serializer
+func NewJsonSerializer() *JsonSerializer {
+	return &JsonSerializer{}
+}
+
+func (this *JsonSerializer) Marshal(msg interface{}) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (this *JsonSerializer) Unmarshal(data []byte, msg interface{}) error {
+	return json.Unmarshal(data, msg)
+}
@@ -0,0 +1,44 @@
+// File Serializer test
+
+package codec
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type fixedBody struct {
+	X int32
+	Y uint16
+}
+
+type variableBody struct {
+	Name string
+	Tags []int32
+}
+
+func TestBinarySerializer(t *testing.T) {
+	serializer := NewBinarySerializer(binary.BigEndian)
+
+	data, err := serializer.Marshal(&fixedBody{X: -1, Y: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 6 {
+		t.Fatalf("marshaled size %d, expect 6", len(data))
+	}
+
+	body := &fixedBody{}
+	if err := serializer.Unmarshal(data, body); err != nil {
+		t.Fatal(err)
+	}
+	if body.X != -1 || body.Y != 7 {
+		t.Fatalf("unmarshaled %+v", body)
+	}
+
+	for _, msg := range []interface{}{&variableBody{Name: "a"}, "text", map[string]int{}} {
+		if _, err := serializer.Marshal(msg); err == nil {
+			t.Fatalf("marshal %T, expect error", msg)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// File VarintFrameDecoder
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"gonetio"
+)
+
+// the max size of the varint length field, a 32 bits value takes 5 bytes at most
+const maxVarintLengthFieldSize = 5
+
+// the frame decoder splits the frames by the base 128 varint length prefix,
+// the same as the protobuf length delimited stream
+// the length field is stripped from the output
+type VarintFrameDecoder struct {
+	ProtocolDecoder
+	maxFrameLength int  // the max length of the frame body
+	failed         bool // the stream is broken, discard all the input
+}
+
+// new varint frame decoder
+func NewVarintFrameDecoder(maxFrameLength int) *VarintFrameDecoder {
+	handler := &VarintFrameDecoder{
+		maxFrameLength: maxFrameLength,
+		failed:         false,
+	}
+	handler.SetBoundType(gonetio.InBound)
+	handler.SetDecoder(handler)
+	return handler
+}
+
+// read the varint from the data
+// return the value and the bytes it takes, 0 bytes if the data is not enough
+func readVarint(data []byte) (uint64, int, error) {
+	var value uint64 = 0
+	for i := 0; i < len(data) && i < maxVarintLengthFieldSize; i++ {
+		b := data[i]
+		if b < 0x80 {
+			if i == maxVarintLengthFieldSize-1 && b > 0x0f {
+				return 0, 0, fmt.Errorf("%w: value overflows 32 bits", ErrVarintOverlong)
+			}
+			return value | uint64(b)<<(7*uint(i)), i + 1, nil
+		}
+		value |= uint64(b&0x7f) << (7 * uint(i))
+	}
+
+	if len(data) >= maxVarintLengthFieldSize {
+		return 0, 0, fmt.Errorf("%w: more than %d bytes", ErrVarintOverlong, maxVarintLengthFieldSize)
+	}
+	return 0, 0, nil
+}
+
+func (this *VarintFrameDecoder) Decode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	inputBuffer := obj.(*bytes.Buffer)
+
+	if this.failed {
+		inputBuffer.Reset()
+		return nil
+	}
+
+	data := inputBuffer.Bytes()
+	length, lengthFieldSize, err := readVarint(data)
+	if err != nil {
+		this.fail(filter, inputBuffer, err)
+		return nil
+	}
+
+	if lengthFieldSize == 0 {
+		return nil
+	}
+
+	if length > uint64(this.maxFrameLength) {
+		this.fail(filter, inputBuffer, fmt.Errorf("%w: frame length %d, max frame size %d", ErrFrameTooLarge, length, this.maxFrameLength))
+		return nil
+	}
+
+	if len(data) < lengthFieldSize+int(length) {
+		return nil
+	}
+
+	inputBuffer.Next(lengthFieldSize)
+	frameBuffer := this.NewFrameBuffer(filter, int(length))
+	frameBuffer.Write(inputBuffer.Next(int(length)))
+	return frameBuffer
+}
+
+// the stream can't be framed any more, discard the input from now on
+// and fire the error through the chain
+func (this *VarintFrameDecoder) fail(filter *gonetio.IoFilter, inputBuffer *bytes.Buffer, err error) {
+	this.failed = true
+	inputBuffer.Reset()
+
+	filter.ExceptionCaught(err)
+}
+
+// Clone
+func (this *VarintFrameDecoder) Clone() gonetio.IoHandler {
+	return NewVarintFrameDecoder(this.maxFrameLength)
+}
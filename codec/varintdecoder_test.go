@@ -0,0 +1,38 @@
+// File VarintFrameDecoder test
+
+package codec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVarintFrameDecoder(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	longFrame := append([]byte{0xac, 0x02}, long...)
+
+	tests := []struct {
+		name           string
+		maxFrameLength int
+		chunks         [][]byte
+		frames         []string
+		err            error
+	}{
+		{"whole", 16, [][]byte{{3, 'a', 'b', 'c', 1, 'd'}}, []string{"abc", "d"}, nil},
+		{"empty body", 16, [][]byte{{0, 1, 'a'}}, []string{"", "a"}, nil},
+		{"two bytes length", 300, [][]byte{longFrame}, []string{long}, nil},
+		{"split length", 300, [][]byte{longFrame[:1], longFrame[1:]}, []string{long}, nil},
+		{"byte by byte", 300, splitEvery(longFrame, 1), []string{long}, nil},
+		{"half frame", 16, [][]byte{{3, 'a', 'b'}}, nil, nil},
+		{"too large", 299, [][]byte{longFrame}, nil, ErrFrameTooLarge},
+		{"overlong", 16, [][]byte{{0x80, 0x80, 0x80, 0x80, 0x80, 0}}, nil, ErrVarintOverlong},
+		{"overlong split", 16, [][]byte{{0x80, 0x80}, {0x80, 0x80}, {0x80}}, nil, ErrVarintOverlong},
+		{"overflow 32 bits", 16, [][]byte{{0xff, 0xff, 0xff, 0xff, 0x1f}}, nil, ErrVarintOverlong},
+		{"discard after failed", 16, [][]byte{{0x80, 0x80, 0x80, 0x80, 0x80}, {1, 'a'}}, nil, ErrVarintOverlong},
+	}
+
+	for _, test := range tests {
+		collector := decodeChunks(NewVarintFrameDecoder(test.maxFrameLength), test.chunks...)
+		checkDecoded(t, test.name, collector, test.frames, test.err)
+	}
+}
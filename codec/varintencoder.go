@@ -0,0 +1,48 @@
+// File VarintFrameEncoder
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gonetio"
+	"math"
+)
+
+// the frame encoder prepends the base 128 varint length to the message,
+// the same as the protobuf length delimited stream
+type VarintFrameEncoder struct {
+	ProtocolEncoder
+}
+
+// new varint frame encoder
+func NewVarintFrameEncoder() *VarintFrameEncoder {
+	handler := &VarintFrameEncoder{}
+	handler.SetBoundType(gonetio.OutBound)
+	handler.SetEncoder(handler)
+	return handler
+}
+
+func (this *VarintFrameEncoder) Encode(filter *gonetio.IoFilter, obj gonetio.BaseObject) gonetio.BaseObject {
+	input := obj.(*bytes.Buffer)
+
+	if uint64(input.Len()) > math.MaxUint32 {
+		encodeFailed(filter, fmt.Errorf("%w: frame length %d overflows 32 bits", ErrFrameTooLarge, input.Len()))
+		return nil
+	}
+
+	var lengthField [binary.MaxVarintLen64]byte
+	lengthFieldSize := binary.PutUvarint(lengthField[:], uint64(input.Len()))
+
+	totalBuffer := this.NewFrameBuffer(filter, lengthFieldSize+input.Len())
+	totalBuffer.Write(lengthField[:lengthFieldSize])
+	totalBuffer.Write(input.Bytes())
+
+	return totalBuffer
+}
+
+// Clone
+func (this *VarintFrameEncoder) Clone() gonetio.IoHandler {
+	return NewVarintFrameEncoder()
+}
@@ -0,0 +1,33 @@
+// File VarintFrameEncoder test
+
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVarintFrameEncoder(t *testing.T) {
+	tests := []struct {
+		message string
+		length  []byte
+	}{
+		{"", []byte{0}},
+		{"a", []byte{1}},
+		{strings.Repeat("x", 127), []byte{0x7f}},
+		{strings.Repeat("x", 128), []byte{0x80, 0x01}},
+		{strings.Repeat("x", 300), []byte{0xac, 0x02}},
+		{strings.Repeat("x", 1<<14), []byte{0x80, 0x80, 0x01}},
+	}
+
+	for _, test := range tests {
+		data := encodeFrames(t, NewVarintFrameEncoder(), test.message)
+		if !bytes.Equal(data, append(append([]byte{}, test.length...), test.message...)) {
+			t.Fatalf("message of %d bytes encoded to the length % x", len(test.message), data[:len(test.length)])
+		}
+
+		collector := decodeChunks(NewVarintFrameDecoder(1<<14), splitEvery(data, 1)...)
+		checkDecoded(t, "round trip", collector, []string{test.message}, nil)
+	}
+}
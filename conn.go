@@ -6,7 +6,10 @@ package gonetio
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
 	"net"
 	"runtime/debug"
 	"sync"
@@ -31,63 +34,111 @@ const (
 )
 
 type Tcpcon struct {
-	condID           uint32             // connection id
-	rawConn          *net.TCPConn       // the raw connection
-	keepAliveMinTime int                // in seconds, the min time between two package read from remote, valid only when the value is positive
-	customData       interface{}        // save the user custom data
-	remoteAddr       string             // the remote addr
-	fullBuffer       *bytes.Buffer      // full recv buffer
-	recvBuffer       []byte             // recv buffer
-	packetSendChan   chan *bytes.Buffer // packet send channel
-	conState         ConState           // the connection state
-	closeOnce        sync.Once          // make sure the connection call close just once
-	closeChan        chan struct{}      // close signal to the read/write loop
-	shutdownFlag     int32              // shutdown flag
-	ioFilterChain    *IoFilterChain     // filter chain
-	waitGroup        *sync.WaitGroup    // wait group
-	globalExitChan   chan struct{}      // global exit chan
+	condID            uint32                     // connection id
+	rawConn           net.Conn                   // the raw connection
+	keepAliveMinTime  int                        // in seconds, the min time between two package read from remote, valid only when the value is positive
+	customData        interface{}                // save the user custom data
+	remoteAddr        string                     // the remote addr
+	fullBuffer        *bytes.Buffer              // full recv buffer
+	writeBuffers      map[*bytes.Buffer]struct{} // the pooled buffers being written through the chain
+	writeBufferMtx    *sync.Mutex                // guard the write buffers
+	writeBatch        writeBatchConfig           // the write coalescing config
+	sendQueue         sendQueueConfig            // the overflow policy and the watermarks
+	queuedBytes       int64                      // the bytes waiting in the send queue
+	unwritable        int32                      // the queued bytes reached the high watermark
+	writabilityChecks int32                      // the writability checks pending
+	batch             []sendPacket               // the packets of the batch writing, reused by the write loop
+	batchBuffers      net.Buffers                // the data of the batch writing, reused by the write loop
+	packetSendChan    chan sendPacket            // packet send channel
+	sendMtx           *sync.RWMutex              // the senders read lock it, the close write locks it to close the send queue
+	conState          ConState                   // the connection state
+	closeOnce         sync.Once                  // make sure the connection call close just once
+	closeChan         chan struct{}              // close signal to the read/write loop
+	drainOnce         sync.Once                  // make sure the connection drain just once
+	flushCloseOnce    sync.Once                  // make sure the drain signal sent just once
+	drainChan         chan struct{}              // drain signal to the write loop
+	shutdownFlag      int32                      // shutdown flag
+	ioFilterChain     *IoFilterChain             // filter chain
+	waitGroup         *sync.WaitGroup            // wait group
+	globalExitChan    chan struct{}              // global exit chan
+	closeCallback     func(*Tcpcon)              // called after the connection closed
+	closeListeners    []func(*Tcpcon)            // called once the connection closed, by ShutDown too
+	closeListenerMtx  *sync.Mutex                // guard the close listeners
+	datagramMode      bool                       // each read is a whole datagram, never merged with the others
+	metrics           *metrics                   // the counters
+	closeReason       atomic.Value               // the reason the connection closed
+	parentLogger      FieldLogger                // the logger of the acceptor or connector
+	logger            FieldLogger                // the child logger with the conID and the remote addr attached
+	loggerMtx         *sync.RWMutex              // guard the remote addr and the loggers, the connector may start the connection published
+}
+
+// the packet in the send queue
+type sendPacket struct {
+	buffer *bytes.Buffer // the data to write
+	pooled bool          // release the buffer to the pool after written
+	size   int           // the bytes counted in the queued bytes
+	future *WriteFuture  // the future of the write, nil if not wanted
 }
 
 // new a connection instance from tcp acceptor
-func newConn(conn *net.TCPConn, aptor *TcpAcceptor) *Tcpcon {
+func newConn(conn net.Conn, aptor *TcpAcceptor) *Tcpcon {
 	con := NewConnFull(conn, aptor.config.connSendChanSizeLimit, aptor.waitGroup, aptor.config.keepAliveMinTime)
 	con.setGlobalExitChan(aptor.exitChan)
+	con.setParentMetrics(aptor.metrics)
+	con.SetLogger(aptor.logger)
+	con.writeBatch = aptor.config.writeBatch
+	con.sendQueue = aptor.config.sendQueue
 	return con
 }
 
 // new a connection instance
-func NewConn(conn *net.TCPConn, sendQueueSize int, wg *sync.WaitGroup, keepAliveMinTimeDuration int) *Tcpcon {
+func NewConn(conn net.Conn, sendQueueSize int, wg *sync.WaitGroup, keepAliveMinTimeDuration int) *Tcpcon {
 	return NewConnFull(conn, sendQueueSize, wg, keepAliveMinTimeDuration)
 }
 
 // new a connection instance
-func NewConnFull(conn *net.TCPConn, sendQueueSize int, wg *sync.WaitGroup, keepAliveMinTimeDuration int) *Tcpcon {
+// the conn can be any stream oriented net.Conn, like *net.TCPConn, *net.UnixConn, *tls.Conn or net.Pipe
+func NewConnFull(conn net.Conn, sendQueueSize int, wg *sync.WaitGroup, keepAliveMinTimeDuration int) *Tcpcon {
 
 	var addr string = ""
 	if conn != nil {
 		addr = conn.RemoteAddr().String()
 	}
 
-	return &Tcpcon{
+	con := &Tcpcon{
 		condID:           0,
 		rawConn:          conn,
 		keepAliveMinTime: keepAliveMinTimeDuration,
 		remoteAddr:       addr,
 		fullBuffer:       bytes.NewBuffer([]byte{}),
-		recvBuffer:       make([]byte, 65535),
-		packetSendChan:   make(chan *bytes.Buffer, sendQueueSize),
+		writeBuffers:     make(map[*bytes.Buffer]struct{}),
+		writeBufferMtx:   &sync.Mutex{},
+		writeBatch:       defaultWriteBatchConfig(),
+		sendQueue:        defaultSendQueueConfig(),
+		packetSendChan:   make(chan sendPacket, sendQueueSize),
+		sendMtx:          &sync.RWMutex{},
 		conState:         ConStateClosed,
 		shutdownFlag:     0,
 		closeChan:        make(chan struct{}),
+		drainChan:        make(chan struct{}),
 		ioFilterChain:    nil,
 		waitGroup:        wg,
 		globalExitChan:   make(chan struct{}),
+		metrics:          newMetrics(),
+		loggerMtx:        &sync.RWMutex{},
+		closeListenerMtx: &sync.Mutex{},
 	}
+	con.SetLogger(DefaultLogger())
+	return con
 }
 
 // set conid
 func (this *Tcpcon) SetConID(id uint32) {
+	this.loggerMtx.Lock()
+	defer this.loggerMtx.Unlock()
+
 	this.condID = id
+	this.updateLogger()
 }
 
 // get conid
@@ -95,6 +146,28 @@ func (this *Tcpcon) GetConID() uint32 {
 	return this.condID
 }
 
+// set the logger, the connection logs to a child of it with the conID and the remote addr attached
+func (this *Tcpcon) SetLogger(logger FieldLogger) {
+	this.loggerMtx.Lock()
+	defer this.loggerMtx.Unlock()
+
+	this.parentLogger = logger
+	this.updateLogger()
+}
+
+// get the logger with the conID and the remote addr attached
+func (this *Tcpcon) Logger() FieldLogger {
+	this.loggerMtx.RLock()
+	defer this.loggerMtx.RUnlock()
+
+	return this.logger
+}
+
+// rebuild the child logger, the loggerMtx must be held
+func (this *Tcpcon) updateLogger() {
+	this.logger = this.parentLogger.With("conID", this.condID, "remote", this.remoteAddr)
+}
+
 // set iofilter chain
 func (this *Tcpcon) SetIoFilterChain(chain *IoFilterChain) {
 	this.ioFilterChain = chain
@@ -113,6 +186,72 @@ func (this *Tcpcon) setGlobalExitChan(gexitchan chan struct{}) {
 	this.globalExitChan = gexitchan
 }
 
+// set the callback called after the connection closed
+func (this *Tcpcon) setCloseCallback(cb func(*Tcpcon)) {
+	this.closeCallback = cb
+}
+
+// add the listener called once the connection closed, it's called at once if closed already
+// unlike ConnClosed, it's called when the connection shut down too,
+// so the handlers release the resources of the connection in it
+func (this *Tcpcon) AddCloseListener(listener func(*Tcpcon)) {
+	this.closeListenerMtx.Lock()
+	select {
+	case <-this.closeChan:
+		this.closeListenerMtx.Unlock()
+		listener(this)
+	default:
+		this.closeListeners = append(this.closeListeners, listener)
+		this.closeListenerMtx.Unlock()
+	}
+}
+
+// call the close listeners
+func (this *Tcpcon) fireCloseListeners() {
+	this.closeListenerMtx.Lock()
+	listeners := this.closeListeners
+	this.closeListeners = nil
+	this.closeListenerMtx.Unlock()
+
+	for _, listener := range listeners {
+		listener(this)
+	}
+}
+
+// get the raw connection
+func (this *Tcpcon) GetRawConn() net.Conn {
+	return this.rawConn
+}
+
+// set the parent metrics, the counters of the connection add to it too
+func (this *Tcpcon) setParentMetrics(parent *metrics) {
+	this.metrics.parent = parent
+}
+
+// get the stats snapshot of the connection
+func (this *Tcpcon) Stats() ConnStats {
+	stats := this.metrics.connStats()
+	stats.SendQueueDepth = this.SendQueueDepth()
+	stats.SendQueueBytes = this.SendQueueBytes()
+	return stats
+}
+
+// get the packets waiting in the send queue
+func (this *Tcpcon) SendQueueDepth() int {
+	return len(this.packetSendChan)
+}
+
+// get the reason the connection closed, "" if not closed
+func (this *Tcpcon) CloseReason() CloseReason {
+	reason, _ := this.closeReason.Load().(CloseReason)
+	return reason
+}
+
+// set datagram mode
+func (this *Tcpcon) setDatagramMode(datagram bool) {
+	this.datagramMode = datagram
+}
+
 // set custom data
 func (this *Tcpcon) SetCustomData(data interface{}) {
 	this.customData = data
@@ -125,17 +264,78 @@ func (this *Tcpcon) GetCustomData() interface{} {
 
 // set remote addr
 func (this *Tcpcon) SetRemoteAddr(addr string) {
+	this.loggerMtx.Lock()
+	defer this.loggerMtx.Unlock()
+
 	this.remoteAddr = addr
+	this.updateLogger()
 }
 
 // get remote addr
 func (this *Tcpcon) RemoteAddr() string {
+	this.loggerMtx.RLock()
+	defer this.loggerMtx.RUnlock()
+
 	return this.remoteAddr
 }
 
+// get the tls connection state
+// return false if the connection is not over tls
+func (this *Tcpcon) TLSConnectionState() (tls.ConnectionState, bool) {
+	if tlsConn, ok := this.rawConn.(*tls.Conn); ok {
+		return tlsConn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// get the certificates presented by the peer
+// return nil if the connection is not over tls or the peer presented none
+func (this *Tcpcon) PeerCertificates() []*x509.Certificate {
+	state, ok := this.TLSConnectionState()
+	if !ok {
+		return nil
+	}
+	return state.PeerCertificates
+}
+
+// get the application protocol negotiated by alpn
+// return "" if the connection is not over tls or nothing negotiated
+func (this *Tcpcon) NegotiatedProtocol() string {
+	state, ok := this.TLSConnectionState()
+	if !ok {
+		return ""
+	}
+	return state.NegotiatedProtocol
+}
+
+// do the tls handshake if the connection is over tls
+func (this *Tcpcon) handshake(timeout time.Duration) error {
+	tlsConn, ok := this.rawConn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	if timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		defer tlsConn.SetDeadline(time.Time{})
+	}
+
+	return tlsConn.Handshake()
+}
+
 // is connection opened
 func (this *Tcpcon) IsConnected() bool {
-	return this.conState == ConStateOpened
+	return this.getConState() == ConStateOpened
+}
+
+// get the connection state
+func (this *Tcpcon) getConState() ConState {
+	return ConState(atomic.LoadInt32((*int32)(&this.conState)))
+}
+
+// set the connection state
+func (this *Tcpcon) setConState(state ConState) {
+	atomic.StoreInt32((*int32)(&this.conState), int32(state))
 }
 
 // is closed
@@ -146,57 +346,107 @@ func (this *Tcpcon) IsShutdown() bool {
 // shutdown the connection
 func (this *Tcpcon) ShutDown() {
 	if atomic.SwapInt32(&this.shutdownFlag, 1) == 0 {
-		LogError("Tcpcon ShutDown, url[%s].", this.remoteAddr)
-		this.Close()
+		this.Logger().Log(LvlError, "connection shutdown")
+		this.closeWithReason(CloseReasonShutdown)
 	}
 }
 
 // close the connection
 func (this *Tcpcon) Close() {
+	this.closeWithReason(CloseReasonLocal)
+}
+
+// close the connection, the reason of the first close is kept
+func (this *Tcpcon) closeWithReason(reason CloseReason) {
 	this.closeOnce.Do(func() {
-		this.conState = ConStateClosed
+		this.closeReason.Store(reason)
+		if this.getConState() == ConStateOpened {
+			this.metrics.connClosed(reason)
+		}
+		this.setConState(ConStateClosed)
 		close(this.closeChan)
+
+		// the senders blocking wake up by the close chan, so the lock is got soon
+		this.sendMtx.Lock()
 		close(this.packetSendChan)
-		this.rawConn.Close()
+		this.sendMtx.Unlock()
+		if this.rawConn != nil {
+			this.rawConn.Close()
+		}
 
 		if !this.IsShutdown() {
 			this.ioFilterChain.FireConnClosed()
 		}
+		this.fireCloseListeners()
+
+		if this.closeCallback != nil {
+			this.closeCallback(this)
+		}
 	})
 }
 
-// add to the send queue
-func (this *Tcpcon) Flush(buffer *bytes.Buffer, timeout time.Duration) (err error) {
-	if this.IsShutdown() {
-		return ErrConnShutdown
-	}
-
-	defer func() {
-		if e := recover(); e != nil {
-			err = ErrConnException
+// close the connection gracefully
+// fire the closing event, then close after the send queue is flushed
+func (this *Tcpcon) drain() {
+	this.drainOnce.Do(func() {
+		if this.IsConnected() && !this.IsShutdown() {
+			this.ioFilterChain.FireConnClosing()
 		}
-	}()
+		this.FlushAndClose()
+	})
+}
 
-	if timeout == 0 {
-		select {
-		case this.packetSendChan <- buffer:
-			return nil
+// close the connection after the packets already in the send queue are written
+func (this *Tcpcon) FlushAndClose() {
+	this.flushCloseOnce.Do(func() {
+		close(this.drainChan)
+	})
+}
 
-		default:
-			return ErrWriteBlocking
-		}
-	} else {
-		select {
-		case this.packetSendChan <- buffer:
-			return nil
-		case <-this.closeChan:
-			return ErrConnClosed
-		case <-time.After(timeout):
-			return ErrWriteBlocking
-		}
+// get the channel closed when the connection closed,
+// it's closed by ShutDown too, which fires no ConnClosed, see AddCloseListener
+func (this *Tcpcon) Done() <-chan struct{} {
+	return this.closeChan
+}
+
+// is the connection closed
+func (this *Tcpcon) isDone() bool {
+	select {
+	case <-this.closeChan:
+		return true
+	default:
+		return false
 	}
 }
 
+// add to the send queue
+// timeout 0 drops the packet if the queue is full, or wait for the room up to the timeout
+func (this *Tcpcon) Flush(buffer *bytes.Buffer, timeout time.Duration) error {
+	if timeout <= 0 {
+		return this.enqueue(sendPacket{buffer: buffer}, OverflowDropNewest, 0)
+	}
+	return this.enqueue(sendPacket{buffer: buffer}, OverflowBlock, timeout)
+}
+
+// add the buffer got from NewWriteBuffer to the send queue by the overflow policy,
+// it's released to the pool after written
+// the buffer is still released by ReleaseWriteBuffer if the send queue refuses it
+func (this *Tcpcon) flushWriteBuffer(buffer *bytes.Buffer, future *WriteFuture) error {
+	// the write loop may release it once it's queued, so take it out first
+	this.writeBufferMtx.Lock()
+	_, pooled := this.writeBuffers[buffer]
+	delete(this.writeBuffers, buffer)
+	this.writeBufferMtx.Unlock()
+
+	err := this.enqueue(sendPacket{buffer: buffer, pooled: pooled, future: future}, this.sendQueue.overflow, this.sendQueue.blockTimeout)
+	if err != nil && pooled {
+		this.writeBufferMtx.Lock()
+		this.writeBuffers[buffer] = struct{}{}
+		this.writeBufferMtx.Unlock()
+	}
+	return err
+}
+
 // connection start
 func (this *Tcpcon) Start() {
 	if this.IsShutdown() {
@@ -207,7 +457,8 @@ func (this *Tcpcon) Start() {
 		this.SetRemoteAddr(this.rawConn.RemoteAddr().String())
 	}
 
-	this.conState = ConStateOpened
+	this.setConState(ConStateOpened)
+	this.metrics.connOpened()
 	this.ioFilterChain.FireConnOpened()
 
 	// start the read/write/handle loop
@@ -232,7 +483,57 @@ func (this *Tcpcon) Write(obj BaseObject) {
 	if this.ioFilterChain != nil {
 		this.ioFilterChain.FireWrite(obj)
 	} else {
-		LogError("Tcpcon Write, but io filter chain is nil, write failed.")
+		this.Logger().Log(LvlError, "write failed, io filter chain is nil")
+	}
+}
+
+// write and return the error known when the message left the chain,
+// like the encode failure, the connection closed or the send queue overflow
+// nil doesn't mean written, use SendAsync to wait for it
+func (this *Tcpcon) Send(obj BaseObject) error {
+	future := this.SendAsync(obj)
+	select {
+	case <-future.Done():
+		return future.Err()
+	default:
+		return nil
+	}
+}
+
+// write with a future completes when the message is written to the raw connection,
+// or fails with the error
+func (this *Tcpcon) SendAsync(obj BaseObject) *WriteFuture {
+	if this.ioFilterChain == nil {
+		return newFailedWriteFuture(ErrWriteNotQueued)
+	}
+	return this.ioFilterChain.FireWriteAsync(obj)
+}
+
+// get an empty buffer for the out bound message, it's a pooled one if the chain uses the pooled buffers
+// the write loop releases it after written if the head filter adds it to the send queue,
+// otherwise the caller releases it by ReleaseWriteBuffer after the FireWrite returned.
+func (this *Tcpcon) NewWriteBuffer(size int) *bytes.Buffer {
+	if this.ioFilterChain == nil || !this.ioFilterChain.IsPooledBuffers() {
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+
+	buffer := GetBuffer(size)
+	this.writeBufferMtx.Lock()
+	this.writeBuffers[buffer] = struct{}{}
+	this.writeBufferMtx.Unlock()
+	return buffer
+}
+
+// release the buffer got from NewWriteBuffer to the pool unless it's in the send queue,
+// the other buffers are ignored
+func (this *Tcpcon) ReleaseWriteBuffer(buffer *bytes.Buffer) {
+	this.writeBufferMtx.Lock()
+	_, ok := this.writeBuffers[buffer]
+	delete(this.writeBuffers, buffer)
+	this.writeBufferMtx.Unlock()
+
+	if ok {
+		PutBuffer(buffer)
 	}
 }
 
@@ -247,22 +548,28 @@ func asyncDo(fn func(), wg *sync.WaitGroup) {
 
 // read loop
 func (this *Tcpcon) readLoop() {
+	reason := CloseReasonLocal
 	defer func() {
 		if p := recover(); p != nil {
-			LogError("panic recover, p: %v", p)
-			LogError("stack: %s", debug.Stack())
+			this.Logger().Log(LvlError, "panic recover", "panic", p, "stack", string(debug.Stack()))
 		}
 
-		this.Close()
+		this.closeWithReason(reason)
 
-		LogInfo("connection[%s] readloop exit.", this.remoteAddr)
+		this.Logger().Log(LvlInfo, "read loop exit", "reason", reason)
 	}()
 
-	LogInfo("connection[%s] readloop start.", this.remoteAddr)
+	this.Logger().Log(LvlInfo, "read loop start")
+
+	// the recv buffer is hold by the read loop only, back to the pool when it exits
+	pooledBuffer := GetBuffer(recvBufferSize)
+	defer PutBuffer(pooledBuffer)
+	recvBuffer := pooledBuffer.AvailableBuffer()[:recvBufferSize]
 
 	for {
 		select {
 		case <-this.globalExitChan:
+			reason = CloseReasonStopped
 			return
 		case <-this.closeChan:
 			return
@@ -271,61 +578,120 @@ func (this *Tcpcon) readLoop() {
 		}
 
 		this.setReadDeadline()
-		readLen, err := this.read(this.recvBuffer)
+		readLen, err := this.read(recvBuffer)
 		if err != nil {
-			LogError("connection[%s] read data error, error:%s.", this.remoteAddr, err.Error())
+			this.Logger().Log(LvlError, "read data error", "err", err)
+			reason = readErrorReason(err)
 			return
 		}
 
+		if readLen == 0 && this.datagramMode {
+			continue
+		}
+
 		if readLen == 0 {
-			LogError("connection[%s] read data error, read data len is 0, connection may closed.", this.remoteAddr)
+			this.Logger().Log(LvlError, "read data len is 0, connection may closed")
+			reason = CloseReasonRemote
 			return
 		}
 
+		this.metrics.addBytesRead(readLen)
+
 		if this.IsShutdown() {
 			return
 		}
 
-		this.fullBuffer.Write(this.recvBuffer[:readLen])
+		this.fullBuffer.Write(recvBuffer[:readLen])
 
 		if !this.IsShutdown() {
 			this.ioFilterChain.FireMessageReceived(this.fullBuffer)
 		}
+
+		// the bytes left by the decoders must not merge with the next datagram
+		if this.datagramMode {
+			this.fullBuffer.Reset()
+		}
+	}
+}
+
+// get the close reason of the read error
+func readErrorReason(err error) CloseReason {
+	if err == io.EOF {
+		return CloseReasonRemote
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return CloseReasonIdleTimeout
 	}
+
+	return CloseReasonReadError
 }
 
 // write loop
 func (this *Tcpcon) writeLoop() {
-
+	reason := CloseReasonLocal
 	defer func() {
 		if p := recover(); p != nil {
-			LogError("panic recover, p: %v", p)
-			LogError("stack: %s", debug.Stack())
+			this.Logger().Log(LvlError, "panic recover", "panic", p, "stack", string(debug.Stack()))
 		}
 
-		this.Close()
+		this.closeWithReason(reason)
+		this.discardSendQueue()
 
-		LogError("connection[%s] write loop exit.", this.remoteAddr)
+		this.Logger().Log(LvlInfo, "write loop exit", "reason", reason)
 	}()
 
-	LogInfo("connection[%s] write loop start.", this.remoteAddr)
+	this.Logger().Log(LvlInfo, "write loop start")
 	for {
 		select {
 		case <-this.globalExitChan:
+			reason = CloseReasonStopped
 			return
 		case <-this.closeChan:
 			return
 		case p := <-this.packetSendChan:
-			if p == nil {
+			if p.buffer == nil {
 				return
 			}
 			if this.IsShutdown() {
+				this.discardPacket(p, ErrConnShutdown)
 				return
 			}
-			if _, err := this.rawConn.Write(p.Bytes()); err != nil {
+			if !this.writeBatchFrom(p) {
+				reason = CloseReasonWriteError
 				return
 			}
+		case <-this.drainChan:
+			reason = CloseReasonDrained
+			if !this.flushSendQueue() {
+				reason = CloseReasonWriteError
+			}
+			return
 		}
 	}
 
 }
+
+// write the packet to the raw connection
+func (this *Tcpcon) writePacket(p sendPacket) error {
+	n, err := this.rawConn.Write(p.buffer.Bytes())
+	this.metrics.addBytesWritten(n)
+	return err
+}
+
+// write all the packets in the send queue, return false if write failed
+func (this *Tcpcon) flushSendQueue() bool {
+	for {
+		select {
+		case p := <-this.packetSendChan:
+			if p.buffer == nil {
+				return true
+			}
+			if !this.writeBatchFrom(p) {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
@@ -5,9 +5,15 @@
 package gonetio
 
 import (
+	"errors"
 	"sync"
 )
 
+// error type
+var (
+	ErrConnNotFound = errors.New("Connection not found in the pool")
+)
+
 type TcpconnectionPool struct {
 	/* <conid, *Tcpcon */
 	connection_map map[uint32]*Tcpcon //connection map
@@ -33,8 +39,7 @@ func (this *TcpconnectionPool) AddCon(con *Tcpcon) uint32 {
 
 	this.connection_map[con.GetConID()] = con
 
-	LogDebug("TcpconnectionPool add con[%d] addr[%s], cur pool size[%d]",
-		con.GetConID(), con.RemoteAddr(), len(this.connection_map))
+	con.Logger().Log(LvlDebug, "TcpconnectionPool add con", "poolSize", len(this.connection_map))
 
 	return con.GetConID()
 }
@@ -49,21 +54,34 @@ func (this *TcpconnectionPool) RemoveCon(con *Tcpcon) {
 
 	delete(this.connection_map, con.GetConID())
 
-	LogDebug("TcpconnectionPool remove con[%d] addr[%s], remain pool size[%d]",
-		con.GetConID(), con.RemoteAddr(), len(this.connection_map))
+	con.Logger().Log(LvlDebug, "TcpconnectionPool remove con", "poolSize", len(this.connection_map))
 }
 
-func (this *TcpconnectionPool) Send(con_id uint32, obj BaseObject) {
+// write to the connection, return the error known when the message left the chain, see Tcpcon.Send
+func (this *TcpconnectionPool) Send(con_id uint32, obj BaseObject) error {
 	this.map_mtx.RLock()
 	defer this.map_mtx.RUnlock()
 
 	con := this.connection_map[con_id]
 	if con == nil {
-		LogWarn("TcpconnectionPool can't find con of con_id[%d] try send msg failed.", con_id)
-		return
+		DefaultLogger().Log(LvlWarn, "TcpconnectionPool send failed, con not found", "conID", con_id)
+		return ErrConnNotFound
 	}
 
-	con.Write(obj)
+	return con.Send(obj)
+}
+
+// write to the connection with a future, see Tcpcon.SendAsync
+func (this *TcpconnectionPool) SendAsync(con_id uint32, obj BaseObject) *WriteFuture {
+	this.map_mtx.RLock()
+	defer this.map_mtx.RUnlock()
+
+	con := this.connection_map[con_id]
+	if con == nil {
+		return newFailedWriteFuture(ErrConnNotFound)
+	}
+
+	return con.SendAsync(obj)
 }
 
 func (this *TcpconnectionPool) Broadcast(obj BaseObject) {
@@ -103,6 +121,17 @@ func (this *TcpconnectionPool) RemoteAddr(con_id uint32) string {
 	return ""
 }
 
+func (this *TcpconnectionPool) snapshot() []*Tcpcon {
+	this.map_mtx.RLock()
+	defer this.map_mtx.RUnlock()
+
+	cons := make([]*Tcpcon, 0, len(this.connection_map))
+	for _, con := range this.connection_map {
+		cons = append(cons, con)
+	}
+	return cons
+}
+
 func (this *TcpconnectionPool) get_con(con_id uint32) *Tcpcon {
 	return this.connection_map[con_id]
 }
@@ -0,0 +1,49 @@
+// File Tcpcon test
+
+package gonetio
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// the close listeners are called once, by Close and ShutDown both
+func TestCloseListener(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(*Tcpcon)
+	}{
+		{"close", (*Tcpcon).Close},
+		{"shutdown", (*Tcpcon).ShutDown},
+	}
+
+	for _, test := range tests {
+		local, remote := net.Pipe()
+		con := NewConnFull(local, 16, &sync.WaitGroup{}, 0)
+		con.SetIoFilterChain(NewIoFilterChain(con))
+		con.Start()
+
+		calls := 0
+		con.AddCloseListener(func(closed *Tcpcon) {
+			if closed != con {
+				t.Fatalf("%s: the listener called with another connection", test.name)
+			}
+			calls++
+		})
+
+		test.close(con)
+		test.close(con)
+		if calls != 1 {
+			t.Fatalf("%s: the listener called %d times, expect once", test.name, calls)
+		}
+
+		// added after closed, called at once
+		late := false
+		con.AddCloseListener(func(*Tcpcon) { late = true })
+		if !late {
+			t.Fatalf("%s: the listener added after closed is not called", test.name)
+		}
+		remote.Close()
+	}
+}
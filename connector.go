@@ -5,63 +5,278 @@
 package gonetio
 
 import (
+	"crypto/tls"
+	"errors"
+	"math"
+	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// error type
+var (
+	ErrNotConnected = errors.New("Connector is not connected")
+)
+
+// dial function, the same shape as net.Dial
+type DialFunc func(network string, address string) (net.Conn, error)
+
 type ConnectorConfig struct {
-	sendQueueSize    int            // send queue size
-	keepAliveMinTime int            // in seconds, the min time between two package read from remote, valid only when the value is positive
-	filterChain      *IoFilterChain // filter chain
+	sendQueueSize       int              // send queue size
+	keepAliveMinTime    int              // in seconds, the min time between two package read from remote, valid only when the value is positive
+	filterChain         *IoFilterChain   // filter chain
+	tlsConfig           *tls.Config      // connect over tls when not nil
+	tlsHandshakeTimeout time.Duration    // tls handshake timeout, no timeout when not positive
+	dialer              DialFunc         // custom dial function, dial tcp directly when nil
+	network             string           // the network to dial, "tcp", "unix" or "udp"
+	datagram            bool             // each read is a whole datagram
+	writeBatch          writeBatchConfig // the write coalescing config
+	sendQueue           sendQueueConfig  // the overflow policy and the watermarks
+	cloneFilterChain    bool             // each connection gets its own clone of the filter chain
+}
+
+// reconnect policy
+// the delay before the nth attempt is initialDelay * multiplier^(n-1), limited by maxDelay,
+// then randomized by +/- jitter of itself
+type ReconnectPolicy struct {
+	initialDelay time.Duration // the delay before the first attempt
+	maxDelay     time.Duration // the max delay between two attempts, unlimited when not positive
+	multiplier   float64       // the delay multiplier of each attempt
+	jitter       float64       // in [0, 1], the random factor of the delay
+	maxAttempts  int           // give up after the attempts, unlimited when not positive
+}
+
+// new reconnect policy
+func NewReconnectPolicy(initialDelay time.Duration, maxDelay time.Duration, multiplier float64, jitter float64, maxAttempts int) *ReconnectPolicy {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+
+	return &ReconnectPolicy{
+		initialDelay: initialDelay,
+		maxDelay:     maxDelay,
+		multiplier:   multiplier,
+		jitter:       jitter,
+		maxAttempts:  maxAttempts,
+	}
+}
+
+// the delay before the attempt, attempt starts from 1
+func (this *ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := float64(this.initialDelay) * math.Pow(this.multiplier, float64(attempt-1))
+	if this.maxDelay > 0 && delay > float64(this.maxDelay) {
+		delay = float64(this.maxDelay)
+	}
+
+	if this.jitter > 0 {
+		delay += delay * this.jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// is the attempt exceed the max attempts
+func (this *ReconnectPolicy) exceed(attempt int) bool {
+	return this.maxAttempts > 0 && attempt > this.maxAttempts
+}
+
+// the handlers of the connector filter chain can implement it to observe the reconnecting
+type ReconnectListener interface {
+	// the event fired when a reconnect attempt is scheduled after delay
+	Reconnecting(connector *TcpConnector, attempt int, delay time.Duration)
+
+	// the event fired when the connection is established again after attempts
+	Reconnected(connector *TcpConnector, attempt int)
+
+	// the event fired when the connector gives up after the max attempts
+	GaveUp(connector *TcpConnector, attempts int)
 }
 
 type TcpConnector struct {
-	conn        *Tcpcon          // raw connection
-	connName    string           // connection name
-	url         string           // connection url
-	waitGroup   *sync.WaitGroup  // wait group
-	config      *ConnectorConfig // config
-	filterChain *IoFilterChain   // filter chain
+	conn              *Tcpcon          // raw connection
+	connMtx           *sync.RWMutex    // guard the conn, it's replaced by each connect
+	connName          string           // connection name
+	url               string           // connection url, guarded by the reconnectMtx
+	waitGroup         *sync.WaitGroup  // wait group
+	config            *ConnectorConfig // config
+	filterChain       *IoFilterChain   // filter chain
+	stopFlag          int32            // stop flag
+	reconnectPolicy   *ReconnectPolicy // reconnect policy, no auto reconnect when nil
+	reconnectAttempts int              // the reconnect attempts since last connected
+	reconnectTimer    *time.Timer      // the timer of the scheduled reconnect
+	reconnectMtx      *sync.Mutex      // guard the reconnect state and the url
+	metrics           *metrics         // the counters of all the connections
+	logger            FieldLogger      // the logger with the connector name attached
 }
 
 // new a connctor instance
 func NewConnector(name string, maxSendQueueSize int, keepAliveTimeDuration int) *TcpConnector {
 	wg := &sync.WaitGroup{}
 	conf := &ConnectorConfig{
-		sendQueueSize:    maxSendQueueSize,
-		keepAliveMinTime: keepAliveTimeDuration,
-		filterChain:      NewIoFilterChain(nil),
+		sendQueueSize:       maxSendQueueSize,
+		keepAliveMinTime:    keepAliveTimeDuration,
+		filterChain:         NewIoFilterChain(nil),
+		tlsConfig:           nil,
+		tlsHandshakeTimeout: DefaultTLSHandshakeTimeout,
+		network:             "tcp",
+		writeBatch:          defaultWriteBatchConfig(),
+		sendQueue:           defaultSendQueueConfig(),
 	}
 
 	return &TcpConnector{
-		conn:        nil,
-		connName:    name,
-		url:         "",
-		waitGroup:   wg,
-		config:      conf,
-		filterChain: conf.filterChain,
+		conn:         nil,
+		connMtx:      &sync.RWMutex{},
+		connName:     name,
+		url:          "",
+		waitGroup:    wg,
+		config:       conf,
+		filterChain:  conf.filterChain,
+		stopFlag:     0,
+		reconnectMtx: &sync.Mutex{},
+		metrics:      newMetrics(),
+		logger:       DefaultLogger().With("connector", name),
 	}
 }
 
+// set the logger, the connector name is attached to it
+// the connections log to its child with the conID and the remote addr attached
+func (this *TcpConnector) SetLogger(logger FieldLogger) {
+	this.logger = logger.With("connector", this.connName)
+}
+
+// get the logger
+func (this *TcpConnector) GetLogger() FieldLogger {
+	return this.logger
+}
+
+// get the stats snapshot of the connector, the accepts are the connects
+func (this *TcpConnector) Stats() Stats {
+	return this.metrics.stats([]*Tcpcon{this.GetCon()})
+}
+
+// new a unix socket connctor instance
+// the url passed to AsyncConnect is the unix socket path
+func NewUnixConnector(name string, maxSendQueueSize int, keepAliveTimeDuration int) *TcpConnector {
+	connector := NewConnector(name, maxSendQueueSize, keepAliveTimeDuration)
+	connector.config.network = "unix"
+	return connector
+}
+
+// new a udp connctor instance
+// each datagram received is fired as one message, the connection is closed
+// when nothing received for keepAliveTimeDuration seconds if it's positive
+func NewUdpConnector(name string, maxSendQueueSize int, keepAliveTimeDuration int) *TcpConnector {
+	connector := NewConnector(name, maxSendQueueSize, keepAliveTimeDuration)
+	connector.config.network = "udp"
+	connector.config.datagram = true
+	return connector
+}
+
+// get the connector name
+func (this *TcpConnector) GetName() string {
+	return this.connName
+}
+
+// get the url connect to
+func (this *TcpConnector) GetUrl() string {
+	this.reconnectMtx.Lock()
+	defer this.reconnectMtx.Unlock()
+
+	return this.url
+}
+
+// set the dial function used to connect instead of dialing tcp directly
+func (this *TcpConnector) SetDialer(dial DialFunc) {
+	this.config.dialer = dial
+}
+
+// set the tls config, the connector connects over tls when it's not nil
+// the server name is taken from the url when the config leaves it empty
+func (this *TcpConnector) SetTLSConfig(config *tls.Config) {
+	this.config.tlsConfig = config
+}
+
+// set the tls handshake timeout
+func (this *TcpConnector) SetTLSHandshakeTimeout(timeout time.Duration) {
+	this.config.tlsHandshakeTimeout = timeout
+}
+
+// set the reconnect policy, reconnect automatically after connect failures
+// and remote closes, but not after Stop
+func (this *TcpConnector) SetReconnectPolicy(policy *ReconnectPolicy) {
+	this.reconnectMtx.Lock()
+	defer this.reconnectMtx.Unlock()
+
+	this.reconnectPolicy = policy
+}
+
 // get tcp
 func (this *TcpConnector) GetCon() *Tcpcon {
+	this.connMtx.RLock()
+	defer this.connMtx.RUnlock()
+
 	return this.conn
 }
 
+// set the connection of the connect attempt
+func (this *TcpConnector) setCon(con *Tcpcon) {
+	this.connMtx.Lock()
+	defer this.connMtx.Unlock()
+
+	this.conn = con
+}
+
 // write data
 func (this *TcpConnector) Write(obj BaseObject) bool {
-	if this.conn != nil && !this.conn.IsShutdown() {
-		this.conn.Write(obj)
+	con := this.GetCon()
+	if con != nil && !con.IsShutdown() {
+		con.Write(obj)
 		return true
 	}
 	return false
 }
 
+// write and return the error known when the message left the chain, see Tcpcon.Send
+func (this *TcpConnector) Send(obj BaseObject) error {
+	con := this.GetCon()
+	if con == nil || con.IsShutdown() {
+		return ErrNotConnected
+	}
+	return con.Send(obj)
+}
+
+// write with a future completes when the message is written, see Tcpcon.SendAsync
+func (this *TcpConnector) SendAsync(obj BaseObject) *WriteFuture {
+	con := this.GetCon()
+	if con == nil || con.IsShutdown() {
+		return newFailedWriteFuture(ErrNotConnected)
+	}
+	return con.SendAsync(obj)
+}
+
 // get iofilter chain
+// the connections use it directly, unless SetCloneFilterChain(true),
+// then it's the template, use GetCon().GetIoFilterChain() for the live one
 func (this *TcpConnector) GetIoFilterChain() *IoFilterChain {
 	return this.filterChain
 }
 
+// set whether each connection gets its own clone of the filter chain,
+// so the state the handlers keep for the dead connection, like a half decoded frame,
+// is not carried to the next one, the handlers must implement Clone then
+// the connections use the filter chain directly by default
+func (this *TcpConnector) SetCloneFilterChain(clone bool) {
+	this.config.cloneFilterChain = clone
+}
+
 // try connect
 func (this *TcpConnector) AsyncConnect(url string) {
 	if this.IsShutdown() {
@@ -80,41 +295,167 @@ func (this *TcpConnector) doConnectTask(url string) {
 	}()
 
 	if this.tryConnect(url) {
+		if this.IsShutdown() {
+			this.GetCon().ShutDown()
+			return
+		}
+
+		this.onConnected()
 		this.start()
 	} else {
 		if !this.IsShutdown() {
-			this.conn.ioFilterChain.FireConnClosed()
+			this.GetCon().ioFilterChain.FireConnClosed()
+		}
+		this.scheduleReconnect()
+	}
+}
+
+// reset the reconnect state after connected
+func (this *TcpConnector) onConnected() {
+	this.reconnectMtx.Lock()
+	attempt := this.reconnectAttempts
+	this.reconnectAttempts = 0
+	this.reconnectMtx.Unlock()
+
+	if attempt > 0 {
+		this.logger.Log(LvlInfo, "reconnected", "url", this.GetUrl(), "attempts", attempt)
+		this.notifyReconnect(func(listener ReconnectListener) {
+			listener.Reconnected(this, attempt)
+		})
+	}
+}
+
+// schedule a reconnect by the policy
+func (this *TcpConnector) scheduleReconnect() {
+	this.reconnectMtx.Lock()
+
+	if this.reconnectPolicy == nil || this.IsShutdown() {
+		this.reconnectMtx.Unlock()
+		return
+	}
+
+	this.reconnectAttempts += 1
+	attempt := this.reconnectAttempts
+
+	url := this.url
+	if this.reconnectPolicy.exceed(attempt) {
+		this.reconnectAttempts = 0
+		this.reconnectMtx.Unlock()
+
+		this.logger.Log(LvlError, "give up reconnecting", "url", url, "attempts", attempt-1)
+		this.notifyReconnect(func(listener ReconnectListener) {
+			listener.GaveUp(this, attempt-1)
+		})
+		return
+	}
+
+	delay := this.reconnectPolicy.delay(attempt)
+	this.reconnectTimer = time.AfterFunc(delay, func() {
+		this.AsyncConnect(url)
+	})
+	this.reconnectMtx.Unlock()
+
+	this.logger.Log(LvlInfo, "reconnect scheduled", "url", url, "delay", delay, "attempt", attempt)
+	this.notifyReconnect(func(listener ReconnectListener) {
+		listener.Reconnecting(this, attempt, delay)
+	})
+}
+
+// notify the reconnect listeners of the filter chain of the current connection,
+// so they are the same handlers seeing the connection events
+func (this *TcpConnector) notifyReconnect(fn func(ReconnectListener)) {
+	chain := this.filterChain
+	if con := this.GetCon(); con != nil && con.GetIoFilterChain() != nil {
+		chain = con.GetIoFilterChain()
+	}
+
+	for _, handler := range chain.handlers() {
+		if listener, ok := handler.(ReconnectListener); ok {
+			fn(listener)
 		}
 	}
 }
 
 // try connect to the server
 func (this *TcpConnector) tryConnect(url string) bool {
-	LogInfo("try connect to url[%s].", url)
+	this.logger.Log(LvlInfo, "try connect", "url", url)
 
+	this.reconnectMtx.Lock()
 	this.url = url
-	this.conn = NewConn(nil, this.config.sendQueueSize, this.waitGroup, this.config.keepAliveMinTime)
-	this.conn.SetIoFilterChain(this.config.filterChain)
+	this.reconnectMtx.Unlock()
 
-	addr, err := net.ResolveTCPAddr("tcp", url)
+	con := NewConn(nil, this.config.sendQueueSize, this.waitGroup, this.config.keepAliveMinTime)
+	if this.config.cloneFilterChain {
+		con.SetIoFilterChain(this.config.filterChain.NewInstanceAndClone(con))
+	} else {
+		con.SetIoFilterChain(this.config.filterChain)
+	}
+	con.setDatagramMode(this.config.datagram)
+	con.setParentMetrics(this.metrics)
+	con.SetLogger(this.logger)
+	con.writeBatch = this.config.writeBatch
+	con.sendQueue = this.config.sendQueue
+	con.setCloseCallback(func(*Tcpcon) {
+		this.scheduleReconnect()
+	})
+	// publish it after set up, the others may get it by GetCon at any time
+	this.setCon(con)
+
+	rawConn, err := this.dial(url)
 	if err != nil {
-		LogError("Connection[%s] resolve tcpaddr[%s] failed, error:%s.", this.connName, url, err.Error())
+		this.logger.Log(LvlError, "connect failed", "url", url, "err", err)
+		this.metrics.addAcceptError()
 		return false
 	}
 
-	this.conn.rawConn, err = net.DialTCP("tcp", nil, addr)
-	if err != nil {
-		LogError("Connection[%s] connect to url[%s] failed, error:%s.", this.connName, url, err.Error())
+	if this.config.tlsConfig == nil {
+		con.rawConn = rawConn
+		this.metrics.addAccept()
+		return true
+	}
+
+	tlsConfig := this.config.tlsConfig
+	if tlsConfig.ServerName == "" {
+		if host, _, err := net.SplitHostPort(url); err == nil {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+	}
+
+	con.rawConn = tls.Client(rawConn, tlsConfig)
+	if err := con.handshake(this.config.tlsHandshakeTimeout); err != nil {
+		this.logger.Log(LvlError, "tls handshake failed", "url", url, "err", err)
+		con.rawConn.Close()
+		this.metrics.addAcceptError()
 		return false
 	}
 
+	this.metrics.addAccept()
 	return true
 }
 
+// dial to the url
+func (this *TcpConnector) dial(url string) (net.Conn, error) {
+	if this.config.dialer != nil {
+		return this.config.dialer(this.config.network, url)
+	}
+
+	if this.config.network != "tcp" {
+		return net.Dial(this.config.network, url)
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", url)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.DialTCP("tcp", nil, addr)
+}
+
 // start the connector
 func (this *TcpConnector) start() bool {
-	if this.conn != nil {
-		this.conn.Start()
+	if con := this.GetCon(); con != nil {
+		con.Start()
 		return true
 	}
 	return false
@@ -122,15 +463,24 @@ func (this *TcpConnector) start() bool {
 
 // stop the connector
 func (this *TcpConnector) Stop() {
-	if this.conn != nil {
-		this.conn.ShutDown()
+	atomic.StoreInt32(&this.stopFlag, 1)
+
+	this.reconnectMtx.Lock()
+	if this.reconnectTimer != nil {
+		this.reconnectTimer.Stop()
+		this.reconnectTimer = nil
+	}
+	this.reconnectMtx.Unlock()
+
+	if con := this.GetCon(); con != nil {
+		con.ShutDown()
 	}
 }
 
 // is the connector connected
 func (this *TcpConnector) IsConnected() bool {
-	if this.conn != nil {
-		return this.conn.IsConnected()
+	if con := this.GetCon(); con != nil {
+		return con.IsConnected()
 	}
 
 	return false
@@ -138,8 +488,12 @@ func (this *TcpConnector) IsConnected() bool {
 
 // is the connector shudown
 func (this *TcpConnector) IsShutdown() bool {
-	if this.conn != nil {
-		return this.conn.IsShutdown()
+	if atomic.LoadInt32(&this.stopFlag) == 1 {
+		return true
+	}
+
+	if con := this.GetCon(); con != nil {
+		return con.IsShutdown()
 	}
 	return false
 }
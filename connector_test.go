@@ -0,0 +1,138 @@
+// File TcpConnector test
+
+package gonetio
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record the connection and the reconnect events of the instance
+type reconnectRecorder struct {
+	IoHandlerImp
+	opened chan *reconnectRecorder
+	mtx    sync.Mutex
+	events []string
+}
+
+func newReconnectRecorder(opened chan *reconnectRecorder) *reconnectRecorder {
+	handler := &reconnectRecorder{opened: opened}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *reconnectRecorder) add(event string) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	this.events = append(this.events, event)
+}
+
+func (this *reconnectRecorder) getEvents() []string {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return append([]string{}, this.events...)
+}
+
+func (this *reconnectRecorder) ConnOpened(filter *IoFilter) {
+	this.add("opened")
+	this.opened <- this
+}
+
+func (this *reconnectRecorder) ConnClosed(filter *IoFilter) {
+	this.add("closed")
+}
+
+func (this *reconnectRecorder) Reconnecting(connector *TcpConnector, attempt int, delay time.Duration) {
+	this.add("reconnecting")
+}
+
+func (this *reconnectRecorder) Reconnected(connector *TcpConnector, attempt int) {
+	this.add("reconnected")
+}
+
+func (this *reconnectRecorder) GaveUp(connector *TcpConnector, attempts int) {
+	this.add("gave up")
+}
+
+func (this *reconnectRecorder) Clone() IoHandler {
+	return newReconnectRecorder(this.opened)
+}
+
+// listen at a random loopback port, the accepted connections are handled by the fn
+func startListener(t *testing.T, fn func(net.Conn)) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fn(conn)
+		}
+	}()
+	return listener
+}
+
+// the connections use the filter chain directly unless cloning is set
+func TestConnectorFilterChain(t *testing.T) {
+	for _, clone := range []bool{false, true} {
+		listener := startListener(t, func(conn net.Conn) {
+			t.Cleanup(func() { conn.Close() })
+		})
+
+		opened := make(chan *reconnectRecorder, 4)
+		template := newReconnectRecorder(opened)
+		connector := NewConnector("test", 16, 0)
+		connector.SetCloneFilterChain(clone)
+		connector.GetIoFilterChain().AddLast("recorder", template)
+		connector.AsyncConnect(listener.Addr().String())
+
+		live := waitFor(t, opened, "the connection opened")
+		if chain := connector.GetCon().GetIoFilterChain(); (chain == connector.GetIoFilterChain()) == clone {
+			t.Fatalf("clone %v, the connection uses the template chain %v", clone, !clone)
+		}
+		if (live == template) == clone {
+			t.Fatalf("clone %v, the template handler opened %v", clone, live == template)
+		}
+		connector.Stop()
+	}
+}
+
+// the reconnect events reach the handler instance seeing the connection events
+func TestConnectorReconnectListener(t *testing.T) {
+	listener := startListener(t, func(conn net.Conn) {
+		conn.Close()
+	})
+
+	opened := make(chan *reconnectRecorder, 4)
+	connector := NewConnector("test", 16, 0)
+	connector.SetCloneFilterChain(true)
+	connector.SetReconnectPolicy(NewReconnectPolicy(time.Hour, 0, 1, 0, 0))
+	connector.GetIoFilterChain().AddLast("recorder", newReconnectRecorder(opened))
+	connector.AsyncConnect(listener.Addr().String())
+	defer connector.Stop()
+
+	live := waitFor(t, opened, "the connection opened")
+	expect := []string{"opened", "closed", "reconnecting"}
+	deadline := time.Now().Add(3 * time.Second)
+	for !reflect.DeepEqual(live.getEvents(), expect) {
+		if time.Now().After(deadline) {
+			t.Fatalf("events %v, expect %v", live.getEvents(), expect)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if url := connector.GetUrl(); url != listener.Addr().String() {
+		t.Fatalf("url %q", url)
+	}
+}
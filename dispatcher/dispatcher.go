@@ -0,0 +1,207 @@
+// File Dispatcher
+
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"gonetio"
+	"gonetio/codec"
+	"reflect"
+	"sync"
+)
+
+// error type
+var (
+	ErrRouteDuplicate = errors.New("Dispatcher route already registered")
+	ErrRouteNil       = errors.New("Dispatcher route handler is nil")
+)
+
+// the message dispatched to the handler func
+type Context struct {
+	Filter   *gonetio.IoFilter // the filter of the dispatcher
+	Con      *gonetio.Tcpcon   // the connection
+	ID       uint32            // the message id, 0 if the message is not registered
+	Seq      uint32            // the sequence number, 0 if the message is not in an envelope
+	Message  interface{}       // the message, the body of the envelope
+	Envelope *codec.Envelope   // the envelope received, nil if none
+	hasID    bool              // is the message id known
+}
+
+// write the message to the connection
+func (this *Context) Write(msg interface{}) {
+	this.Con.Write(msg)
+}
+
+// the handler func of the messages
+type HandlerFunc func(ctx *Context)
+
+// the middleware wraps the handler func, e.g. logging, auth, timing
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// the routes shared by the cloned dispatchers
+type routeTable struct {
+	mtx         *sync.RWMutex
+	registry    *codec.MessageRegistry       // look up the id of the message not in an envelope
+	idRoutes    map[uint32]HandlerFunc       // <message id, handler>
+	typeRoutes  map[reflect.Type]HandlerFunc // <message type, handler>
+	fallback    HandlerFunc                  // handle the messages no route matched
+	middlewares []Middleware                 // the middlewares, the first one is the outermost
+}
+
+// the dispatcher routes the messages to the handler funcs by the message id or the go type
+// the messages no route matched go to the fallback, or the next filter if no fallback
+// the routes are shared by the cloned dispatchers, so one dispatcher in the acceptor
+// filter chain serves all the connections
+type Dispatcher struct {
+	gonetio.IoHandlerAdaptor
+	routes *routeTable
+}
+
+// new dispatcher
+// the registry is used to look up the id of the message not in an envelope, can be nil
+func NewDispatcher(registry *codec.MessageRegistry) *Dispatcher {
+	handler := &Dispatcher{
+		routes: &routeTable{
+			mtx:        &sync.RWMutex{},
+			registry:   registry,
+			idRoutes:   make(map[uint32]HandlerFunc),
+			typeRoutes: make(map[reflect.Type]HandlerFunc),
+		},
+	}
+	handler.SetBoundType(gonetio.InBound)
+	return handler
+}
+
+// get the go type of the message, the pointer and the value route the same
+func messageType(msg interface{}) reflect.Type {
+	t := reflect.TypeOf(msg)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// route the message id to the handler func
+func (this *Dispatcher) HandleID(id uint32, fn HandlerFunc) error {
+	if fn == nil {
+		return ErrRouteNil
+	}
+
+	this.routes.mtx.Lock()
+	defer this.routes.mtx.Unlock()
+
+	if _, ok := this.routes.idRoutes[id]; ok {
+		return fmt.Errorf("%w: id %d", ErrRouteDuplicate, id)
+	}
+	this.routes.idRoutes[id] = fn
+	return nil
+}
+
+// route the type of the message to the handler func, the message is a value or a pointer of the type
+// e.g. dispatcher.Handle(&LoginRequest{}, onLogin)
+func (this *Dispatcher) Handle(msg interface{}, fn HandlerFunc) error {
+	if fn == nil {
+		return ErrRouteNil
+	}
+
+	t := messageType(msg)
+
+	this.routes.mtx.Lock()
+	defer this.routes.mtx.Unlock()
+
+	if _, ok := this.routes.typeRoutes[t]; ok {
+		return fmt.Errorf("%w: type %v", ErrRouteDuplicate, t)
+	}
+	this.routes.typeRoutes[t] = fn
+	return nil
+}
+
+// set the handler func of the messages no route matched
+func (this *Dispatcher) SetFallback(fn HandlerFunc) {
+	this.routes.mtx.Lock()
+	defer this.routes.mtx.Unlock()
+
+	this.routes.fallback = fn
+}
+
+// add the middlewares, they wrap all the handler funcs, the fallback included
+func (this *Dispatcher) Use(middlewares ...Middleware) {
+	this.routes.mtx.Lock()
+	defer this.routes.mtx.Unlock()
+
+	this.routes.middlewares = append(this.routes.middlewares, middlewares...)
+}
+
+// new the context of the message
+func (this *Dispatcher) newContext(filter *gonetio.IoFilter, obj gonetio.BaseObject) *Context {
+	ctx := &Context{
+		Filter:  filter,
+		Con:     filter.GetCon(),
+		Message: obj,
+	}
+
+	if envelope, ok := obj.(*codec.Envelope); ok {
+		ctx.ID = envelope.ID
+		ctx.hasID = true
+		ctx.Seq = envelope.Seq
+		ctx.Message = envelope.Body
+		ctx.Envelope = envelope
+	} else if this.routes.registry != nil {
+		id, err := this.routes.registry.GetID(obj)
+		ctx.ID = id
+		ctx.hasID = err == nil
+	}
+
+	return ctx
+}
+
+// find the handler func of the message, wrapped by the middlewares
+// return nil if no route matched and no fallback
+func (this *Dispatcher) route(ctx *Context) HandlerFunc {
+	this.routes.mtx.RLock()
+	defer this.routes.mtx.RUnlock()
+
+	var fn HandlerFunc = nil
+	ok := false
+	if ctx.hasID {
+		fn, ok = this.routes.idRoutes[ctx.ID]
+	}
+	if !ok {
+		fn, ok = this.routes.typeRoutes[messageType(ctx.Message)]
+	}
+	if !ok {
+		fn = this.routes.fallback
+	}
+	if fn == nil {
+		return nil
+	}
+
+	for i := len(this.routes.middlewares) - 1; i >= 0; i-- {
+		fn = this.routes.middlewares[i](fn)
+	}
+	return fn
+}
+
+// The event fired when receive message from the connection
+func (this *Dispatcher) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	ctx := this.newContext(filter, obj)
+
+	fn := this.route(ctx)
+	if fn == nil {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	fn(ctx)
+}
+
+// Clone
+// the clone shares the routes
+func (this *Dispatcher) Clone() gonetio.IoHandler {
+	handler := &Dispatcher{
+		routes: this.routes,
+	}
+	handler.SetBoundType(gonetio.InBound)
+	return handler
+}
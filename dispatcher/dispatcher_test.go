@@ -0,0 +1,253 @@
+// File Dispatcher test
+
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"gonetio"
+	"gonetio/codec"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type loginRequest struct{ Name string }
+type chatMessage struct{ Text string }
+type unknownMessage struct{}
+
+// record the messages and the errors passed to the next filter
+type nextRecorder struct {
+	gonetio.IoHandlerImp
+	messages []interface{}
+	errs     []error
+}
+
+func (this *nextRecorder) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.messages = append(this.messages, obj)
+}
+
+func (this *nextRecorder) ExceptionCaught(filter *gonetio.IoFilter, err error) {
+	this.errs = append(this.errs, err)
+}
+
+func (this *nextRecorder) Clone() gonetio.IoHandler {
+	return &nextRecorder{}
+}
+
+// new the chain of the dispatcher and the recorder after it
+func newDispatchChain(dispatcher gonetio.IoHandler) (*gonetio.IoFilterChain, *nextRecorder) {
+	recorder := &nextRecorder{}
+	recorder.SetBoundType(gonetio.InBound)
+
+	chain := gonetio.NewIoFilterChain(gonetio.NewConn(nil, 0, &sync.WaitGroup{}, 0))
+	chain.AddLast("dispatcher", dispatcher)
+	chain.AddLast("recorder", recorder)
+	return chain, recorder
+}
+
+// the handler func records the route name
+func recordRoute(routes *[]string, name string) HandlerFunc {
+	return func(ctx *Context) {
+		*routes = append(*routes, name)
+	}
+}
+
+func TestDispatcherRoute(t *testing.T) {
+	registry := codec.NewMessageRegistry()
+	registry.Register(1, &loginRequest{})
+	registry.Register(2, &chatMessage{})
+
+	routes := []string{}
+	dispatcher := NewDispatcher(registry)
+	dispatcher.HandleID(1, recordRoute(&routes, "id 1"))
+	dispatcher.Handle(&chatMessage{}, recordRoute(&routes, "type chat"))
+	chain, recorder := newDispatchChain(dispatcher)
+
+	tests := []struct {
+		name  string
+		msg   interface{}
+		route string // empty if passed to the next filter
+	}{
+		{"envelope id", &codec.Envelope{ID: 1, Seq: 7, Body: &loginRequest{}}, "id 1"},
+		{"registry id", &loginRequest{}, "id 1"},
+		{"type pointer", &chatMessage{}, "type chat"},
+		{"type value", chatMessage{}, "type chat"},
+		{"envelope type", &codec.Envelope{ID: 9, Body: &chatMessage{}}, "type chat"},
+		{"no route", &unknownMessage{}, ""},
+		{"envelope no route", &codec.Envelope{ID: 9, Body: &unknownMessage{}}, ""},
+	}
+
+	for _, test := range tests {
+		routes = routes[:0]
+		recorder.messages = nil
+
+		chain.FireMessageReceived(test.msg)
+		if test.route == "" {
+			if len(routes) != 0 || len(recorder.messages) != 1 || recorder.messages[0] != test.msg {
+				t.Fatalf("%s: routes %v, next %v, expect passed to the next filter", test.name, routes, recorder.messages)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(routes, []string{test.route}) || len(recorder.messages) != 0 {
+			t.Fatalf("%s: routes %v, next %v, expect %s", test.name, routes, recorder.messages, test.route)
+		}
+	}
+}
+
+func TestDispatcherContext(t *testing.T) {
+	var got *Context = nil
+	dispatcher := NewDispatcher(nil)
+	dispatcher.HandleID(3, func(ctx *Context) {
+		got = ctx
+	})
+	chain, _ := newDispatchChain(dispatcher)
+	con := chain.Get("dispatcher").GetCon()
+
+	body := &loginRequest{Name: "a"}
+	envelope := &codec.Envelope{ID: 3, Seq: 11, Body: body}
+	chain.FireMessageReceived(envelope)
+
+	if got == nil || got.ID != 3 || got.Seq != 11 || got.Message != body || got.Envelope != envelope || got.Con != con || con == nil {
+		t.Fatalf("context %+v", got)
+	}
+}
+
+func TestDispatcherRouteErrors(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+	noop := func(ctx *Context) {}
+
+	if err := dispatcher.HandleID(1, noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.HandleID(1, noop); !errors.Is(err, ErrRouteDuplicate) {
+		t.Fatalf("duplicate id err %v", err)
+	}
+	if err := dispatcher.HandleID(2, nil); !errors.Is(err, ErrRouteNil) {
+		t.Fatalf("nil id handler err %v", err)
+	}
+
+	if err := dispatcher.Handle(&chatMessage{}, noop); err != nil {
+		t.Fatal(err)
+	}
+	// the value and the pointer are the same type
+	if err := dispatcher.Handle(chatMessage{}, noop); !errors.Is(err, ErrRouteDuplicate) {
+		t.Fatalf("duplicate type err %v", err)
+	}
+	if err := dispatcher.Handle(&loginRequest{}, nil); !errors.Is(err, ErrRouteNil) {
+		t.Fatalf("nil type handler err %v", err)
+	}
+}
+
+func TestDispatcherFallback(t *testing.T) {
+	routes := []string{}
+	dispatcher := NewDispatcher(nil)
+	dispatcher.Handle(&chatMessage{}, recordRoute(&routes, "type chat"))
+	dispatcher.SetFallback(recordRoute(&routes, "fallback"))
+	chain, recorder := newDispatchChain(dispatcher)
+
+	chain.FireMessageReceived(&chatMessage{})
+	chain.FireMessageReceived(&unknownMessage{})
+	chain.FireMessageReceived(&codec.Envelope{ID: 5, Body: &unknownMessage{}})
+
+	if !reflect.DeepEqual(routes, []string{"type chat", "fallback", "fallback"}) {
+		t.Fatalf("routes %v", routes)
+	}
+	if len(recorder.messages) != 0 {
+		t.Fatalf("next filter got %v with the fallback set", recorder.messages)
+	}
+}
+
+func TestDispatcherMiddlewareOrder(t *testing.T) {
+	calls := []string{}
+	trace := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				calls = append(calls, name+" in")
+				next(ctx)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+
+	dispatcher := NewDispatcher(nil)
+	dispatcher.Use(trace("a"), trace("b"))
+	dispatcher.Use(trace("c"))
+	dispatcher.Handle(&chatMessage{}, recordRoute(&calls, "handler"))
+	dispatcher.SetFallback(recordRoute(&calls, "fallback"))
+	chain, _ := newDispatchChain(dispatcher)
+
+	tests := []struct {
+		msg   interface{}
+		inner string
+	}{
+		{&chatMessage{}, "handler"},
+		{&unknownMessage{}, "fallback"},
+	}
+
+	for _, test := range tests {
+		calls = calls[:0]
+		chain.FireMessageReceived(test.msg)
+
+		expect := []string{"a in", "b in", "c in", test.inner, "c out", "b out", "a out"}
+		if !reflect.DeepEqual(calls, expect) {
+			t.Fatalf("%T: calls %v, expect %v", test.msg, calls, expect)
+		}
+	}
+}
+
+func TestDispatcherAuth(t *testing.T) {
+	routes := []string{}
+	dispatcher := NewDispatcher(nil)
+	dispatcher.Use(Auth(func(ctx *Context) error {
+		if _, ok := ctx.Message.(*loginRequest); ok {
+			return nil
+		}
+		return fmt.Errorf("login first")
+	}))
+	dispatcher.Handle(&loginRequest{}, recordRoute(&routes, "login"))
+	dispatcher.Handle(&chatMessage{}, recordRoute(&routes, "chat"))
+	chain, recorder := newDispatchChain(dispatcher)
+
+	chain.FireMessageReceived(&chatMessage{})
+	chain.FireMessageReceived(&loginRequest{})
+
+	if !reflect.DeepEqual(routes, []string{"login"}) {
+		t.Fatalf("routes %v", routes)
+	}
+	if len(recorder.errs) != 1 || !errors.Is(recorder.errs[0], ErrUnauthorized) {
+		t.Fatalf("errors %v, expect one ErrUnauthorized", recorder.errs)
+	}
+}
+
+// the clones share the routes, the routes added later are seen by all of them
+func TestDispatcherCloneSharesRoutes(t *testing.T) {
+	routes := []string{}
+	dispatcher := NewDispatcher(nil)
+	dispatcher.Handle(&loginRequest{}, recordRoute(&routes, "login"))
+	template, _ := newDispatchChain(dispatcher)
+
+	chain := template.NewInstanceAndClone(gonetio.NewConn(nil, 0, &sync.WaitGroup{}, 0))
+	clone := chain.Get("dispatcher").GetHandler().(*Dispatcher)
+	if clone == dispatcher {
+		t.Fatal("the chain instance shares the dispatcher")
+	}
+
+	dispatcher.Handle(&chatMessage{}, recordRoute(&routes, "chat"))
+	dispatcher.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			routes = append(routes, "middleware")
+			next(ctx)
+		}
+	})
+	clone.SetFallback(recordRoute(&routes, "fallback"))
+
+	chain.FireMessageReceived(&loginRequest{})
+	chain.FireMessageReceived(&chatMessage{})
+	template.FireMessageReceived(&unknownMessage{})
+
+	expect := []string{"middleware", "login", "middleware", "chat", "middleware", "fallback"}
+	if !reflect.DeepEqual(routes, expect) {
+		t.Fatalf("routes %v, expect %v", routes, expect)
+	}
+}
@@ -0,0 +1,55 @@
+// File Middleware
+
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"gonetio"
+	"time"
+)
+
+// error type
+var (
+	ErrUnauthorized = errors.New("Message unauthorized")
+)
+
+// the middleware logs each message dispatched
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if logger := ctx.Con.Logger(); logger.Enabled(gonetio.LvlDebug) {
+				logger.Log(gonetio.LvlDebug, "dispatch message", "type", fmt.Sprintf("%T", ctx.Message), "id", ctx.ID, "seq", ctx.Seq)
+			}
+			next(ctx)
+		}
+	}
+}
+
+// the middleware reports the time each handler func takes
+func Timing(observe func(ctx *Context, elapsed time.Duration)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			start := time.Now()
+			defer func() {
+				observe(ctx, time.Since(start))
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// the middleware checks each message before dispatched
+// the message is dropped if the check returns error, and the error is fired through the chain,
+// the default exception handling closes the connection
+func Auth(check func(ctx *Context) error) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if err := check(ctx); err != nil {
+				ctx.Filter.ExceptionCaught(fmt.Errorf("%w: message[%T] id[%d], %s", ErrUnauthorized, ctx.Message, ctx.ID, err.Error()))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
@@ -10,19 +10,18 @@ import (
 )
 
 type ClientSession struct {
-	connector      *gonetio.TcpConnector // connector
-	wg             *sync.WaitGroup
-	url            string
-	reconnectCount int
+	connector *gonetio.TcpConnector // connector
+	wg        *sync.WaitGroup
+	url       string
 }
 
 func NewClientSession(name string, remoteUrl string) *ClientSession {
 	cnector := gonetio.NewConnector(name, 2048, 0)
+	cnector.SetReconnectPolicy(gonetio.NewReconnectPolicy(time.Second, 30*time.Second, 2, 0.2, 0))
 	return &ClientSession{
-		connector:      cnector,
-		wg:             &sync.WaitGroup{},
-		url:            remoteUrl,
-		reconnectCount: 0,
+		connector: cnector,
+		wg:        &sync.WaitGroup{},
+		url:       remoteUrl,
 	}
 }
 
@@ -32,23 +31,6 @@ func (this *ClientSession) AsyncConnect() {
 	}
 }
 
-func (this *ClientSession) TryReconnectAfter(tm time.Duration) {
-	go func() {
-		timer := time.Tick(tm)
-		for {
-			_, ok := <-timer
-			if ok {
-				this.reconnectCount += 1
-				fmt.Printf("try reconnect to url[%s], count[%d]\n", this.url, this.reconnectCount)
-				this.AsyncConnect()
-				return
-			} else {
-				fmt.Printf("reconnector timer error\n")
-			}
-		}
-	}()
-}
-
 func (this *ClientSession) SendData(msg gonetio.BaseObject) {
 	this.connector.Write(msg)
 }
@@ -77,8 +59,18 @@ func (tl *SessionEventHandler) ConnOpened(filter *gonetio.IoFilter) {
 func (tl *SessionEventHandler) ConnClosed(filter *gonetio.IoFilter) {
 	addr := filter.GetCon().RemoteAddr()
 	fmt.Printf("connection[%s] closed\n", addr)
+}
+
+func (tl *SessionEventHandler) Reconnecting(connector *gonetio.TcpConnector, attempt int, delay time.Duration) {
+	fmt.Printf("try reconnect to url[%s] after %v, count[%d]\n", connector.GetUrl(), delay, attempt)
+}
+
+func (tl *SessionEventHandler) Reconnected(connector *gonetio.TcpConnector, attempt int) {
+	fmt.Printf("reconnected to url[%s] after %d attempts\n", connector.GetUrl(), attempt)
+}
 
-	tl.session.TryReconnectAfter(5 * time.Second)
+func (tl *SessionEventHandler) GaveUp(connector *gonetio.TcpConnector, attempts int) {
+	fmt.Printf("give up reconnecting to url[%s] after %d attempts\n", connector.GetUrl(), attempts)
 }
 
 func (tl *SessionEventHandler) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
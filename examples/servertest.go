@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gonetio"
 	"gonetio/codec"
+	"time"
 )
 
 type EchoEventHandler struct {
@@ -44,6 +45,20 @@ func (tl *EchoEventHandler) MessageReceived(filter *gonetio.IoFilter, obj goneti
 	filter.GetCon().Write(bufferRet)
 }
 
+func (tl *EchoEventHandler) ExceptionCaught(filter *gonetio.IoFilter, err error) {
+	addr := filter.GetCon().RemoteAddr()
+	fmt.Printf("connection[%s] exception caught, error:%s\n", addr, err.Error())
+
+	filter.GetCon().Close()
+}
+
+func (tl *EchoEventHandler) SessionIdle(filter *gonetio.IoFilter, status gonetio.IdleStatus) {
+	addr := filter.GetCon().RemoteAddr()
+	fmt.Printf("connection[%s] %s, close it\n", addr, status)
+
+	filter.GetCon().Close()
+}
+
 // Clone
 func (tl *EchoEventHandler) Clone() gonetio.IoHandler {
 	return newEchoEventHandler()
@@ -56,6 +71,7 @@ func NetioServerTest() {
 
 	acceptor := gonetio.NewAcceptor(config)
 	handler := newEchoEventHandler()
+	acceptor.GetFilterChain().AddLast("IdleState", gonetio.NewIdleStateHandler(60*time.Second, 0, 0))
 	acceptor.GetFilterChain().AddLast("FrameDecoder", codec.NewFrameDecoder(4, true))
 	acceptor.GetFilterChain().AddLast("FrameEncoder", codec.NewFrameEncoder(4, true))
 	acceptor.GetFilterChain().AddLast("handler", handler)
@@ -0,0 +1,210 @@
+// File IdleStateHandler
+
+package gonetio
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	idleCheckInterval = 100 * time.Millisecond // the resolution of the idle checker
+)
+
+// the idle checker shared by all the idle state handlers
+// one goroutine scans all the registered handlers, instead of one timer per connection
+type idleChecker struct {
+	mtx      sync.Mutex                     // guard the handlers
+	handlers map[*IdleStateHandler]struct{} // the registered handlers
+	running  bool                           // is the check loop running
+	idles    []*IdleStateHandler            // reused between the ticks
+	statuses []IdleStatus                   // reused between the ticks
+}
+
+var defaultIdleChecker = &idleChecker{
+	handlers: make(map[*IdleStateHandler]struct{}),
+}
+
+// register the handler, start the check loop if needed
+func (this *idleChecker) register(handler *IdleStateHandler) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	this.handlers[handler] = struct{}{}
+	if !this.running {
+		this.running = true
+		go this.checkLoop()
+	}
+}
+
+// unregister the handler
+func (this *idleChecker) unregister(handler *IdleStateHandler) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	delete(this.handlers, handler)
+}
+
+// the check loop, exit when no handler registered
+func (this *idleChecker) checkLoop() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !this.check(now.UnixNano()) {
+			return
+		}
+	}
+}
+
+// check all the handlers, fire the events out of the lock
+// return false if the check loop should exit
+func (this *idleChecker) check(now int64) bool {
+	this.mtx.Lock()
+	if len(this.handlers) == 0 {
+		this.running = false
+		this.mtx.Unlock()
+		return false
+	}
+
+	this.idles = this.idles[:0]
+	this.statuses = this.statuses[:0]
+	for handler := range this.handlers {
+		for status := ReaderIdle; status <= AllIdle; status++ {
+			if handler.isIdle(status, now) {
+				this.idles = append(this.idles, handler)
+				this.statuses = append(this.statuses, status)
+			}
+		}
+	}
+	this.mtx.Unlock()
+
+	for i, handler := range this.idles {
+		handler.fireIdle(this.statuses[i])
+		this.idles[i] = nil
+	}
+	return true
+}
+
+// the idle state of one status
+type idleState struct {
+	timeout  int64 // in nanoseconds, disabled when not positive
+	lastFire int64 // in unix nanoseconds, the last time the event fired
+}
+
+// the handler fires the session idle event when the connection
+// has not read, written, or both, for the configured time
+// the event is fired from the shared idle checker goroutine, handlers should not block in it
+type IdleStateHandler struct {
+	IoHandlerAdaptor
+	readerIdleTime time.Duration // reader idle time, disabled when not positive
+	writerIdleTime time.Duration // writer idle time, disabled when not positive
+	allIdleTime    time.Duration // all idle time, disabled when not positive
+	lastRead       int64         // in unix nanoseconds, the last time a message read
+	lastWrite      int64         // in unix nanoseconds, the last time a message written
+	states         [3]idleState  // the states of reader, writer and all idle
+	filter         *IoFilter     // the filter of the handler
+}
+
+// new idle state handler
+func NewIdleStateHandler(readerIdle time.Duration, writerIdle time.Duration, allIdle time.Duration) *IdleStateHandler {
+	handler := &IdleStateHandler{
+		readerIdleTime: readerIdle,
+		writerIdleTime: writerIdle,
+		allIdleTime:    allIdle,
+	}
+	handler.states[ReaderIdle].timeout = int64(readerIdle)
+	handler.states[WriterIdle].timeout = int64(writerIdle)
+	handler.states[AllIdle].timeout = int64(allIdle)
+	handler.SetBoundType(InBound | OutBound)
+	return handler
+}
+
+// Connection opened
+func (this *IdleStateHandler) ConnOpened(filter *IoFilter) {
+	now := time.Now().UnixNano()
+	this.filter = filter
+	atomic.StoreInt64(&this.lastRead, now)
+	atomic.StoreInt64(&this.lastWrite, now)
+	for i := range this.states {
+		atomic.StoreInt64(&this.states[i].lastFire, 0)
+	}
+
+	if this.readerIdleTime > 0 || this.writerIdleTime > 0 || this.allIdleTime > 0 {
+		defaultIdleChecker.register(this)
+		if con := filter.GetCon(); con != nil {
+			con.AddCloseListener(func(*Tcpcon) {
+				defaultIdleChecker.unregister(this)
+			})
+		}
+	}
+
+	filter.ConnOpened()
+}
+
+// Connection closed
+func (this *IdleStateHandler) ConnClosed(filter *IoFilter) {
+	defaultIdleChecker.unregister(this)
+	filter.ConnClosed()
+}
+
+// The event fired when receive message from the connection
+func (this *IdleStateHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	atomic.StoreInt64(&this.lastRead, time.Now().UnixNano())
+	filter.MessageReceived(obj)
+}
+
+// Fire Write
+func (this *IdleStateHandler) FireWrite(filter *IoFilter, obj BaseObject) {
+	atomic.StoreInt64(&this.lastWrite, time.Now().UnixNano())
+	filter.FireWrite(obj)
+}
+
+// the last activity time of the status
+func (this *IdleStateHandler) lastActivity(status IdleStatus) int64 {
+	lastRead := atomic.LoadInt64(&this.lastRead)
+	lastWrite := atomic.LoadInt64(&this.lastWrite)
+
+	switch status {
+	case ReaderIdle:
+		return lastRead
+	case WriterIdle:
+		return lastWrite
+	}
+
+	if lastRead > lastWrite {
+		return lastRead
+	}
+	return lastWrite
+}
+
+// is the connection idle of the status
+// the event fires again only after another idle time passed
+func (this *IdleStateHandler) isIdle(status IdleStatus, now int64) bool {
+	state := &this.states[status]
+	if state.timeout <= 0 {
+		return false
+	}
+
+	last := this.lastActivity(status)
+	if lastFire := atomic.LoadInt64(&state.lastFire); lastFire > last {
+		last = lastFire
+	}
+
+	return now-last >= state.timeout
+}
+
+// fire the session idle event
+func (this *IdleStateHandler) fireIdle(status IdleStatus) {
+	atomic.StoreInt64(&this.states[status].lastFire, time.Now().UnixNano())
+
+	if this.filter != nil {
+		this.filter.SessionIdle(status)
+	}
+}
+
+// Clone
+func (this *IdleStateHandler) Clone() IoHandler {
+	return NewIdleStateHandler(this.readerIdleTime, this.writerIdleTime, this.allIdleTime)
+}
@@ -0,0 +1,41 @@
+// File IdleStateHandler test
+
+package gonetio
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// is the handler registered in the idle checker
+func isIdleRegistered(handler *IdleStateHandler) bool {
+	defaultIdleChecker.mtx.Lock()
+	defer defaultIdleChecker.mtx.Unlock()
+
+	_, ok := defaultIdleChecker.handlers[handler]
+	return ok
+}
+
+func TestIdleStateHandlerUnregisterOnShutdown(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	con := NewConnFull(local, 16, &sync.WaitGroup{}, 0)
+	handler := NewIdleStateHandler(time.Hour, 0, 0)
+	chain := NewIoFilterChain(con)
+	chain.AddLast("idle", handler)
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	if !isIdleRegistered(handler) {
+		t.Fatal("handler not registered after the connection opened")
+	}
+
+	// the shutdown fires no ConnClosed, the close listener unregisters it
+	con.ShutDown()
+	if isIdleRegistered(handler) {
+		t.Fatal("handler still registered after the connection shutdown")
+	}
+}
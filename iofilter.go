@@ -6,14 +6,60 @@ package gonetio
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
 )
 
+// error type
+var (
+	ErrFilterNotFound      = errors.New("Filter not found in the chain")
+	ErrFilterNameDuplicate = errors.New("Filter name already exists in the chain")
+)
+
+// the error of a panic recovered from a handler
+type PanicError struct {
+	Value interface{} // the recovered value
+	Stack []byte      // the stack when the panic happened
+}
+
+func (this *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", this.Value)
+}
+
+// log the exception, with the stack if it's a panic
+func logExceptionCaught(filter *IoFilter, msg string, err error) {
+	if pe, ok := err.(*PanicError); ok {
+		filter.Logger().Log(LvlError, msg, "err", err, "stack", string(pe.Stack))
+		return
+	}
+	filter.Logger().Log(LvlError, msg, "err", err)
+}
+
 type IoFilter struct {
-	name    string    // the name of the filter
-	handler IoHandler // the handler
-	next    *IoFilter // the next filter
-	prev    *IoFilter // the pre filter
-	conn    *Tcpcon   // the tcp connection
+	name    string         // the name of the filter
+	handler IoHandler      // the handler
+	next    *IoFilter      // the next filter
+	prev    *IoFilter      // the pre filter
+	conn    *Tcpcon        // the tcp connection
+	chain   *IoFilterChain // the chain the filter belongs to
+	write   *WriteFuture   // the future of the write being fired, set on the filter of the write only
+}
+
+// get the name of the filter
+func (flt *IoFilter) GetName() string {
+	return flt.name
+}
+
+// get the handler of the filter
+func (flt *IoFilter) GetHandler() IoHandler {
+	return flt.handler
+}
+
+// get the chain the filter belongs to
+func (flt *IoFilter) GetChain() *IoFilterChain {
+	return flt.chain
 }
 
 // set tcp con
@@ -26,32 +72,74 @@ func (flt *IoFilter) GetCon() *Tcpcon {
 	return flt.conn
 }
 
+// get the logger of the connection with the filter name attached
+func (flt *IoFilter) Logger() FieldLogger {
+	if flt.conn == nil {
+		return DefaultLogger().With("filter", flt.name)
+	}
+	return flt.conn.Logger().With("filter", flt.name)
+}
+
 // Find next in bound filter
 func (flt *IoFilter) findNextInBoundFilter() *IoFilter {
-	next := flt.getNext()
-	for {
-		if next != nil && !next.getHandler().IsInBound() {
-			next = next.getNext()
-		} else {
-			break
-		}
-	}
+	next, _ := flt.findNextInBound()
 	return next
 }
 
+// find the next in bound filter, and whether it's the last in bound one before the tail
+// the links are read under the chain lock once, so the chain can be edited
+// while events are travelling through it
+func (flt *IoFilter) findNextInBound() (*IoFilter, bool) {
+	if flt.chain != nil {
+		flt.chain.mtx.RLock()
+		defer flt.chain.mtx.RUnlock()
+	}
+
+	next := flt.next
+	for next != nil && !next.handler.IsInBound() {
+		next = next.next
+	}
+	return next, flt.chain != nil && flt.chain.lastInBound == next
+}
+
 // Find next out bound filter
 func (flt *IoFilter) findNextOutBoundFilter() *IoFilter {
-	prev := flt.getPrev()
-	for {
-		if prev != nil && !prev.getHandler().IsOutBound() {
-			prev = prev.getPrev()
-		} else {
-			break
-		}
+	if flt.chain != nil {
+		flt.chain.mtx.RLock()
+		defer flt.chain.mtx.RUnlock()
+	}
+
+	prev := flt.prev
+	for prev != nil && !prev.handler.IsOutBound() {
+		prev = prev.prev
 	}
 	return prev
 }
 
+// move the filter of the write with a future to the next out bound filter,
+// return false if none, the links are read under the chain lock once
+func (flt *IoFilter) moveToNextOutBound() bool {
+	if flt.chain != nil {
+		flt.chain.mtx.RLock()
+		defer flt.chain.mtx.RUnlock()
+	}
+
+	prev := flt.prev
+	for prev != nil && !prev.handler.IsOutBound() {
+		prev = prev.prev
+	}
+	if prev == nil {
+		return false
+	}
+
+	flt.name = prev.name
+	flt.handler = prev.handler
+	flt.next = prev.next
+	flt.prev = prev.prev
+	flt.conn = prev.conn
+	return true
+}
+
 // get the handler of the filter
 func (flt *IoFilter) getHandler() IoHandler {
 	return flt.handler
@@ -63,7 +151,13 @@ func (flt *IoFilter) setNext(filter *IoFilter) {
 }
 
 // get the next filter
+// the link is read under the chain lock, so the chain can be edited
+// while events are travelling through it
 func (flt *IoFilter) getNext() *IoFilter {
+	if flt.chain != nil {
+		flt.chain.mtx.RLock()
+		defer flt.chain.mtx.RUnlock()
+	}
 	return flt.next
 }
 
@@ -74,15 +168,54 @@ func (flt *IoFilter) setPrev(filter *IoFilter) {
 
 // get the previous filter
 func (flt *IoFilter) getPrev() *IoFilter {
+	if flt.chain != nil {
+		flt.chain.mtx.RLock()
+		defer flt.chain.mtx.RUnlock()
+	}
 	return flt.prev
 }
 
+// recover the panic of the handler of this filter
+// and fire it to the same handler as an exception
+func (flt *IoFilter) recoverPanic() {
+	if p := recover(); p != nil {
+		flt.invokeExceptionCaught(&PanicError{Value: p, Stack: debug.Stack()})
+	}
+}
+
+// recover the panic of the out bound handler of this filter
+// and fire it from the head of the chain, so the in bound handlers can see it
+func (flt *IoFilter) recoverWritePanic() {
+	if p := recover(); p != nil {
+		err := &PanicError{Value: p, Stack: debug.Stack()}
+		flt.FailWrite(err)
+		if flt.chain != nil {
+			flt.chain.FireExceptionCaught(err)
+		} else {
+			flt.invokeExceptionCaught(err)
+		}
+	}
+}
+
+// invoke the exception caught of the handler
+// a panic inside it is only logged, it won't be fired again
+func (flt *IoFilter) invokeExceptionCaught(err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			flt.Logger().Log(LvlError, "panic in exception caught", "panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+
+	flt.getHandler().ExceptionCaught(flt, err)
+}
+
 // Connection opened
 // The event fired when the server accept a new connection
 // or the client client server
 func (flt *IoFilter) ConnOpened() {
 	next := flt.findNextInBoundFilter()
 	if next != nil {
+		defer next.recoverPanic()
 		next.getHandler().ConnOpened(next)
 	}
 }
@@ -91,26 +224,114 @@ func (flt *IoFilter) ConnOpened() {
 func (flt *IoFilter) ConnClosed() {
 	next := flt.findNextInBoundFilter()
 	if next != nil {
+		defer next.recoverPanic()
 		next.getHandler().ConnClosed(next)
 	}
 }
 
+// Connection closing
+func (flt *IoFilter) ConnClosing() {
+	next := flt.findNextInBoundFilter()
+	if next != nil {
+		defer next.recoverPanic()
+		next.getHandler().ConnClosing(next)
+	}
+}
+
 // The event fired when receive message from the connection
 func (flt *IoFilter) MessageReceived(obj BaseObject) {
-	next := flt.findNextInBoundFilter()
+	next, last := flt.findNextInBound()
+	if con := flt.GetCon(); next != nil && con != nil && last {
+		con.metrics.addMessageIn()
+	}
 	if next != nil {
+		defer next.recoverPanic()
 		next.getHandler().MessageReceived(next, obj)
 	}
 }
 
 // The event fire write
 func (flt *IoFilter) FireWrite(obj BaseObject) {
+	if flt.write != nil {
+		flt.fireWriteWithFuture(obj)
+		return
+	}
+
 	next := flt.findNextOutBoundFilter()
 	if next != nil {
+		defer next.recoverWritePanic()
 		next.getHandler().FireWrite(next, obj)
 	}
 }
 
+// fire the write with a future, the filter of the write is moved to the next out bound filter
+// and back after the handler returned, so no filter is copied for each hop
+func (flt *IoFilter) fireWriteWithFuture(obj BaseObject) {
+	saved := *flt
+	defer func() {
+		*flt = saved
+	}()
+
+	if !flt.moveToNextOutBound() {
+		return
+	}
+	defer flt.recoverWritePanic()
+	flt.getHandler().FireWrite(flt, obj)
+}
+
+// Fire Write with a future
+// the future completes when all the packets the message encoded to are written to the connection,
+// or fails with the first error
+func (flt *IoFilter) FireWriteAsync(obj BaseObject) *WriteFuture {
+	future := newWriteFuture()
+
+	// the filter of the write lives in the future, it's valid until the firing returns
+	future.filter = *flt
+	future.filter.write = future
+	future.filter.FireWrite(obj)
+	future.filter = IoFilter{}
+
+	future.fired()
+	return future
+}
+
+// fail the future of the write being fired, the handler calls it when it drops the message
+// nothing happens if the write has no future, and false is returned
+func (flt *IoFilter) FailWrite(err error) bool {
+	if flt.write != nil {
+		flt.write.fail(err)
+		return true
+	}
+	return false
+}
+
+// The event fired when an error is reported or a panic is recovered
+// pass the error to the next in bound filter
+func (flt *IoFilter) ExceptionCaught(err error) {
+	next := flt.findNextInBoundFilter()
+	if next != nil {
+		next.invokeExceptionCaught(err)
+	}
+}
+
+// The event fired when the connection has been idle for the configured time
+func (flt *IoFilter) SessionIdle(status IdleStatus) {
+	next := flt.findNextInBoundFilter()
+	if next != nil {
+		defer next.recoverPanic()
+		next.getHandler().SessionIdle(next, status)
+	}
+}
+
+// The event fired when the queued bytes cross the write watermarks
+func (flt *IoFilter) WritabilityChanged(writable bool) {
+	next := flt.findNextInBoundFilter()
+	if next != nil {
+		defer next.recoverPanic()
+		next.getHandler().WritabilityChanged(next, writable)
+	}
+}
+
 // the head filter
 type HeadHandler struct {
 	IoHandlerImp
@@ -126,7 +347,7 @@ func newHeadHandler() *HeadHandler {
 // Fire Write
 func (hh *HeadHandler) FireWrite(filter *IoFilter, obj BaseObject) {
 	buffer := obj.(*bytes.Buffer)
-	filter.GetCon().Flush(buffer, 0)
+	filter.GetCon().flushWriteBuffer(buffer, filter.write)
 }
 
 // Clone
@@ -148,9 +369,20 @@ func newTailHandler() *TailHandler {
 
 // The event fired when receive message from the connection
 func (th *TailHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
-	// todo clear the buffer
-	buffer := obj.(*bytes.Buffer)
-	buffer.Reset()
+	// clear the buffer, the decoded typed messages need nothing
+	if buffer, ok := obj.(*bytes.Buffer); ok {
+		buffer.Reset()
+	}
+}
+
+// The exception reached the tail, no handler dealt with it
+// log the error and close the connection
+func (th *TailHandler) ExceptionCaught(filter *IoFilter, err error) {
+	logExceptionCaught(filter, "exception reached the tail of the chain, close the connection", err)
+
+	if con := filter.GetCon(); con != nil {
+		con.Close()
+	}
 }
 
 // Clone
@@ -159,13 +391,20 @@ func (th *TailHandler) Clone() IoHandler {
 }
 
 type IoFilterChain struct {
-	conn *Tcpcon   // the connection
-	head *IoFilter // the head io filter
-	tail *IoFilter // the tail io filter
+	conn          *Tcpcon       // the connection
+	head          *IoFilter     // the head io filter
+	tail          *IoFilter     // the tail io filter
+	lastInBound   *IoFilter     // the last in bound filter before the tail, the messages reach it are counted
+	mtx           *sync.RWMutex // guard the links between the filters
+	pooledBuffers bool          // the codecs use the pooled buffers, the handlers don't keep them
 }
 
 // New IoFilter Chain Instance
 func NewIoFilterChain(con *Tcpcon) *IoFilterChain {
+	chain := &IoFilterChain{
+		conn: con,
+		mtx:  &sync.RWMutex{},
+	}
 
 	headFilter := &IoFilter{
 		name:    "head",
@@ -173,6 +412,7 @@ func NewIoFilterChain(con *Tcpcon) *IoFilterChain {
 		next:    nil,
 		prev:    nil,
 		conn:    con,
+		chain:   chain,
 	}
 
 	tailFilter := &IoFilter{
@@ -181,35 +421,52 @@ func NewIoFilterChain(con *Tcpcon) *IoFilterChain {
 		next:    nil,
 		prev:    nil,
 		conn:    con,
+		chain:   chain,
 	}
 
-	headFilter.setNext(tailFilter)
-	tailFilter.setPrev(headFilter)
+	headFilter.next = tailFilter
+	tailFilter.prev = headFilter
 
-	return &IoFilterChain{
-		conn: con,
-		head: headFilter,
-		tail: tailFilter,
-	}
+	chain.head = headFilter
+	chain.tail = tailFilter
+	chain.lastInBound = tailFilter
+
+	return chain
 }
 
 // Clone
 func (fc *IoFilterChain) NewInstanceAndClone(con *Tcpcon) *IoFilterChain {
-	chain := NewIoFilterChain(con)
+	// take a snapshot first, so the clone never runs under the lock
+	fc.mtx.RLock()
+	names := []string{}
+	handlers := []IoHandler{}
+	for filter := fc.head.next; filter != fc.tail; filter = filter.next {
+		names = append(names, filter.name)
+		handlers = append(handlers, filter.handler)
+	}
+	fc.mtx.RUnlock()
 
-	filter := fc.head.getNext()
-	for {
-		if filter != fc.tail {
-			chain.AddLast(filter.name, filter.getHandler().Clone())
-			filter = filter.getNext()
-		} else {
-			break
-		}
+	chain := NewIoFilterChain(con)
+	chain.pooledBuffers = fc.pooledBuffers
+	for i, name := range names {
+		chain.AddLast(name, handlers[i].Clone())
 	}
 
 	return chain
 }
 
+// set whether the codecs use the pooled buffers, it's off by default
+// the pooled buffers received or written are released after the events returned,
+// so set it true before the connections started only if no handler retains the buffers
+func (fc *IoFilterChain) SetPooledBuffers(pooled bool) {
+	fc.pooledBuffers = pooled
+}
+
+// is the codecs use the pooled buffers
+func (fc *IoFilterChain) IsPooledBuffers() bool {
+	return fc.pooledBuffers
+}
+
 // get head
 func (fc *IoFilterChain) GetHeadFilter() *IoFilter {
 	return fc.head
@@ -227,34 +484,195 @@ func (fc *IoFilterChain) getCon() *Tcpcon {
 
 // set the connction
 func (fc *IoFilterChain) setCon(con *Tcpcon) {
-	filter := fc.head
-	for {
-		if filter != nil {
-			filter.SetCon(con)
-			filter = filter.getNext()
-		} else {
-			break
-		}
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	for filter := fc.head; filter != nil; filter = filter.next {
+		filter.SetCon(con)
 	}
 
 	fc.conn = con
 }
 
-// add last
-// add the filter to the last
-func (fc *IoFilterChain) AddLast(filterName string, ioHandler IoHandler) {
-	filter := &IoFilter{
+// new a filter belongs to the chain
+func (fc *IoFilterChain) newFilter(filterName string, ioHandler IoHandler) *IoFilter {
+	return &IoFilter{
 		name:    filterName,
 		handler: ioHandler,
 		next:    nil,
 		prev:    nil,
 		conn:    fc.conn,
+		chain:   fc,
+	}
+}
+
+// find the filter by name, the caller must hold the lock
+func (fc *IoFilterChain) find(filterName string) *IoFilter {
+	for filter := fc.head.next; filter != fc.tail; filter = filter.next {
+		if filter.name == filterName {
+			return filter
+		}
+	}
+	return nil
+}
+
+// link the filter between prev and next, the caller must hold the lock
+func (fc *IoFilterChain) link(prev *IoFilter, next *IoFilter, filter *IoFilter) {
+	filter.prev = prev
+	filter.next = next
+	prev.next = filter
+	next.prev = filter
+	fc.updateLastInBound()
+}
+
+// unlink the filter, the caller must hold the lock
+// the links of the removed filter itself are kept, so an event
+// which is passing through it still reaches the rest of the chain
+func (fc *IoFilterChain) unlink(filter *IoFilter) {
+	filter.prev.next = filter.next
+	filter.next.prev = filter.prev
+	fc.updateLastInBound()
+}
+
+// find the last in bound filter before the tail, the tail if none, the caller must hold the lock
+func (fc *IoFilterChain) updateLastInBound() {
+	fc.lastInBound = fc.tail
+	for filter := fc.tail.prev; filter != fc.head; filter = filter.prev {
+		if filter.getHandler().IsInBound() {
+			fc.lastInBound = filter
+			return
+		}
+	}
+}
+
+// add first
+// add the filter right after the head
+func (fc *IoFilterChain) AddFirst(filterName string, ioHandler IoHandler) error {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	if fc.find(filterName) != nil {
+		return ErrFilterNameDuplicate
 	}
 
-	filter.setPrev(fc.tail.getPrev())
-	filter.setNext(fc.tail)
-	fc.tail.getPrev().setNext(filter)
-	fc.tail.setPrev(filter)
+	fc.link(fc.head, fc.head.next, fc.newFilter(filterName, ioHandler))
+	return nil
+}
+
+// add last
+// add the filter to the last
+// the name is not checked as before, the filter got by a duplicate name is the first one
+func (fc *IoFilterChain) AddLast(filterName string, ioHandler IoHandler) {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	fc.link(fc.tail.prev, fc.tail, fc.newFilter(filterName, ioHandler))
+}
+
+// add before
+// add the filter before the filter named baseName
+func (fc *IoFilterChain) AddBefore(baseName string, filterName string, ioHandler IoHandler) error {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	base := fc.find(baseName)
+	if base == nil {
+		return ErrFilterNotFound
+	}
+
+	if fc.find(filterName) != nil {
+		return ErrFilterNameDuplicate
+	}
+
+	fc.link(base.prev, base, fc.newFilter(filterName, ioHandler))
+	return nil
+}
+
+// add after
+// add the filter after the filter named baseName
+func (fc *IoFilterChain) AddAfter(baseName string, filterName string, ioHandler IoHandler) error {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	base := fc.find(baseName)
+	if base == nil {
+		return ErrFilterNotFound
+	}
+
+	if fc.find(filterName) != nil {
+		return ErrFilterNameDuplicate
+	}
+
+	fc.link(base, base.next, fc.newFilter(filterName, ioHandler))
+	return nil
+}
+
+// remove
+// remove the filter by name, return the handler of the removed filter
+func (fc *IoFilterChain) Remove(filterName string) (IoHandler, error) {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	filter := fc.find(filterName)
+	if filter == nil {
+		return nil, ErrFilterNotFound
+	}
+
+	fc.unlink(filter)
+	return filter.handler, nil
+}
+
+// replace
+// replace the filter named oldName with a new filter, return the handler of the replaced filter
+func (fc *IoFilterChain) Replace(oldName string, newName string, ioHandler IoHandler) (IoHandler, error) {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	old := fc.find(oldName)
+	if old == nil {
+		return nil, ErrFilterNotFound
+	}
+
+	if newName != oldName && fc.find(newName) != nil {
+		return nil, ErrFilterNameDuplicate
+	}
+
+	fc.link(old.prev, old.next, fc.newFilter(newName, ioHandler))
+	return old.handler, nil
+}
+
+// get
+// get the filter by name, return nil if not found
+func (fc *IoFilterChain) Get(filterName string) *IoFilter {
+	fc.mtx.RLock()
+	defer fc.mtx.RUnlock()
+
+	return fc.find(filterName)
+}
+
+// names
+// get the names of all filters between the head and the tail
+func (fc *IoFilterChain) Names() []string {
+	fc.mtx.RLock()
+	defer fc.mtx.RUnlock()
+
+	names := []string{}
+	for filter := fc.head.next; filter != fc.tail; filter = filter.next {
+		names = append(names, filter.name)
+	}
+	return names
+}
+
+// get the handlers of all filters between the head and the tail
+func (fc *IoFilterChain) handlers() []IoHandler {
+	fc.mtx.RLock()
+	defer fc.mtx.RUnlock()
+
+	handlers := []IoHandler{}
+	for filter := fc.head.next; filter != fc.tail; filter = filter.next {
+		handlers = append(handlers, filter.handler)
+	}
+	return handlers
 }
 
 // fire the connection opened event at the chain
@@ -267,6 +685,11 @@ func (fc *IoFilterChain) FireConnClosed() {
 	fc.head.ConnClosed()
 }
 
+// Connection closing
+func (fc *IoFilterChain) FireConnClosing() {
+	fc.head.ConnClosing()
+}
+
 // The event fired when receive message from the connection
 func (fc *IoFilterChain) FireMessageReceived(obj BaseObject) {
 	fc.head.MessageReceived(obj)
@@ -276,3 +699,23 @@ func (fc *IoFilterChain) FireMessageReceived(obj BaseObject) {
 func (fc *IoFilterChain) FireWrite(obj BaseObject) {
 	fc.tail.FireWrite(obj)
 }
+
+// Fire Write with a future, see IoFilter.FireWriteAsync
+func (fc *IoFilterChain) FireWriteAsync(obj BaseObject) *WriteFuture {
+	return fc.tail.FireWriteAsync(obj)
+}
+
+// fire the session idle event at the chain
+func (fc *IoFilterChain) FireSessionIdle(status IdleStatus) {
+	fc.head.SessionIdle(status)
+}
+
+// fire the writability changed event at the chain
+func (fc *IoFilterChain) FireWritabilityChanged(writable bool) {
+	fc.head.WritabilityChanged(writable)
+}
+
+// fire the exception caught event at the chain
+func (fc *IoFilterChain) FireExceptionCaught(err error) {
+	fc.head.ExceptionCaught(err)
+}
@@ -0,0 +1,340 @@
+// File IoFilter test
+
+package gonetio
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// count the messages passing through, and pass them on
+type countingHandler struct {
+	IoHandlerAdaptor
+	count int64
+}
+
+func newCountingHandler() *countingHandler {
+	handler := &countingHandler{}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *countingHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	atomic.AddInt64(&this.count, 1)
+	filter.MessageReceived(obj)
+}
+
+func (this *countingHandler) Clone() IoHandler {
+	return newCountingHandler()
+}
+
+// new a chain of the connection never started
+func newTestChain() *IoFilterChain {
+	return NewIoFilterChain(NewConn(nil, 0, &sync.WaitGroup{}, 0))
+}
+
+func TestIoFilterChainEdit(t *testing.T) {
+	chain := newTestChain()
+	a, b, c, d := newCountingHandler(), newCountingHandler(), newCountingHandler(), newCountingHandler()
+
+	steps := []struct {
+		name  string
+		edit  func() error
+		err   error
+		names []string
+	}{
+		{"add last", func() error { chain.AddLast("b", b); return nil }, nil, []string{"b"}},
+		{"add first", func() error { return chain.AddFirst("a", a) }, nil, []string{"a", "b"}},
+		{"add after", func() error { return chain.AddAfter("b", "d", d) }, nil, []string{"a", "b", "d"}},
+		{"add before", func() error { return chain.AddBefore("d", "c", c) }, nil, []string{"a", "b", "c", "d"}},
+		{"add duplicate", func() error { return chain.AddFirst("c", c) }, ErrFilterNameDuplicate, []string{"a", "b", "c", "d"}},
+		{"add after missing", func() error { return chain.AddAfter("x", "y", c) }, ErrFilterNotFound, []string{"a", "b", "c", "d"}},
+		{"add before duplicate", func() error { return chain.AddBefore("a", "d", c) }, ErrFilterNameDuplicate, []string{"a", "b", "c", "d"}},
+		{"remove", func() error { _, err := chain.Remove("b"); return err }, nil, []string{"a", "c", "d"}},
+		{"remove missing", func() error { _, err := chain.Remove("b"); return err }, ErrFilterNotFound, []string{"a", "c", "d"}},
+		{"replace", func() error { _, err := chain.Replace("c", "b", b); return err }, nil, []string{"a", "b", "d"}},
+		{"replace same name", func() error { _, err := chain.Replace("b", "b", c); return err }, nil, []string{"a", "b", "d"}},
+		{"replace duplicate", func() error { _, err := chain.Replace("a", "d", c); return err }, ErrFilterNameDuplicate, []string{"a", "b", "d"}},
+		{"replace missing", func() error { _, err := chain.Replace("x", "y", c); return err }, ErrFilterNotFound, []string{"a", "b", "d"}},
+	}
+
+	for _, step := range steps {
+		if err := step.edit(); !errors.Is(err, step.err) {
+			t.Fatalf("%s: err %v, expect %v", step.name, err, step.err)
+		}
+		if names := chain.Names(); !reflect.DeepEqual(names, step.names) {
+			t.Fatalf("%s: names %v, expect %v", step.name, names, step.names)
+		}
+	}
+
+	if filter := chain.Get("b"); filter == nil || filter.GetHandler() != IoHandler(c) {
+		t.Fatal("get b is not the handler replaced with")
+	}
+	if chain.Get("x") != nil {
+		t.Fatal("get the filter not added")
+	}
+
+	chain.FireMessageReceived(1)
+	if a.count != 1 || c.count != 1 || d.count != 1 || b.count != 0 {
+		t.Fatalf("counts a %d, b %d, c %d, d %d after one message", a.count, b.count, c.count, d.count)
+	}
+}
+
+func TestIoFilterChainCloneAfterEdit(t *testing.T) {
+	chain := newTestChain()
+	chain.AddLast("b", newCountingHandler())
+	chain.AddFirst("a", newCountingHandler())
+	chain.AddAfter("a", "c", newCountingHandler())
+	chain.Remove("b")
+	chain.SetPooledBuffers(true)
+
+	clone := chain.NewInstanceAndClone(NewConn(nil, 0, &sync.WaitGroup{}, 0))
+	if names := clone.Names(); !reflect.DeepEqual(names, []string{"a", "c"}) {
+		t.Fatalf("clone names %v", names)
+	}
+	if !clone.IsPooledBuffers() {
+		t.Fatal("clone lost the pooled buffers flag")
+	}
+
+	for _, name := range clone.Names() {
+		if clone.Get(name).GetHandler() == chain.Get(name).GetHandler() {
+			t.Fatalf("clone shares the handler %s", name)
+		}
+	}
+
+	// the edits of the clone don't change the original
+	clone.AddLast("d", newCountingHandler())
+	if names := chain.Names(); !reflect.DeepEqual(names, []string{"a", "c"}) {
+		t.Fatalf("names %v after the clone edited", names)
+	}
+}
+
+// the chain is edited and cloned while the messages are fired through it,
+// the handlers never removed receive all the messages
+func TestIoFilterChainEditWhileFiring(t *testing.T) {
+	const (
+		messages = 5000
+		editors  = 4
+		edits    = 500
+	)
+
+	chain := newTestChain()
+	first, sink := newCountingHandler(), newCountingHandler()
+	chain.AddLast("first", first)
+	chain.AddLast("sink", sink)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for j := 0; j < edits; j++ {
+				if err := chain.AddAfter("first", name, newCountingHandler()); err != nil {
+					t.Errorf("add %s failed, %v", name, err)
+					return
+				}
+				if _, err := chain.Replace(name, name, newCountingHandler()); err != nil {
+					t.Errorf("replace %s failed, %v", name, err)
+					return
+				}
+				if _, err := chain.Remove(name); err != nil {
+					t.Errorf("remove %s failed, %v", name, err)
+					return
+				}
+			}
+		}(fmt.Sprintf("edit%d", i))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < edits; j++ {
+			chain.NewInstanceAndClone(nil)
+		}
+	}()
+
+	for i := 0; i < messages; i++ {
+		chain.FireMessageReceived(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&first.count) != messages || atomic.LoadInt64(&sink.count) != messages {
+		t.Fatalf("first received %d, sink received %d, expect %d", first.count, sink.count, messages)
+	}
+	if names := chain.Names(); !reflect.DeepEqual(names, []string{"first", "sink"}) {
+		t.Fatalf("names %v after the edits", names)
+	}
+}
+
+// record the names of the filter seen in FireWrite, before and after passing it on
+type namingHandler struct {
+	IoHandlerAdaptor
+	names *[]string
+	pass  bool
+}
+
+func newNamingHandler(names *[]string, pass bool) *namingHandler {
+	handler := &namingHandler{names: names, pass: pass}
+	handler.SetBoundType(OutBound)
+	return handler
+}
+
+func (this *namingHandler) FireWrite(filter *IoFilter, obj BaseObject) {
+	*this.names = append(*this.names, filter.GetName())
+	if this.pass {
+		filter.FireWrite(obj)
+		*this.names = append(*this.names, filter.GetName())
+	}
+}
+
+// the filter of a write with a future is moved along the chain, each handler sees its own
+func TestIoFilterChainWriteWithFuture(t *testing.T) {
+	names := []string{}
+	chain := newTestChain()
+	chain.AddLast("a", newNamingHandler(&names, true))
+	chain.AddLast("b", newNamingHandler(&names, true))
+	chain.AddFirst("sink", newNamingHandler(&names, false))
+
+	if err := chain.FireWriteAsync(1).Wait(); !errors.Is(err, ErrWriteNotQueued) {
+		t.Fatalf("err %v, expect ErrWriteNotQueued", err)
+	}
+	if expect := []string{"b", "a", "sink", "a", "b"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("names %v, expect %v", names, expect)
+	}
+}
+
+// add last keeps the duplicate names as before, the first one is got by the name
+func TestIoFilterChainAddLastDuplicate(t *testing.T) {
+	chain := newTestChain()
+	first, second := newCountingHandler(), newCountingHandler()
+	chain.AddLast("a", first)
+	chain.AddLast("a", second)
+
+	if names := chain.Names(); !reflect.DeepEqual(names, []string{"a", "a"}) {
+		t.Fatalf("names %v", names)
+	}
+	if chain.Get("a").GetHandler() != IoHandler(first) {
+		t.Fatal("get a is not the first added")
+	}
+}
+
+// panic in the events of the bound
+type panickingHandler struct {
+	IoHandlerAdaptor
+}
+
+func newPanickingHandler(boundType int) *panickingHandler {
+	handler := &panickingHandler{}
+	handler.SetBoundType(boundType)
+	return handler
+}
+
+func (this *panickingHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	panic("boom in")
+}
+
+func (this *panickingHandler) FireWrite(filter *IoFilter, obj BaseObject) {
+	panic("boom out")
+}
+
+// record the exceptions and the messages reached
+type catchingHandler struct {
+	IoHandlerImp
+	errs     []error
+	messages int
+}
+
+func newCatchingHandler() *catchingHandler {
+	handler := &catchingHandler{}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *catchingHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	this.messages++
+}
+
+func (this *catchingHandler) ExceptionCaught(filter *IoFilter, err error) {
+	this.errs = append(this.errs, err)
+}
+
+// check the exceptions caught are one panic error of the value
+func checkPanicCaught(t *testing.T, errs []error, value string) {
+	t.Helper()
+
+	if len(errs) != 1 {
+		t.Fatalf("caught %v, expect one panic", errs)
+	}
+
+	var pe *PanicError
+	if !errors.As(errs[0], &pe) {
+		t.Fatalf("caught %T, expect *PanicError", errs[0])
+	}
+	if pe.Value != value || pe.Error() != "handler panic: "+value {
+		t.Fatalf("panic error value %v, message %q", pe.Value, pe.Error())
+	}
+	if !strings.Contains(string(pe.Stack), "panickingHandler") {
+		t.Fatalf("the stack has no frame of the handler panicked:\n%s", pe.Stack)
+	}
+}
+
+// the panic of an in bound handler goes to its ExceptionCaught, the rest of the chain is not reached
+func TestPanicInBound(t *testing.T) {
+	catcher := newCatchingHandler()
+	chain := newTestChain()
+	chain.AddLast("panic", newPanickingHandler(InBound))
+	chain.AddLast("catcher", catcher)
+
+	chain.FireMessageReceived(1)
+	checkPanicCaught(t, catcher.errs, "boom in")
+	if catcher.messages != 0 {
+		t.Fatal("the message passed the handler panicked")
+	}
+
+	// the chain still works after the panic
+	chain.Remove("panic")
+	chain.FireMessageReceived(1)
+	if catcher.messages != 1 {
+		t.Fatal("the message is lost after the panic")
+	}
+}
+
+// the panic of an out bound handler fails the write, and is fired from the head to the in bound handlers
+func TestPanicOutBound(t *testing.T) {
+	catcher := newCatchingHandler()
+	chain := newTestChain()
+	chain.AddLast("catcher", catcher)
+	chain.AddLast("panic", newPanickingHandler(OutBound))
+
+	err := chain.FireWriteAsync(1).Wait()
+	checkPanicCaught(t, []error{err}, "boom out")
+	checkPanicCaught(t, catcher.errs, "boom out")
+}
+
+// the exception nobody handled closes the connection
+func TestExceptionDefaultClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler IoHandler
+	}{
+		{"reach the tail", newPanickingHandler(InBound)},
+		{"default handler", newHandler(InBound)},
+	}
+
+	for _, test := range tests {
+		con, _ := startSendQueueCon(t, 16, test.handler, func(*Tcpcon) {})
+		con.GetIoFilterChain().FireExceptionCaught(errors.New("test"))
+
+		select {
+		case <-con.Done():
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: the connection is not closed by the exception", test.name)
+		}
+	}
+}
@@ -7,6 +7,28 @@ package gonetio
 type BaseObject interface {
 }
 
+// idle status
+type IdleStatus int
+
+const (
+	ReaderIdle IdleStatus = iota // nothing read for a while
+	WriterIdle                   // nothing written for a while
+	AllIdle                      // neither read nor written for a while
+)
+
+func (status IdleStatus) String() string {
+	switch status {
+	case ReaderIdle:
+		return "reader idle"
+	case WriterIdle:
+		return "writer idle"
+	case AllIdle:
+		return "all idle"
+	}
+
+	return "unknown"
+}
+
 type IoHandler interface {
 
 	// Connection opened
@@ -17,12 +39,31 @@ type IoHandler interface {
 	// Connection closed
 	ConnClosed(*IoFilter)
 
+	// Connection closing
+	// The event fired when the acceptor shuts down gracefully, before the
+	// connection drains its send queue, the last chance to send a goodbye message
+	ConnClosing(*IoFilter)
+
 	// The event fired when receive message from the connection
 	MessageReceived(con *IoFilter, obj BaseObject)
 
 	// Fire Write
+	// the filter of a write with a future is valid until FireWrite returns, don't keep it
 	FireWrite(con *IoFilter, obj BaseObject)
 
+	// The event fired when an error is reported or a panic is recovered
+	// from a handler of the chain
+	ExceptionCaught(con *IoFilter, err error)
+
+	// The event fired when the connection has been idle for the configured time
+	SessionIdle(con *IoFilter, status IdleStatus)
+
+	// The event fired when the queued bytes reach the high watermark, writable is false,
+	// or fall to the low watermark again, writable is true.
+	// the unwritable one is fired in the goroutine writing, the writable one on its own goroutine,
+	// never in the write loop, so the handler may resume writing in it
+	WritabilityChanged(con *IoFilter, writable bool)
+
 	// is in bound handler
 	IsInBound() bool
 
@@ -59,6 +100,10 @@ func (this *IoHandlerImp) ConnOpened(*IoFilter) {
 func (this *IoHandlerImp) ConnClosed(*IoFilter) {
 }
 
+// Connection closing
+func (this *IoHandlerImp) ConnClosing(*IoFilter) {
+}
+
 // The event fired when receive message from the connection
 func (this *IoHandlerImp) MessageReceived(filter *IoFilter, obj BaseObject) {
 }
@@ -67,6 +112,24 @@ func (this *IoHandlerImp) MessageReceived(filter *IoFilter, obj BaseObject) {
 func (this *IoHandlerImp) FireWrite(filter *IoFilter, obj BaseObject) {
 }
 
+// The event fired when an error is reported or a panic is recovered
+// default log the error and close the connection
+func (this *IoHandlerImp) ExceptionCaught(filter *IoFilter, err error) {
+	logExceptionCaught(filter, "exception caught, close the connection", err)
+
+	if con := filter.GetCon(); con != nil {
+		con.Close()
+	}
+}
+
+// The event fired when the connection has been idle for the configured time
+func (this *IoHandlerImp) SessionIdle(filter *IoFilter, status IdleStatus) {
+}
+
+// The event fired when the queued bytes cross the write watermarks
+func (this *IoHandlerImp) WritabilityChanged(filter *IoFilter, writable bool) {
+}
+
 // is in bound handler
 func (this *IoHandlerImp) IsInBound() bool {
 	return this.boundType&InBound != 0
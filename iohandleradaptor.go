@@ -20,6 +20,11 @@ func (this *IoHandlerAdaptor) ConnClosed(filter *IoFilter) {
 	filter.ConnClosed()
 }
 
+// Connection closing
+func (this *IoHandlerAdaptor) ConnClosing(filter *IoFilter) {
+	filter.ConnClosing()
+}
+
 // The event fired when receive message from the connection
 func (this *IoHandlerAdaptor) MessageReceived(filter *IoFilter, obj BaseObject) {
 	filter.MessageReceived(obj)
@@ -29,3 +34,18 @@ func (this *IoHandlerAdaptor) MessageReceived(filter *IoFilter, obj BaseObject)
 func (this *IoHandlerAdaptor) FireWrite(filter *IoFilter, obj BaseObject) {
 	filter.FireWrite(obj)
 }
+
+// The event fired when an error is reported or a panic is recovered
+func (this *IoHandlerAdaptor) ExceptionCaught(filter *IoFilter, err error) {
+	filter.ExceptionCaught(err)
+}
+
+// The event fired when the connection has been idle for the configured time
+func (this *IoHandlerAdaptor) SessionIdle(filter *IoFilter, status IdleStatus) {
+	filter.SessionIdle(status)
+}
+
+// The event fired when the queued bytes cross the write watermarks
+func (this *IoHandlerAdaptor) WritabilityChanged(filter *IoFilter, writable bool) {
+	filter.WritabilityChanged(writable)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -102,15 +103,15 @@ type Logger struct {
 }
 
 func (this *Logger) setLogLvl(lvl LogLevel) {
-	this.log_lvl = lvl
+	atomic.StoreUint32((*uint32)(&this.log_lvl), uint32(lvl))
 }
 
 func (this *Logger) getLogLvl() LogLevel {
-	return this.log_lvl
+	return LogLevel(atomic.LoadUint32((*uint32)(&this.log_lvl)))
 }
 
 func (this *Logger) shouldLog(lvl LogLevel) bool {
-	return lvl >= this.log_lvl
+	return lvl >= this.getLogLvl()
 }
 
 func (this *Logger) log_msg(lvl LogLevel, format string, args ...interface{}) {
@@ -148,6 +149,7 @@ func init() {
 		log_lvl:     LvlDebug,
 		log_handler: NewDefaultLoggerHandler(),
 	}
+	SetDefaultLogger(nil)
 }
 
 func SetLogLvl(lvl LogLevel) {
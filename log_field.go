@@ -0,0 +1,180 @@
+// File log_field.go
+
+package gonetio
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// the structured logger with key/value fields
+// the keyvals are alternating keys and values, like slog
+// e.g. logger.Log(LvlInfo, "connection opened", "conID", 1, "remote", "127.0.0.1:80")
+type FieldLogger interface {
+	// is the level enabled
+	Enabled(lvl LogLevel) bool
+
+	// log the message with the fields
+	Log(lvl LogLevel, msg string, keyvals ...interface{})
+
+	// new a child logger with the fields attached to each message
+	With(keyvals ...interface{}) FieldLogger
+}
+
+// the logger renders the fields as key=value pairs after the message
+// and writes the line by the LoggerHandler
+type TextLogger struct {
+	logger *Logger // the level and the handler, shared with the children
+	fields string  // the rendered fields attached
+}
+
+// new text logger with its own level and handler
+// the handler is the default handler printing to stdout if nil
+func NewTextLogger(lvl LogLevel, handler LoggerHandler) *TextLogger {
+	if handler == nil {
+		handler = NewDefaultLoggerHandler()
+	}
+
+	return &TextLogger{
+		logger: &Logger{
+			log_lvl:     lvl,
+			log_handler: handler,
+		},
+	}
+}
+
+// set the log level, the children share it
+func (this *TextLogger) SetLogLvl(lvl LogLevel) {
+	this.logger.setLogLvl(lvl)
+}
+
+// Enabled
+func (this *TextLogger) Enabled(lvl LogLevel) bool {
+	return this.logger.shouldLog(lvl)
+}
+
+// Log
+func (this *TextLogger) Log(lvl LogLevel, msg string, keyvals ...interface{}) {
+	if !this.logger.shouldLog(lvl) {
+		return
+	}
+
+	line := msg + this.fields
+	if len(keyvals) > 0 {
+		line += formatFields(keyvals)
+	}
+	this.logger.log_msg(lvl, "%s", line)
+}
+
+// With
+func (this *TextLogger) With(keyvals ...interface{}) FieldLogger {
+	return &TextLogger{
+		logger: this.logger,
+		fields: this.fields + formatFields(keyvals),
+	}
+}
+
+// render the keyvals as " key=value" pairs
+func formatFields(keyvals []interface{}) string {
+	builder := &strings.Builder{}
+	for i := 0; i < len(keyvals); i += 2 {
+		builder.WriteByte(' ')
+		builder.WriteString(fmt.Sprint(keyvals[i]))
+		builder.WriteByte('=')
+		if i+1 < len(keyvals) {
+			builder.WriteString(formatValue(keyvals[i+1]))
+		} else {
+			builder.WriteString("!MISSING")
+		}
+	}
+	return builder.String()
+}
+
+// quote the value if it has spaces or quotes
+func formatValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// the adapter logs to the log/slog logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// new logger logging to the slog logger
+// LvlFatal is logged at slog.LevelError+4
+func NewSlogLogger(logger *slog.Logger) FieldLogger {
+	return &slogLogger{
+		logger: logger,
+	}
+}
+
+// convert to the slog level
+func slogLevel(lvl LogLevel) slog.Level {
+	switch lvl {
+	case LvlDebug:
+		return slog.LevelDebug
+	case LvlInfo:
+		return slog.LevelInfo
+	case LvlWarn:
+		return slog.LevelWarn
+	case LvlError:
+		return slog.LevelError
+	}
+	return slog.LevelError + 4
+}
+
+// Enabled
+func (this *slogLogger) Enabled(lvl LogLevel) bool {
+	return lvl < LvlNone && this.logger.Enabled(context.Background(), slogLevel(lvl))
+}
+
+// Log
+func (this *slogLogger) Log(lvl LogLevel, msg string, keyvals ...interface{}) {
+	if lvl >= LvlNone {
+		return
+	}
+	this.logger.Log(context.Background(), slogLevel(lvl), msg, keyvals...)
+}
+
+// With
+func (this *slogLogger) With(keyvals ...interface{}) FieldLogger {
+	return &slogLogger{
+		logger: this.logger.With(keyvals...),
+	}
+}
+
+// the default logger, shares the level and the handler with the global Log functions
+var default_logger atomic.Value
+
+// the holder makes the stored type of the atomic value fixed
+type fieldLoggerHolder struct {
+	logger FieldLogger
+}
+
+// get the default logger
+// the acceptors, connectors and connections created use it unless SetLogger called
+func DefaultLogger() FieldLogger {
+	return default_logger.Load().(fieldLoggerHolder).logger
+}
+
+// set the default logger, the objects created before keep the old one
+func SetDefaultLogger(logger FieldLogger) {
+	if logger == nil {
+		logger = &TextLogger{logger: internal_logger}
+	}
+	default_logger.Store(fieldLoggerHolder{logger: logger})
+}
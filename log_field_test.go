@@ -0,0 +1,141 @@
+// File log_field.go test
+
+package gonetio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// record the lines logged
+type recordingLoggerHandler struct {
+	mtx   sync.Mutex
+	lines []string
+}
+
+func (this *recordingLoggerHandler) LogMsg(lvl LogLevel, format string, args ...interface{}) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	this.lines = append(this.lines, fmt.Sprintf(format, args...))
+}
+
+// get the lines logged and clear them
+func (this *recordingLoggerHandler) take() []string {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	lines := this.lines
+	this.lines = nil
+	return lines
+}
+
+// expect one line logged
+func (this *recordingLoggerHandler) expectLine(t *testing.T, line string) {
+	t.Helper()
+
+	lines := this.take()
+	if len(lines) != 1 || lines[0] != line {
+		t.Fatalf("lines %q, expect %q", lines, line)
+	}
+}
+
+func TestTextLoggerFields(t *testing.T) {
+	tests := []struct {
+		keyvals []interface{}
+		line    string
+	}{
+		{nil, "msg"},
+		{[]interface{}{"a", 1, "b", true}, "msg a=1 b=true"},
+		{[]interface{}{"text", "hello world"}, `msg text="hello world"`},
+		{[]interface{}{"empty", ""}, `msg empty=""`},
+		{[]interface{}{"quote", `say "hi"`}, `msg quote="say \"hi\""`},
+		{[]interface{}{"err", errors.New("broken pipe")}, `msg err="broken pipe"`},
+		{[]interface{}{"odd"}, "msg odd=!MISSING"},
+	}
+
+	handler := &recordingLoggerHandler{}
+	logger := NewTextLogger(LvlDebug, handler)
+	for _, test := range tests {
+		logger.Log(LvlInfo, "msg", test.keyvals...)
+		handler.expectLine(t, test.line)
+	}
+}
+
+func TestTextLoggerWith(t *testing.T) {
+	handler := &recordingLoggerHandler{}
+	logger := NewTextLogger(LvlInfo, handler)
+	child := logger.With("a", 1)
+	grandChild := child.With("b", "x y")
+
+	grandChild.Log(LvlInfo, "msg", "c", 3)
+	handler.expectLine(t, `msg a=1 b="x y" c=3`)
+
+	// the parents keep their own fields
+	child.Log(LvlInfo, "msg")
+	handler.expectLine(t, "msg a=1")
+	logger.Log(LvlInfo, "msg")
+	handler.expectLine(t, "msg")
+
+	// the children share the level of the parent
+	logger.SetLogLvl(LvlError)
+	grandChild.Log(LvlWarn, "dropped")
+	if lines := handler.take(); len(lines) != 0 {
+		t.Fatalf("lines %q logged below the level", lines)
+	}
+	if grandChild.Enabled(LvlWarn) || !grandChild.Enabled(LvlError) {
+		t.Fatal("the child doesn't follow the level of the parent")
+	}
+}
+
+func TestConnLoggerFields(t *testing.T) {
+	handler := &recordingLoggerHandler{}
+	local, remote := net.Pipe()
+	defer remote.Close()
+	defer local.Close()
+
+	con := NewConnFull(local, 16, &sync.WaitGroup{}, 0)
+	con.SetLogger(NewTextLogger(LvlDebug, handler))
+	con.SetConID(7)
+
+	con.Logger().Log(LvlInfo, "msg", "k", "v")
+	handler.expectLine(t, "msg conID=7 remote=pipe k=v")
+
+	// the filter attaches its name after the connection fields
+	chain := NewIoFilterChain(con)
+	chain.AddLast("codec", newCountingHandler())
+	chain.Get("codec").Logger().Log(LvlInfo, "msg")
+	handler.expectLine(t, "msg conID=7 remote=pipe filter=codec")
+
+	// the connector attaches its name
+	connector := NewConnector("game", 16, 0)
+	connector.SetLogger(NewTextLogger(LvlDebug, handler))
+	connector.GetLogger().Log(LvlInfo, "msg")
+	handler.expectLine(t, "msg connector=game")
+}
+
+func TestSlogLoggerFields(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(output, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.With("conID", 7).With("filter", "codec").Log(LvlWarn, "msg", "k", "v")
+	line := output.String()
+	for _, field := range []string{"level=WARN", "msg=msg", "conID=7", "filter=codec", "k=v"} {
+		if !strings.Contains(line, field) {
+			t.Fatalf("line %q has no %s", line, field)
+		}
+	}
+
+	output.Reset()
+	logger.Log(LvlDebug, "dropped")
+	logger.Log(LvlNone, "dropped")
+	if output.Len() != 0 || logger.Enabled(LvlDebug) || logger.Enabled(LvlNone) {
+		t.Fatalf("logged %q below the level", output.String())
+	}
+}
@@ -0,0 +1,176 @@
+// File Metrics
+
+package gonetio
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// the reason the connection closed
+type CloseReason string
+
+const (
+	CloseReasonLocal       CloseReason = "local"               // closed by this side
+	CloseReasonRemote      CloseReason = "remote"              // closed by the peer
+	CloseReasonReadError   CloseReason = "read_error"          // read failed
+	CloseReasonWriteError  CloseReason = "write_error"         // write failed
+	CloseReasonIdleTimeout CloseReason = "idle_timeout"        // nothing read in the keep alive time
+	CloseReasonShutdown    CloseReason = "shutdown"            // shutdown by this side
+	CloseReasonDrained     CloseReason = "drained"             // closed after the send queue flushed
+	CloseReasonStopped     CloseReason = "stopped"             // the acceptor or the connector stopped
+	CloseReasonOverflow    CloseReason = "send_queue_overflow" // the send queue full with the OverflowClose policy
+)
+
+// the stats snapshot of a connection
+type ConnStats struct {
+	BytesRead          uint64 // the bytes read
+	BytesWritten       uint64 // the bytes written
+	MessagesIn         uint64 // the messages reached the last in bound handler
+	MessagesOut        uint64 // the packets added to the send queue
+	WriteBlockingDrops uint64 // the packets dropped for the send queue full
+	RecvQueueDrops     uint64 // the datagrams dropped for the udp session recv queue full
+	SendQueueDepth     int    // the packets waiting in the send queue
+	SendQueueBytes     int64  // the bytes waiting in the send queue
+}
+
+// the stats snapshot of an acceptor or a connector, the connection stats are the sums of all the connections
+type Stats struct {
+	ConnStats
+	Accepts           uint64                 // the connections accepted, the connects succeeded for the connector
+	AcceptErrors      uint64                 // the accepts failed, the connects failed for the connector
+	ActiveConnections int64                  // the connections opened and not closed
+	CloseReasons      map[CloseReason]uint64 // the connections closed by the reason
+}
+
+// the object has the stats, like TcpAcceptor, TcpConnector and UdpAcceptor
+type StatsSource interface {
+	Stats() Stats
+}
+
+// the counters of a connection, an acceptor or a connector
+// the connection counters add to the parent ones too
+type metrics struct {
+	bytesRead          uint64
+	bytesWritten       uint64
+	messagesIn         uint64
+	messagesOut        uint64
+	writeBlockingDrops uint64
+	recvQueueDrops     uint64
+	accepts            uint64
+	acceptErrors       uint64
+	activeConnections  int64
+	parent             *metrics
+	closeMtx           *sync.Mutex
+	closeReasons       map[CloseReason]uint64
+}
+
+// new metrics
+func newMetrics() *metrics {
+	return &metrics{
+		closeMtx:     &sync.Mutex{},
+		closeReasons: make(map[CloseReason]uint64),
+	}
+}
+
+func (this *metrics) addBytesRead(n int) {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.bytesRead, uint64(n))
+	}
+}
+
+func (this *metrics) addBytesWritten(n int) {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.bytesWritten, uint64(n))
+	}
+}
+
+func (this *metrics) addMessageIn() {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.messagesIn, 1)
+	}
+}
+
+func (this *metrics) addMessageOut() {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.messagesOut, 1)
+	}
+}
+
+func (this *metrics) addWriteBlockingDrop() {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.writeBlockingDrops, 1)
+	}
+}
+
+func (this *metrics) addRecvQueueDrop() {
+	for m := this; m != nil; m = m.parent {
+		atomic.AddUint64(&m.recvQueueDrops, 1)
+	}
+}
+
+func (this *metrics) addAccept() {
+	atomic.AddUint64(&this.accepts, 1)
+}
+
+func (this *metrics) addAcceptError() {
+	atomic.AddUint64(&this.acceptErrors, 1)
+}
+
+// the connection opened, count it to the parent
+func (this *metrics) connOpened() {
+	if this.parent != nil {
+		atomic.AddInt64(&this.parent.activeConnections, 1)
+	}
+}
+
+// the connection closed, count it to the parent
+func (this *metrics) connClosed(reason CloseReason) {
+	if this.parent == nil {
+		return
+	}
+
+	atomic.AddInt64(&this.parent.activeConnections, -1)
+
+	this.parent.closeMtx.Lock()
+	this.parent.closeReasons[reason]++
+	this.parent.closeMtx.Unlock()
+}
+
+// the connection stats snapshot
+func (this *metrics) connStats() ConnStats {
+	return ConnStats{
+		BytesRead:          atomic.LoadUint64(&this.bytesRead),
+		BytesWritten:       atomic.LoadUint64(&this.bytesWritten),
+		MessagesIn:         atomic.LoadUint64(&this.messagesIn),
+		MessagesOut:        atomic.LoadUint64(&this.messagesOut),
+		WriteBlockingDrops: atomic.LoadUint64(&this.writeBlockingDrops),
+		RecvQueueDrops:     atomic.LoadUint64(&this.recvQueueDrops),
+	}
+}
+
+// the stats snapshot, the send queue depth is the sum of the connections
+func (this *metrics) stats(conns []*Tcpcon) Stats {
+	stats := Stats{
+		ConnStats:         this.connStats(),
+		Accepts:           atomic.LoadUint64(&this.accepts),
+		AcceptErrors:      atomic.LoadUint64(&this.acceptErrors),
+		ActiveConnections: atomic.LoadInt64(&this.activeConnections),
+		CloseReasons:      make(map[CloseReason]uint64),
+	}
+
+	for _, con := range conns {
+		if con != nil {
+			stats.SendQueueDepth += con.SendQueueDepth()
+			stats.SendQueueBytes += con.SendQueueBytes()
+		}
+	}
+
+	this.closeMtx.Lock()
+	for reason, count := range this.closeReasons {
+		stats.CloseReasons[reason] = count
+	}
+	this.closeMtx.Unlock()
+
+	return stats
+}
@@ -0,0 +1,98 @@
+// File Metrics test
+
+package gonetio
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptorStats(t *testing.T) {
+	server := newOpenRecorder(true)
+	acceptor := startTestAcceptor(t, server)
+
+	client, err := net.Dial("tcp", acceptor.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	con := waitFor(t, server.opened, "the server opened")
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	echo := make([]byte, 5)
+	client.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadFull(client, echo); err != nil {
+		t.Fatal(err)
+	}
+
+	// the written bytes are counted after the write returned, the peer may read it first
+	deadline := time.Now().Add(3 * time.Second)
+	for con.Stats().BytesWritten != 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	connStats := con.Stats()
+	if connStats.BytesRead != 5 || connStats.BytesWritten != 5 || connStats.MessagesIn != 1 || connStats.MessagesOut != 1 {
+		t.Fatalf("connection stats %+v", connStats)
+	}
+
+	stats := acceptor.Stats()
+	if stats.Accepts != 1 || stats.AcceptErrors != 0 || stats.ActiveConnections != 1 {
+		t.Fatalf("acceptor stats %+v while connected", stats)
+	}
+	if stats.ConnStats != connStats {
+		t.Fatalf("acceptor conn stats %+v, expect the sum %+v", stats.ConnStats, connStats)
+	}
+
+	// the peer closes, the connection is counted closed by the remote
+	client.Close()
+	deadline = time.Now().Add(3 * time.Second)
+	for acceptor.Stats().ActiveConnections != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection is still active after the peer closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats = acceptor.Stats()
+	if len(stats.CloseReasons) != 1 || stats.CloseReasons[CloseReasonRemote] != 1 {
+		t.Fatalf("close reasons %v", stats.CloseReasons)
+	}
+	// the counters of the closed connection are kept
+	if stats.BytesRead != 5 || stats.BytesWritten != 5 || stats.MessagesIn != 1 || stats.MessagesOut != 1 {
+		t.Fatalf("acceptor stats %+v after closed", stats.ConnStats)
+	}
+}
+
+func TestMetricsParent(t *testing.T) {
+	parent := newMetrics()
+	children := []*metrics{newMetrics(), newMetrics()}
+	for _, child := range children {
+		child.parent = parent
+		child.connOpened()
+		child.addBytesRead(10)
+		child.addBytesWritten(20)
+		child.addMessageIn()
+		child.addMessageOut()
+		child.addWriteBlockingDrop()
+		child.addRecvQueueDrop()
+	}
+	children[0].connClosed(CloseReasonIdleTimeout)
+
+	expectChild := ConnStats{BytesRead: 10, BytesWritten: 20, MessagesIn: 1, MessagesOut: 1, WriteBlockingDrops: 1, RecvQueueDrops: 1}
+	if stats := children[1].connStats(); stats != expectChild {
+		t.Fatalf("child stats %+v, expect %+v", stats, expectChild)
+	}
+
+	stats := parent.stats(nil)
+	expectParent := ConnStats{BytesRead: 20, BytesWritten: 40, MessagesIn: 2, MessagesOut: 2, WriteBlockingDrops: 2, RecvQueueDrops: 2}
+	if stats.ConnStats != expectParent {
+		t.Fatalf("parent stats %+v, expect %+v", stats.ConnStats, expectParent)
+	}
+	if stats.ActiveConnections != 1 || stats.CloseReasons[CloseReasonIdleTimeout] != 1 {
+		t.Fatalf("parent active %d, close reasons %v", stats.ActiveConnections, stats.CloseReasons)
+	}
+}
@@ -0,0 +1,80 @@
+// File Frame
+
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// the frame header is the same as yamux:
+// version(1) type(1) flags(2) stream id(4) length(4), big endian
+const (
+	protoVersion = 0
+	headerSize   = 12
+)
+
+// frame type
+const (
+	typeData         = 0 // the payload of the length follows
+	typeWindowUpdate = 1 // the length is the window delta
+	typePing         = 2 // the length is the opaque value
+	typeGoAway       = 3 // the length is the reason code
+)
+
+// frame flags
+const (
+	flagSYN = 1 // open the stream
+	flagACK = 2 // ack the stream opened, or the ping reply
+	flagFIN = 4 // close the send direction
+	flagRST = 8 // reset the stream
+)
+
+const (
+	initialStreamWindow = 256 * 1024 // the initial window of each stream
+	maxDataFrameSize    = 32 * 1024  // the max payload of a data frame sent
+)
+
+// error type
+var (
+	ErrProtocol       = errors.New("Mux protocol error")
+	ErrSessionClosed  = errors.New("Mux session closed")
+	ErrSessionGoAway  = errors.New("Mux session go away, no new stream")
+	ErrStreamReset    = errors.New("Mux stream reset")
+	ErrStreamClosed   = errors.New("Mux stream closed")
+	ErrStreamsExhaust = errors.New("Mux stream ids or the max streams exhausted")
+	ErrWindowTooSmall = errors.New("Mux stream window smaller than the initial 256k")
+)
+
+// the frame header
+type header struct {
+	version  byte
+	typ      byte
+	flags    uint16
+	streamID uint32
+	length   uint32
+}
+
+// decode the header
+func decodeHeader(data []byte) header {
+	return header{
+		version:  data[0],
+		typ:      data[1],
+		flags:    binary.BigEndian.Uint16(data[2:4]),
+		streamID: binary.BigEndian.Uint32(data[4:8]),
+		length:   binary.BigEndian.Uint32(data[8:12]),
+	}
+}
+
+// encode the frame into the buffer, the length is len(payload) for the data frame
+func encodeFrame(buffer *bytes.Buffer, typ byte, flags uint16, streamID uint32, length uint32, payload []byte) {
+	var header [headerSize]byte
+	header[0] = protoVersion
+	header[1] = typ
+	binary.BigEndian.PutUint16(header[2:4], flags)
+	binary.BigEndian.PutUint32(header[4:8], streamID)
+	binary.BigEndian.PutUint32(header[8:12], length)
+	buffer.Write(header[:])
+	buffer.Write(payload)
+}
@@ -0,0 +1,439 @@
+// File Session
+
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"gonetio"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// the name of the session filter
+const SessionName = "MuxSession"
+
+const (
+	defaultStreamSendQueueSize = 1024 // default send queue size of the stream connection
+	defaultMaxStreams          = 1024 // default max streams of the session
+)
+
+// the config shared by the cloned sessions
+type sessionConfig struct {
+	streamChain   *gonetio.IoFilterChain // the filter chain template of the streams
+	window        uint32                 // the window of each stream
+	sendQueueSize int                    // the send queue size of the stream connection
+	maxStreams    int                    // the max streams of the session
+}
+
+// the multiplexing session, it runs many logical streams over the physical connection
+// it must be the last filter of the physical chain, each stream is a virtual Tcpcon
+// with its own filter chain cloned from the stream filter chain, so the stream handlers
+// see ConnOpened, MessageReceived and ConnClosed just like the physical ones
+// the frames are the same as yamux, the client side opens the odd stream ids, the server the even
+type Session struct {
+	gonetio.IoHandlerAdaptor
+	config       *sessionConfig      // the config, shared by the clones
+	client       bool                // is the client side
+	nextConID    uint32              // the next virtual connection id
+	waitGroup    *sync.WaitGroup     // wait for the stream loops
+	mtx          *sync.Mutex         // guard the fields below
+	filter       *gonetio.IoFilter   // the filter of the session, nil if not connected
+	con          *gonetio.Tcpcon     // the physical connection, nil if not connected
+	streams      map[uint32]*Stream  // <stream id, stream>
+	nextStreamID uint32              // the next stream id to open
+	remoteGoAway bool                // the peer opens no more stream
+	logger       gonetio.FieldLogger // the logger of the physical connection, kept after it lost
+}
+
+// new session
+// the client decides the stream id parity, the connector side must be the client
+func NewSession(client bool) *Session {
+	return newSession(&sessionConfig{
+		streamChain:   gonetio.NewIoFilterChain(nil),
+		window:        initialStreamWindow,
+		sendQueueSize: defaultStreamSendQueueSize,
+		maxStreams:    defaultMaxStreams,
+	}, client)
+}
+
+func newSession(config *sessionConfig, client bool) *Session {
+	handler := &Session{
+		config:    config,
+		client:    client,
+		waitGroup: &sync.WaitGroup{},
+		mtx:       &sync.Mutex{},
+		streams:   make(map[uint32]*Stream),
+	}
+	handler.SetBoundType(gonetio.InBound | gonetio.OutBound)
+	return handler
+}
+
+// get the session added with SessionName to the chain of the physical connection
+func GetSession(con *gonetio.Tcpcon) *Session {
+	if con == nil || con.GetIoFilterChain() == nil {
+		return nil
+	}
+
+	filter := con.GetIoFilterChain().Get(SessionName)
+	if filter == nil {
+		return nil
+	}
+
+	session, _ := filter.GetHandler().(*Session)
+	return session
+}
+
+// get the filter chain template of the streams
+func (this *Session) GetStreamFilterChain() *gonetio.IoFilterChain {
+	return this.config.streamChain
+}
+
+// set the window of each stream, the window can't be smaller than the yamux initial 256k
+func (this *Session) SetWindowSize(window uint32) error {
+	if window < initialStreamWindow {
+		return fmt.Errorf("%w: window %d", ErrWindowTooSmall, window)
+	}
+	this.config.window = window
+	return nil
+}
+
+// set the send queue size of the stream connection
+func (this *Session) SetStreamSendQueueSize(size int) {
+	this.config.sendQueueSize = size
+}
+
+// set the max streams of the session
+func (this *Session) SetMaxStreams(maxStreams int) {
+	this.config.maxStreams = maxStreams
+}
+
+// get the count of the streams
+func (this *Session) StreamCount() int {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return len(this.streams)
+}
+
+// get the physical local addr
+func (this *Session) localAddr() net.Addr {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.con == nil || this.con.GetRawConn() == nil {
+		return nil
+	}
+	return this.con.GetRawConn().LocalAddr()
+}
+
+// get the physical remote addr
+func (this *Session) remoteAddr() net.Addr {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.con == nil || this.con.GetRawConn() == nil {
+		return nil
+	}
+	return this.con.GetRawConn().RemoteAddr()
+}
+
+// write the frame to the physical connection
+// return the error if the frame is refused, like the send queue overflow
+func (this *Session) writeFrame(typ byte, flags uint16, streamID uint32, length uint32, payload []byte) error {
+	this.mtx.Lock()
+	filter := this.filter
+	this.mtx.Unlock()
+
+	if filter == nil {
+		return ErrSessionClosed
+	}
+
+	buffer := filter.GetCon().NewWriteBuffer(headerSize + len(payload))
+	encodeFrame(buffer, typ, flags, streamID, length, payload)
+	future := filter.FireWriteAsync(buffer)
+	filter.GetCon().ReleaseWriteBuffer(buffer)
+
+	select {
+	case <-future.Done():
+		return future.Err()
+	default:
+		return nil
+	}
+}
+
+// write the control frame, the window update, the stream flags or the ping ack
+// the peer is out of sync with the session if one is lost, so the physical connection is closed on the failure
+func (this *Session) writeControlFrame(typ byte, flags uint16, streamID uint32, length uint32) error {
+	err := this.writeFrame(typ, flags, streamID, length, nil)
+	if err == nil || err == ErrSessionClosed {
+		return err
+	}
+
+	this.mtx.Lock()
+	con := this.con
+	this.mtx.Unlock()
+
+	if con != nil {
+		con.Logger().Log(gonetio.LvlError, "mux session control frame lost, close the connection", "type", typ, "flags", flags, "stream", streamID, "err", err)
+		con.Close()
+	}
+	return err
+}
+
+// open a stream to the peer, the virtual connection is started with the stream filter chain
+func (this *Session) OpenStream() (*gonetio.Tcpcon, error) {
+	this.mtx.Lock()
+	if this.filter == nil {
+		this.mtx.Unlock()
+		return nil, ErrSessionClosed
+	}
+
+	if this.remoteGoAway {
+		this.mtx.Unlock()
+		return nil, ErrSessionGoAway
+	}
+
+	if len(this.streams) >= this.config.maxStreams || this.nextStreamID > ^uint32(0)-2 {
+		this.mtx.Unlock()
+		return nil, ErrStreamsExhaust
+	}
+
+	id := this.nextStreamID
+	this.nextStreamID += 2
+	stream := newStream(this, id)
+	stream.recvWindow = this.config.window
+	this.streams[id] = stream
+	this.mtx.Unlock()
+
+	if err := this.writeControlFrame(typeWindowUpdate, flagSYN, id, this.config.window-initialStreamWindow); err != nil {
+		this.removeStream(stream)
+		return nil, err
+	}
+
+	return this.startStream(stream), nil
+}
+
+// get the logger of the physical connection
+func (this *Session) getLogger() gonetio.FieldLogger {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.logger == nil {
+		return gonetio.DefaultLogger()
+	}
+	return this.logger
+}
+
+// start the virtual connection of the stream
+func (this *Session) startStream(stream *Stream) *gonetio.Tcpcon {
+	con := gonetio.NewConnFull(stream, this.config.sendQueueSize, this.waitGroup, 0)
+	con.SetLogger(this.getLogger().With("stream", stream.id))
+	con.SetConID(atomic.AddUint32(&this.nextConID, 1))
+	con.SetIoFilterChain(this.config.streamChain.NewInstanceAndClone(con))
+	stream.con = con
+	con.Start()
+	return con
+}
+
+// accept the stream opened by the peer
+func (this *Session) acceptStream(id uint32) *Stream {
+	// the peer must open the ids of the other parity
+	if (id%2 == 1) == this.client || id == 0 {
+		this.protocolError(fmt.Errorf("%w: peer opened stream[%d] of bad parity", ErrProtocol, id))
+		return nil
+	}
+
+	this.mtx.Lock()
+	if _, ok := this.streams[id]; ok {
+		this.mtx.Unlock()
+		this.protocolError(fmt.Errorf("%w: peer opened stream[%d] twice", ErrProtocol, id))
+		return nil
+	}
+
+	if len(this.streams) >= this.config.maxStreams {
+		this.mtx.Unlock()
+		this.getLogger().Log(gonetio.LvlWarn, "mux session reach the max streams, reset the stream", "maxStreams", this.config.maxStreams, "stream", id)
+		this.writeControlFrame(typeWindowUpdate, flagRST, id, 0)
+		return nil
+	}
+
+	stream := newStream(this, id)
+	stream.recvWindow = this.config.window
+	this.streams[id] = stream
+	this.mtx.Unlock()
+
+	if this.writeControlFrame(typeWindowUpdate, flagACK, id, this.config.window-initialStreamWindow) != nil {
+		this.removeStream(stream)
+		return nil
+	}
+	return stream
+}
+
+// remove the stream
+func (this *Session) removeStream(stream *Stream) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.streams[stream.id] == stream {
+		delete(this.streams, stream.id)
+	}
+}
+
+// get the stream
+func (this *Session) getStream(id uint32) *Stream {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return this.streams[id]
+}
+
+// the peer broke the protocol, close the physical connection
+func (this *Session) protocolError(err error) {
+	this.mtx.Lock()
+	con := this.con
+	this.mtx.Unlock()
+
+	if con != nil {
+		con.Logger().Log(gonetio.LvlError, "mux session protocol error, close the connection", "err", err)
+		con.Close()
+	}
+}
+
+// Connection opened
+func (this *Session) ConnOpened(filter *gonetio.IoFilter) {
+	con := filter.GetCon()
+
+	this.mtx.Lock()
+	this.filter = filter
+	this.con = con
+	this.logger = con.Logger()
+	this.streams = make(map[uint32]*Stream)
+	this.remoteGoAway = false
+	if this.client {
+		this.nextStreamID = 1
+	} else {
+		this.nextStreamID = 2
+	}
+	this.mtx.Unlock()
+
+	con.AddCloseListener(this.connLost)
+
+	filter.ConnOpened()
+}
+
+// Connection closed
+func (this *Session) ConnClosed(filter *gonetio.IoFilter) {
+	this.connLost(filter.GetCon())
+
+	filter.ConnClosed()
+}
+
+// close all the streams
+func (this *Session) connLost(con *gonetio.Tcpcon) {
+	this.mtx.Lock()
+	if this.con != con {
+		this.mtx.Unlock()
+		return
+	}
+	streams := this.streams
+	this.filter = nil
+	this.con = nil
+	this.streams = make(map[uint32]*Stream)
+	this.mtx.Unlock()
+
+	for _, stream := range streams {
+		stream.abort(ErrSessionClosed)
+	}
+}
+
+// The event fired when receive message from the connection
+func (this *Session) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	input := obj.(*bytes.Buffer)
+
+	for {
+		data := input.Bytes()
+		if len(data) < headerSize {
+			return
+		}
+
+		hdr := decodeHeader(data)
+		if hdr.version != protoVersion {
+			input.Reset()
+			this.protocolError(fmt.Errorf("%w: unsupported version %d", ErrProtocol, hdr.version))
+			return
+		}
+
+		switch hdr.typ {
+		case typeData:
+			if hdr.length > this.config.window {
+				input.Reset()
+				this.protocolError(fmt.Errorf("%w: data frame length %d beyond the window %d", ErrProtocol, hdr.length, this.config.window))
+				return
+			}
+
+			if len(data) < headerSize+int(hdr.length) {
+				return
+			}
+
+			payload := make([]byte, hdr.length)
+			copy(payload, data[headerSize:])
+			input.Next(headerSize + int(hdr.length))
+			this.handleStreamFrame(hdr, payload)
+
+		case typeWindowUpdate:
+			input.Next(headerSize)
+			this.handleStreamFrame(hdr, nil)
+
+		case typePing:
+			input.Next(headerSize)
+			if hdr.flags&flagSYN != 0 {
+				this.writeControlFrame(typePing, flagACK, 0, hdr.length)
+			}
+
+		case typeGoAway:
+			input.Next(headerSize)
+			this.mtx.Lock()
+			this.remoteGoAway = true
+			this.mtx.Unlock()
+
+		default:
+			input.Reset()
+			this.protocolError(fmt.Errorf("%w: unknown frame type %d", ErrProtocol, hdr.typ))
+			return
+		}
+	}
+}
+
+// handle the data or window update frame of the stream
+func (this *Session) handleStreamFrame(hdr header, payload []byte) {
+	var stream *Stream = nil
+	if hdr.flags&flagSYN != 0 {
+		stream = this.acceptStream(hdr.streamID)
+		if stream == nil {
+			return
+		}
+		// the frames of the stream are handled in order, so start it after the frame applied
+		defer this.startStream(stream)
+	} else {
+		stream = this.getStream(hdr.streamID)
+		if stream == nil {
+			// the stream is gone, drop the frame
+			return
+		}
+	}
+
+	if hdr.typ == typeData {
+		stream.recvData(payload)
+	} else {
+		stream.recvWindowUpdate(hdr.length)
+	}
+	stream.recvFlags(hdr.flags)
+}
+
+// Clone
+// the clone shares the config
+func (this *Session) Clone() gonetio.IoHandler {
+	return newSession(this.config, this.client)
+}
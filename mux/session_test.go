@@ -0,0 +1,381 @@
+// File Session test
+
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"gonetio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record the events of the streams, hold the reads until released if hold
+type streamHandler struct {
+	gonetio.IoHandlerImp
+	hold     chan struct{}
+	holdOnce sync.Once
+	opened   chan *gonetio.Tcpcon
+	closed   chan *gonetio.Tcpcon
+	mtx      sync.Mutex
+	received bytes.Buffer
+}
+
+func newStreamHandler(hold bool) *streamHandler {
+	handler := &streamHandler{
+		opened: make(chan *gonetio.Tcpcon, 16),
+		closed: make(chan *gonetio.Tcpcon, 16),
+	}
+	if hold {
+		handler.hold = make(chan struct{})
+	}
+	handler.SetBoundType(gonetio.InBound)
+	return handler
+}
+
+func (this *streamHandler) ConnOpened(filter *gonetio.IoFilter) {
+	this.opened <- filter.GetCon()
+}
+
+func (this *streamHandler) ConnClosed(filter *gonetio.IoFilter) {
+	this.closed <- filter.GetCon()
+}
+
+func (this *streamHandler) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	if this.hold != nil {
+		<-this.hold
+	}
+
+	input := obj.(*bytes.Buffer)
+	this.mtx.Lock()
+	this.received.Write(input.Bytes())
+	this.mtx.Unlock()
+	input.Reset()
+}
+
+// release the reads held
+func (this *streamHandler) release() {
+	this.holdOnce.Do(func() {
+		if this.hold != nil {
+			close(this.hold)
+		}
+	})
+}
+
+// get the bytes received
+func (this *streamHandler) getReceived() []byte {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return append([]byte{}, this.received.Bytes()...)
+}
+
+// the handlers are shared by all the streams of the test
+func (this *streamHandler) Clone() gonetio.IoHandler {
+	return this
+}
+
+// start the session over the conn, the streams run the handler
+func startSession(t *testing.T, conn net.Conn, client bool, handler gonetio.IoHandler) *gonetio.Tcpcon {
+	session := NewSession(client)
+	session.GetStreamFilterChain().AddLast("handler", handler)
+
+	con := gonetio.NewConnFull(conn, 64, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	chain.AddLast(SessionName, session)
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	t.Cleanup(con.Close)
+	return con
+}
+
+// start the client and the server sessions over the pipe
+func startSessionPair(t *testing.T, clientHandler, serverHandler *streamHandler) (*gonetio.Tcpcon, *gonetio.Tcpcon) {
+	local, remote := net.Pipe()
+	t.Cleanup(clientHandler.release)
+	t.Cleanup(serverHandler.release)
+	return startSession(t, local, true, clientHandler), startSession(t, remote, false, serverHandler)
+}
+
+// wait for the connection from the channel
+func waitCon(t *testing.T, ch <-chan *gonetio.Tcpcon, what string) *gonetio.Tcpcon {
+	t.Helper()
+
+	select {
+	case con := <-ch:
+		return con
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+	return nil
+}
+
+// wait until the condition is true
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// the writer blocks when the window of the peer is used up, until the peer reads
+func TestSessionWindow(t *testing.T) {
+	client, server := newStreamHandler(false), newStreamHandler(true)
+	clientCon, _ := startSessionPair(t, client, server)
+
+	con, err := GetSession(clientCon).OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := con.GetRawConn().(*Stream)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (initialStreamWindow+maxDataFrameSize)/16)
+	written := make(chan error, 1)
+	go func() {
+		_, err := stream.Write(data)
+		written <- err
+	}()
+
+	// the peer reads once then holds, the writer stops at the window
+	waitUntil(t, "the window used up", func() bool {
+		stream.mtx.Lock()
+		defer stream.mtx.Unlock()
+		return stream.sendWindow == 0
+	})
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-written:
+		t.Fatalf("write returned %v beyond the window", err)
+	default:
+	}
+
+	server.release()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the window is not updated after the peer read")
+	}
+
+	waitUntil(t, "all the data received", func() bool {
+		return len(server.getReceived()) == len(data)
+	})
+	if !bytes.Equal(server.getReceived(), data) {
+		t.Fatal("the data received is not the data written")
+	}
+}
+
+// read the frame headers from the raw peer
+func readHeaders(conn net.Conn) <-chan header {
+	headers := make(chan header, 64)
+	go func() {
+		defer close(headers)
+		data := make([]byte, headerSize)
+		for {
+			if _, err := io.ReadFull(conn, data); err != nil {
+				return
+			}
+			hdr := decodeHeader(data)
+			if hdr.typ == typeData {
+				if _, err := io.CopyN(io.Discard, conn, int64(hdr.length)); err != nil {
+					return
+				}
+			}
+			headers <- hdr
+		}
+	}()
+	return headers
+}
+
+// write the frame from the raw peer
+func writeRawFrame(t *testing.T, conn net.Conn, typ byte, flags uint16, streamID uint32, length uint32, payload []byte) {
+	buffer := &bytes.Buffer{}
+	encodeFrame(buffer, typ, flags, streamID, length, payload)
+	if _, err := conn.Write(buffer.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the peer sends beyond the window of the stream, the stream is reset
+func TestSessionWindowExceeded(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	server := newStreamHandler(true)
+	defer server.release()
+	serverCon := startSession(t, local, false, server)
+	headers := readHeaders(remote)
+
+	expectHeader := func(typ byte, flags uint16) {
+		t.Helper()
+
+		select {
+		case hdr := <-headers:
+			if hdr.typ != typ || hdr.flags != flags || hdr.streamID != 1 {
+				t.Fatalf("recv header %+v, expect type %d, flags %d of stream 1", hdr, typ, flags)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for the frame of type %d, flags %d", typ, flags)
+		}
+	}
+
+	writeRawFrame(t, remote, typeWindowUpdate, flagSYN, 1, 0, nil)
+	expectHeader(typeWindowUpdate, flagACK)
+
+	// the stream reads once then holds, it grants no window
+	payload := make([]byte, maxDataFrameSize)
+	for i := 0; i < initialStreamWindow/maxDataFrameSize; i++ {
+		writeRawFrame(t, remote, typeData, 0, 1, uint32(len(payload)), payload)
+	}
+	writeRawFrame(t, remote, typeData, 0, 1, 1, []byte{0})
+	expectHeader(typeWindowUpdate, flagRST)
+
+	if count := GetSession(serverCon).StreamCount(); count != 0 {
+		t.Fatalf("stream count %d after the reset", count)
+	}
+	server.release()
+	waitCon(t, server.closed, "the stream closed")
+	if !serverCon.IsConnected() {
+		t.Fatal("the session closed for the stream beyond the window")
+	}
+}
+
+// the close of either side finishes the stream on both
+func TestSessionStreamClose(t *testing.T) {
+	client, server := newStreamHandler(false), newStreamHandler(false)
+	clientCon, serverCon := startSessionPair(t, client, server)
+
+	con, err := GetSession(clientCon).OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := con.SendAsync(bytes.NewBufferString("hello")).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "the data received", func() bool {
+		return string(server.getReceived()) == "hello"
+	})
+
+	con.Close()
+	waitCon(t, server.closed, "the server side stream closed")
+	waitCon(t, client.closed, "the client side stream closed")
+	waitUntil(t, "the streams removed", func() bool {
+		return GetSession(clientCon).StreamCount() == 0 && GetSession(serverCon).StreamCount() == 0
+	})
+}
+
+// the reset aborts the stream on both sides at once
+func TestSessionStreamReset(t *testing.T) {
+	client, server := newStreamHandler(false), newStreamHandler(false)
+	clientCon, serverCon := startSessionPair(t, client, server)
+
+	con, err := GetSession(clientCon).OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCon(t, server.opened, "the server side stream opened")
+
+	stream := con.GetRawConn().(*Stream)
+	stream.Reset()
+	if _, err := stream.Write([]byte("hello")); !errors.Is(err, ErrStreamReset) {
+		t.Fatalf("write after reset err %v", err)
+	}
+
+	waitCon(t, server.closed, "the server side stream closed")
+	waitCon(t, client.closed, "the client side stream closed")
+	waitUntil(t, "the streams removed", func() bool {
+		return GetSession(clientCon).StreamCount() == 0 && GetSession(serverCon).StreamCount() == 0
+	})
+}
+
+// the streams are aborted when the physical connection lost
+func TestSessionConnectionLost(t *testing.T) {
+	client, server := newStreamHandler(false), newStreamHandler(false)
+	clientCon, serverCon := startSessionPair(t, client, server)
+
+	con, err := GetSession(clientCon).OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCon(t, server.opened, "the server side stream opened")
+
+	serverCon.Close()
+	waitCon(t, server.closed, "the server side stream closed")
+	waitCon(t, client.closed, "the client side stream closed")
+
+	if _, err := con.GetRawConn().Write([]byte("hello")); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("write after the connection lost err %v", err)
+	}
+	if _, err := GetSession(clientCon).OpenStream(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("open stream after the connection lost err %v", err)
+	}
+	if GetSession(clientCon).StreamCount() != 0 || GetSession(serverCon).StreamCount() != 0 {
+		t.Fatal("the streams are kept after the connection lost")
+	}
+}
+
+func TestSessionSetWindowSize(t *testing.T) {
+	tests := []struct {
+		window uint32
+		err    error
+	}{
+		{0, ErrWindowTooSmall},
+		{64 * 1024, ErrWindowTooSmall},
+		{initialStreamWindow - 1, ErrWindowTooSmall},
+		{initialStreamWindow, nil},
+		{1 << 20, nil},
+	}
+
+	for _, test := range tests {
+		session := NewSession(true)
+		err := session.SetWindowSize(test.window)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("window %d, err %v, expect %v", test.window, err, test.err)
+		}
+
+		expect := test.window
+		if test.err != nil {
+			expect = initialStreamWindow
+		}
+		if session.config.window != expect {
+			t.Fatalf("window %d, config window %d, expect %d", test.window, session.config.window, expect)
+		}
+	}
+}
+
+// the ping ack is refused by the full send queue, the session closes the connection
+func TestSessionControlFrameLost(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	// the raw peer never reads, the write loop blocks and the queue of one fills up
+	session := NewSession(false)
+	con := gonetio.NewConnFull(local, 1, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	chain.AddLast(SessionName, session)
+	con.SetIoFilterChain(chain)
+	con.Start()
+	defer con.Close()
+
+	// the pipe fails the write once the connection closed, so write all the pings in one
+	pings := &bytes.Buffer{}
+	for i := 0; i < 4; i++ {
+		encodeFrame(pings, typePing, flagSYN, 0, uint32(i), nil)
+	}
+	go remote.Write(pings.Bytes())
+
+	waitUntil(t, "the connection closed", func() bool {
+		return !con.IsConnected()
+	})
+}
@@ -0,0 +1,343 @@
+// File Stream
+
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"gonetio"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// the address of the stream, the physical address with the stream id
+type streamAddr struct {
+	addr     net.Addr
+	streamID uint32
+}
+
+func (this *streamAddr) Network() string {
+	return "mux"
+}
+
+func (this *streamAddr) String() string {
+	if this.addr == nil {
+		return fmt.Sprintf("#%d", this.streamID)
+	}
+	return fmt.Sprintf("%s#%d", this.addr.String(), this.streamID)
+}
+
+// the logical stream over the session, it's the net.Conn of the virtual Tcpcon of the stream
+// get it by con.GetRawConn().(*mux.Stream)
+type Stream struct {
+	id            uint32          // the stream id
+	session       *Session        // the session
+	con           *gonetio.Tcpcon // the virtual connection
+	readable      chan struct{}   // signal the data received or the state changed
+	writable      chan struct{}   // signal the window updated or the state changed
+	doneChan      chan struct{}   // closed when the stream finished
+	doneOnce      sync.Once       // make sure the stream finished just once
+	mtx           *sync.Mutex     // guard the fields below
+	recvBuffer    *bytes.Buffer   // the data received
+	recvWindow    uint32          // the bytes the peer can send more
+	consumed      uint32          // the bytes read since the last window update
+	sendWindow    uint32          // the bytes can send more
+	localClosed   bool            // is the FIN sent
+	remoteClosed  bool            // is the FIN received
+	err           error           // the reset error
+	readDeadline  time.Time       // the read deadline
+	writeDeadline time.Time       // the write deadline
+}
+
+// new stream
+func newStream(session *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    session,
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+		doneChan:   make(chan struct{}),
+		mtx:        &sync.Mutex{},
+		recvBuffer: bytes.NewBuffer([]byte{}),
+		recvWindow: initialStreamWindow,
+		sendWindow: initialStreamWindow,
+	}
+}
+
+// get the stream id
+func (this *Stream) StreamID() uint32 {
+	return this.id
+}
+
+// get the virtual connection of the stream
+func (this *Stream) GetCon() *gonetio.Tcpcon {
+	return this.con
+}
+
+// signal the channel without blocking
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// get the timer channel of the deadline, nil if no deadline
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func()) {
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
+
+// read the data received, io.EOF after the peer or this side closed
+func (this *Stream) Read(b []byte) (int, error) {
+	for {
+		this.mtx.Lock()
+		if this.recvBuffer.Len() > 0 {
+			n, _ := this.recvBuffer.Read(b)
+			this.consumed += uint32(n)
+
+			delta := uint32(0)
+			if this.consumed*2 >= this.session.config.window && !this.remoteClosed && this.err == nil {
+				delta = this.consumed
+				this.recvWindow += delta
+				this.consumed = 0
+			}
+			this.mtx.Unlock()
+
+			if delta > 0 {
+				this.session.writeControlFrame(typeWindowUpdate, 0, this.id, delta)
+			}
+			return n, nil
+		}
+
+		if this.err != nil {
+			err := this.err
+			this.mtx.Unlock()
+			return 0, err
+		}
+
+		if this.remoteClosed || this.localClosed {
+			this.mtx.Unlock()
+			return 0, io.EOF
+		}
+
+		timeout, stop := deadlineTimer(this.readDeadline)
+		this.mtx.Unlock()
+
+		select {
+		case <-this.readable:
+			stop()
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// write the data, block until the peer window is enough
+func (this *Stream) Write(b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		this.mtx.Lock()
+		if this.err != nil {
+			err := this.err
+			this.mtx.Unlock()
+			return total, err
+		}
+
+		if this.localClosed {
+			this.mtx.Unlock()
+			return total, ErrStreamClosed
+		}
+
+		if this.sendWindow == 0 {
+			timeout, stop := deadlineTimer(this.writeDeadline)
+			this.mtx.Unlock()
+
+			select {
+			case <-this.writable:
+				stop()
+			case <-timeout:
+				return total, os.ErrDeadlineExceeded
+			}
+			continue
+		}
+
+		n := len(b) - total
+		if n > int(this.sendWindow) {
+			n = int(this.sendWindow)
+		}
+		if n > maxDataFrameSize {
+			n = maxDataFrameSize
+		}
+		this.sendWindow -= uint32(n)
+		this.mtx.Unlock()
+
+		// the lost data frame breaks the stream, the virtual connection closes with the error
+		if err := this.session.writeFrame(typeData, 0, this.id, uint32(n), b[total:total+n]); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// close the stream, send the FIN to the peer
+// the stream finishes when the FIN of the peer received
+// return the error if the FIN can't be written
+func (this *Stream) Close() error {
+	this.mtx.Lock()
+	if this.localClosed || this.err != nil {
+		this.mtx.Unlock()
+		return nil
+	}
+	this.localClosed = true
+	finished := this.remoteClosed
+	this.mtx.Unlock()
+
+	err := this.session.writeControlFrame(typeWindowUpdate, flagFIN, this.id, 0)
+	notify(this.readable)
+	notify(this.writable)
+
+	if finished {
+		this.finish()
+	}
+	return err
+}
+
+// reset the stream, send the RST to the peer
+func (this *Stream) Reset() {
+	if this.abort(ErrStreamReset) {
+		this.session.writeControlFrame(typeWindowUpdate, flagRST, this.id, 0)
+	}
+}
+
+// abort the stream with the error, return false if already finished
+func (this *Stream) abort(err error) bool {
+	this.mtx.Lock()
+	if this.err != nil || this.isDone() {
+		this.mtx.Unlock()
+		return false
+	}
+	this.err = err
+	this.mtx.Unlock()
+
+	notify(this.readable)
+	notify(this.writable)
+	this.finish()
+	return true
+}
+
+// is the stream finished
+func (this *Stream) isDone() bool {
+	select {
+	case <-this.doneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// finish the stream, remove it from the session
+func (this *Stream) finish() {
+	this.doneOnce.Do(func() {
+		close(this.doneChan)
+		this.session.removeStream(this)
+	})
+}
+
+// handle the data frame
+func (this *Stream) recvData(payload []byte) {
+	this.mtx.Lock()
+	if uint32(len(payload)) > this.recvWindow {
+		this.mtx.Unlock()
+		this.con.Logger().Log(gonetio.LvlError, "mux stream recv beyond the window, reset it", "bytes", len(payload), "window", this.recvWindow)
+		this.Reset()
+		return
+	}
+	this.recvWindow -= uint32(len(payload))
+
+	// nobody reads any more
+	if this.localClosed || this.err != nil {
+		this.mtx.Unlock()
+		return
+	}
+	this.recvBuffer.Write(payload)
+	this.mtx.Unlock()
+
+	notify(this.readable)
+}
+
+// handle the window update
+func (this *Stream) recvWindowUpdate(delta uint32) {
+	if delta == 0 {
+		return
+	}
+
+	this.mtx.Lock()
+	this.sendWindow += delta
+	this.mtx.Unlock()
+
+	notify(this.writable)
+}
+
+// handle the flags of the frame
+func (this *Stream) recvFlags(flags uint16) {
+	if flags&flagRST != 0 {
+		this.abort(ErrStreamReset)
+		return
+	}
+
+	if flags&flagFIN != 0 {
+		this.mtx.Lock()
+		this.remoteClosed = true
+		finished := this.localClosed
+		this.mtx.Unlock()
+
+		notify(this.readable)
+		if finished {
+			this.finish()
+		}
+	}
+}
+
+// local addr
+func (this *Stream) LocalAddr() net.Addr {
+	return &streamAddr{addr: this.session.localAddr(), streamID: this.id}
+}
+
+// remote addr
+func (this *Stream) RemoteAddr() net.Addr {
+	return &streamAddr{addr: this.session.remoteAddr(), streamID: this.id}
+}
+
+// set deadline
+func (this *Stream) SetDeadline(t time.Time) error {
+	this.SetReadDeadline(t)
+	return this.SetWriteDeadline(t)
+}
+
+// set read deadline
+func (this *Stream) SetReadDeadline(t time.Time) error {
+	this.mtx.Lock()
+	this.readDeadline = t
+	this.mtx.Unlock()
+
+	notify(this.readable)
+	return nil
+}
+
+// set write deadline
+func (this *Stream) SetWriteDeadline(t time.Time) error {
+	this.mtx.Lock()
+	this.writeDeadline = t
+	this.mtx.Unlock()
+
+	notify(this.writable)
+	return nil
+}
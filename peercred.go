@@ -0,0 +1,37 @@
+// File PeerCred
+
+package gonetio
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// error type
+var (
+	ErrPeerCredUnsupported = errors.New("Peer credentials are not supported on this connection")
+)
+
+// the credentials of the peer process of a unix socket connection
+type PeerCred struct {
+	Pid int32  // process id
+	Uid uint32 // user id
+	Gid uint32 // group id
+}
+
+// get the credentials of the peer process
+// only available on unix socket connections of the supported platforms
+func (this *Tcpcon) PeerCredentials() (*PeerCred, error) {
+	conn := this.rawConn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrPeerCredUnsupported
+	}
+
+	return getPeerCred(unixConn)
+}
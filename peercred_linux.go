@@ -0,0 +1,34 @@
+// File PeerCred
+
+package gonetio
+
+import (
+	"net"
+	"syscall"
+)
+
+// get the peer credentials by SO_PEERCRED
+func getPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *syscall.Ucred = nil
+	var credErr error = nil
+	err = rawConn.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &PeerCred{
+		Pid: ucred.Pid,
+		Uid: ucred.Uid,
+		Gid: ucred.Gid,
+	}, nil
+}
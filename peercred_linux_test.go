@@ -0,0 +1,47 @@
+// File PeerCred test
+
+package gonetio
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cred.sock")
+	server := newOpenRecorder(true)
+	startUnixAcceptor(t, path, server)
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the peer is this process
+	cred, err := waitFor(t, server.opened, "the server opened").PeerCredentials()
+	if err != nil {
+		t.Fatalf("get the peer credentials failed, %v", err)
+	}
+	if int(cred.Pid) != os.Getpid() || int(cred.Uid) != os.Getuid() || int(cred.Gid) != os.Getgid() {
+		t.Fatalf("peer credentials %+v, expect pid %d, uid %d, gid %d", cred, os.Getpid(), os.Getuid(), os.Getgid())
+	}
+}
+
+func TestPeerCredentialsUnsupported(t *testing.T) {
+	server := newOpenRecorder(true)
+	acceptor := startTestAcceptor(t, server)
+
+	client, err := net.Dial("tcp", acceptor.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := waitFor(t, server.opened, "the server opened").PeerCredentials(); !errors.Is(err, ErrPeerCredUnsupported) {
+		t.Fatalf("tcp connection peer credentials err %v, expect ErrPeerCredUnsupported", err)
+	}
+}
@@ -0,0 +1,14 @@
+// File PeerCred
+
+//go:build !linux
+
+package gonetio
+
+import (
+	"net"
+)
+
+// peer credentials are not supported on this platform
+func getPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	return nil, ErrPeerCredUnsupported
+}
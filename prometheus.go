@@ -0,0 +1,145 @@
+// File Prometheus
+
+package gonetio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// the prometheus text exposition content type
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// the http handler renders the stats of the sources in the prometheus text format
+// e.g. http.Handle("/metrics", handler) after handler.Register("gateway", acceptor)
+type MetricsHandler struct {
+	mtx     *sync.RWMutex
+	names   []string               // the source names in the register order
+	sources map[string]StatsSource // <name, source>
+}
+
+// new metrics handler
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{
+		mtx:     &sync.RWMutex{},
+		sources: make(map[string]StatsSource),
+	}
+}
+
+// register the source with the name, it's the "name" label of the metrics
+// the source registered with the same name is replaced
+func (this *MetricsHandler) Register(name string, source StatsSource) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if _, ok := this.sources[name]; !ok {
+		this.names = append(this.names, name)
+	}
+	this.sources[name] = source
+}
+
+// unregister the source
+func (this *MetricsHandler) Unregister(name string) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if _, ok := this.sources[name]; !ok {
+		return
+	}
+
+	delete(this.sources, name)
+	for i, n := range this.names {
+		if n == name {
+			this.names = append(this.names[:i], this.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// the metric rendered
+type metricDesc struct {
+	name  string
+	typ   string
+	help  string
+	value func(stats *Stats) float64
+}
+
+var metricDescs = []metricDesc{
+	{"gonetio_bytes_read_total", "counter", "Bytes read from the connections.", func(s *Stats) float64 { return float64(s.BytesRead) }},
+	{"gonetio_bytes_written_total", "counter", "Bytes written to the connections.", func(s *Stats) float64 { return float64(s.BytesWritten) }},
+	{"gonetio_messages_in_total", "counter", "Messages reached the last in bound handler.", func(s *Stats) float64 { return float64(s.MessagesIn) }},
+	{"gonetio_messages_out_total", "counter", "Packets added to the send queues.", func(s *Stats) float64 { return float64(s.MessagesOut) }},
+	{"gonetio_write_blocking_drops_total", "counter", "Packets dropped for the send queue full.", func(s *Stats) float64 { return float64(s.WriteBlockingDrops) }},
+	{"gonetio_recv_queue_drops_total", "counter", "Datagrams dropped for the udp session recv queue full.", func(s *Stats) float64 { return float64(s.RecvQueueDrops) }},
+	{"gonetio_send_queue_depth", "gauge", "Packets waiting in the send queues.", func(s *Stats) float64 { return float64(s.SendQueueDepth) }},
+	{"gonetio_send_queue_bytes", "gauge", "Bytes waiting in the send queues.", func(s *Stats) float64 { return float64(s.SendQueueBytes) }},
+	{"gonetio_accepts_total", "counter", "Connections accepted, or connected by the connector.", func(s *Stats) float64 { return float64(s.Accepts) }},
+	{"gonetio_accept_errors_total", "counter", "Accepts failed, or connects failed by the connector.", func(s *Stats) float64 { return float64(s.AcceptErrors) }},
+	{"gonetio_active_connections", "gauge", "Connections opened and not closed.", func(s *Stats) float64 { return float64(s.ActiveConnections) }},
+}
+
+// escape the label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// write the stats of all the sources in the prometheus text format
+func (this *MetricsHandler) WriteTo(w io.Writer) (int64, error) {
+	this.mtx.RLock()
+	names := append([]string{}, this.names...)
+	stats := make([]Stats, 0, len(names))
+	for _, name := range names {
+		stats = append(stats, this.sources[name].Stats())
+	}
+	this.mtx.RUnlock()
+
+	counter := &countWriter{w: w}
+	writer := bufio.NewWriter(counter)
+
+	for _, desc := range metricDescs {
+		fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.typ)
+		for i, name := range names {
+			fmt.Fprintf(writer, "%s{name=\"%s\"} %v\n", desc.name, escapeLabel(name), desc.value(&stats[i]))
+		}
+	}
+
+	fmt.Fprintf(writer, "# HELP gonetio_connections_closed_total Connections closed by the reason.\n# TYPE gonetio_connections_closed_total counter\n")
+	for i, name := range names {
+		reasons := make([]string, 0, len(stats[i].CloseReasons))
+		for reason := range stats[i].CloseReasons {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+
+		for _, reason := range reasons {
+			fmt.Fprintf(writer, "gonetio_connections_closed_total{name=\"%s\",reason=\"%s\"} %d\n",
+				escapeLabel(name), escapeLabel(reason), stats[i].CloseReasons[CloseReason(reason)])
+		}
+	}
+
+	err := writer.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP
+func (this *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	this.WriteTo(w)
+}
+
+// the writer counts the bytes written
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (this *countWriter) Write(b []byte) (int, error) {
+	n, err := this.w.Write(b)
+	this.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+// File Prometheus test
+
+package gonetio
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// the source of the fixed stats
+type fixedStats Stats
+
+func (this *fixedStats) Stats() Stats {
+	return Stats(*this)
+}
+
+func TestMetricsHandlerWriteTo(t *testing.T) {
+	handler := NewMetricsHandler()
+	handler.Register("gate", &fixedStats{
+		ConnStats:         ConnStats{BytesRead: 100, WriteBlockingDrops: 2, RecvQueueDrops: 4, SendQueueDepth: 3},
+		Accepts:           7,
+		ActiveConnections: 5,
+		CloseReasons:      map[CloseReason]uint64{CloseReasonRemote: 2, CloseReasonIdleTimeout: 1},
+	})
+	handler.Register(`a"b`, &fixedStats{Accepts: 1})
+
+	output := &bytes.Buffer{}
+	n, err := handler.WriteTo(output)
+	if err != nil || n != int64(output.Len()) {
+		t.Fatalf("write %d bytes, err %v, output %d bytes", n, err, output.Len())
+	}
+	text := output.String()
+
+	lines := []string{
+		"# TYPE gonetio_bytes_read_total counter",
+		`gonetio_bytes_read_total{name="gate"} 100`,
+		`gonetio_write_blocking_drops_total{name="gate"} 2`,
+		`gonetio_recv_queue_drops_total{name="gate"} 4`,
+		"# TYPE gonetio_send_queue_depth gauge",
+		`gonetio_send_queue_depth{name="gate"} 3`,
+		`gonetio_accepts_total{name="gate"} 7`,
+		`gonetio_accepts_total{name="a\"b"} 1`,
+		`gonetio_active_connections{name="gate"} 5`,
+		`gonetio_connections_closed_total{name="gate",reason="idle_timeout"} 1`,
+		`gonetio_connections_closed_total{name="gate",reason="remote"} 2`,
+	}
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("output has no line %q\n%s", line, text)
+		}
+	}
+
+	// the sources are rendered in the register order, the reasons sorted
+	if strings.Index(text, `gonetio_accepts_total{name="gate"}`) > strings.Index(text, `gonetio_accepts_total{name="a\"b"}`) {
+		t.Fatalf("sources out of the register order\n%s", text)
+	}
+	if strings.Index(text, `reason="idle_timeout"`) > strings.Index(text, `reason="remote"`) {
+		t.Fatalf("close reasons not sorted\n%s", text)
+	}
+}
+
+func TestMetricsHandlerRegister(t *testing.T) {
+	handler := NewMetricsHandler()
+	handler.Register("a", &fixedStats{Accepts: 1})
+	handler.Register("b", &fixedStats{Accepts: 2})
+	handler.Register("a", &fixedStats{Accepts: 3})
+	handler.Unregister("b")
+	handler.Unregister("none")
+
+	output := &bytes.Buffer{}
+	handler.WriteTo(output)
+	text := output.String()
+
+	if strings.Count(text, "gonetio_accepts_total{") != 1 || !strings.Contains(text, `gonetio_accepts_total{name="a"} 3`) {
+		t.Fatalf("accepts after the replace and the unregister\n%s", text)
+	}
+}
+
+func TestMetricsHandlerServeHTTP(t *testing.T) {
+	handler := NewMetricsHandler()
+	handler.Register("gate", &fixedStats{Accepts: 9})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != prometheusContentType {
+		t.Fatalf("content type %q", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), `gonetio_accepts_total{name="gate"} 9`) {
+		t.Fatalf("body\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,291 @@
+// File Client
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gonetio"
+	"gonetio/codec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the name of the client filter
+const ClientName = "RpcClient"
+
+// the default call timeout
+const DefaultCallTimeout = 10 * time.Second
+
+// the sequence number flag of the reply
+// the request sequence number is in [1, ReplyFlag), the reply carries the request one with the flag set,
+// the sequence number 0 is a one way message
+const ReplyFlag uint32 = 0x80000000
+
+// error type
+var (
+	ErrNotConnected    = errors.New("RPC connection is not connected")
+	ErrConnClosed      = errors.New("RPC connection closed before the reply arrived")
+	ErrCallTimeout     = errors.New("RPC call timeout")
+	ErrNotRequest      = errors.New("RPC message is not a request")
+	ErrUnexpectedReply = errors.New("RPC unexpected reply")
+)
+
+// the rpc client filter
+// it must be added after a codec.MessageCodec with the sequence number enabled,
+// it stamps each call with a sequence number and completes the future with the reply,
+// the other messages go to the next filter
+type Client struct {
+	gonetio.IoHandlerAdaptor
+	defaultTimeout time.Duration      // the timeout of the call without a deadline
+	nextSeq        uint32             // the next sequence number
+	mtx            *sync.Mutex        // guard the fields below
+	filter         *gonetio.IoFilter  // the filter of the client, nil if not connected
+	con            *gonetio.Tcpcon    // the connection, nil if not connected
+	pending        map[uint32]*Future // <seq, the call waiting for the reply>
+	streams        *streamTable       // the streams opened, keyed by the id with ReplyFlag
+}
+
+// new rpc client filter, DefaultCallTimeout if the defaultTimeout is not positive
+func NewClient(defaultTimeout time.Duration) *Client {
+	if defaultTimeout <= 0 {
+		defaultTimeout = DefaultCallTimeout
+	}
+
+	handler := &Client{
+		defaultTimeout: defaultTimeout,
+		nextSeq:        0,
+		mtx:            &sync.Mutex{},
+		pending:        make(map[uint32]*Future),
+		streams:        newStreamTable(),
+	}
+	handler.SetBoundType(gonetio.InBound | gonetio.OutBound)
+	return handler
+}
+
+// get the rpc client filter added with ClientName to the chain of the connection,
+// so the server side can call the client over the same connection
+func GetClient(con *gonetio.Tcpcon) *Client {
+	if con == nil || con.GetIoFilterChain() == nil {
+		return nil
+	}
+
+	filter := con.GetIoFilterChain().Get(ClientName)
+	if filter == nil {
+		return nil
+	}
+
+	client, _ := filter.GetHandler().(*Client)
+	return client
+}
+
+// generate the next request sequence number, skip 0
+func (this *Client) generateNextSeq() uint32 {
+	for {
+		seq := atomic.AddUint32(&this.nextSeq, 1) &^ ReplyFlag
+		if seq != 0 {
+			return seq
+		}
+	}
+}
+
+// get the count of the calls waiting for the reply
+func (this *Client) PendingCount() int {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return len(this.pending)
+}
+
+// get the count of the streams opened
+func (this *Client) StreamCount() int {
+	return this.streams.count()
+}
+
+// start a call, the future fails with ErrCallTimeout if no reply in the timeout,
+// or with the error at once if the request can not be written,
+// the default timeout is used if the timeout is not positive
+func (this *Client) Go(msg interface{}, timeout time.Duration) *Future {
+	if timeout <= 0 {
+		timeout = this.defaultTimeout
+	}
+
+	future := newFuture(this.generateNextSeq(), msg)
+
+	this.mtx.Lock()
+	filter := this.filter
+	if filter == nil {
+		this.mtx.Unlock()
+		future.complete(nil, ErrNotConnected)
+		return future
+	}
+
+	// arm the timer after the call registered, so the timeout always finds it
+	this.pending[future.Seq] = future
+	future.timer = time.AfterFunc(timeout, func() {
+		this.fail(future.Seq, fmt.Errorf("%w: seq %d after %s", ErrCallTimeout, future.Seq, timeout.String()))
+	})
+	this.mtx.Unlock()
+
+	// fail the call at once if the request can't be written, like the encode failure or the overflow
+	seq := future.Seq
+	filter.FireWriteAsync(&codec.Envelope{Seq: seq, Body: msg}).OnComplete(func(err error) {
+		if err != nil {
+			this.fail(seq, err)
+		}
+	})
+	return future
+}
+
+// call and wait for the reply
+// the call fails when the context done, the default timeout is used if the context has no deadline
+func (this *Client) Call(ctx context.Context, msg interface{}) (interface{}, error) {
+	timeout := this.defaultTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrCallTimeout, context.DeadlineExceeded.Error())
+		}
+	}
+
+	future := this.Go(msg, timeout)
+	select {
+	case <-future.Done():
+	case <-ctx.Done():
+		this.fail(future.Seq, ctx.Err())
+	}
+
+	return future.Wait()
+}
+
+// open a stream to the stream method of the peer
+func (this *Client) openStream(ctx context.Context, method string, window uint32, serializer codec.Serializer) (*Stream, error) {
+	this.mtx.Lock()
+	filter := this.filter
+	this.mtx.Unlock()
+
+	if filter == nil {
+		return nil, ErrNotConnected
+	}
+
+	open := &StreamOpenFrame{
+		ID:     this.generateNextSeq(),
+		Method: method,
+		Window: window,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		open.Timeout = int64(time.Until(deadline))
+		if open.Timeout <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrCallTimeout, context.DeadlineExceeded.Error())
+		}
+	}
+
+	key := open.ID | ReplyFlag
+	stream := newStream(ctx, open.ID, method, window, filter.GetCon(), serializer, func(s *Stream) {
+		this.streams.remove(key, s)
+	})
+	this.streams.add(key, stream)
+
+	stream.writeFrame(open)
+	stream.start()
+	return stream, nil
+}
+
+// remove the call and complete it with the error
+func (this *Client) fail(seq uint32, err error) {
+	this.mtx.Lock()
+	future := this.pending[seq]
+	delete(this.pending, seq)
+	this.mtx.Unlock()
+
+	if future != nil {
+		future.complete(nil, err)
+	}
+}
+
+// Connection opened
+func (this *Client) ConnOpened(filter *gonetio.IoFilter) {
+	con := filter.GetCon()
+
+	this.mtx.Lock()
+	this.filter = filter
+	this.con = con
+	this.mtx.Unlock()
+
+	con.AddCloseListener(this.connLost)
+
+	filter.ConnOpened()
+}
+
+// Connection closed
+func (this *Client) ConnClosed(filter *gonetio.IoFilter) {
+	this.connLost(filter.GetCon())
+
+	filter.ConnClosed()
+}
+
+// fail all the calls waiting for the reply and reset all the streams opened
+func (this *Client) connLost(con *gonetio.Tcpcon) {
+	this.mtx.Lock()
+	if this.con != con {
+		this.mtx.Unlock()
+		return
+	}
+	pending := this.pending
+	this.filter = nil
+	this.con = nil
+	this.pending = make(map[uint32]*Future)
+	this.mtx.Unlock()
+
+	for seq, future := range pending {
+		future.complete(nil, fmt.Errorf("%w: seq %d", ErrConnClosed, seq))
+	}
+
+	this.streams.resetAll(NewErrorFrame(CodeCanceled, "connection closed"))
+}
+
+// The event fired when receive message from the connection
+// complete the call with the reply, the body implements error fails the call,
+// the frames of the streams opened go to the streams
+func (this *Client) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	envelope, ok := obj.(*codec.Envelope)
+	if !ok {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	if frame, ok := envelope.Body.(streamFrame); ok && frame.streamID()&ReplyFlag != 0 {
+		this.streams.dispatch(filter.GetCon(), frame.streamID(), frame)
+		return
+	}
+
+	if envelope.Seq&ReplyFlag == 0 {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	seq := envelope.Seq &^ ReplyFlag
+
+	this.mtx.Lock()
+	future := this.pending[seq]
+	delete(this.pending, seq)
+	this.mtx.Unlock()
+
+	if future == nil {
+		filter.Logger().Log(gonetio.LvlWarn, "rpc client recv the reply, but the call is gone, drop it", "seq", seq)
+		return
+	}
+
+	if err, ok := envelope.Body.(error); ok {
+		future.complete(nil, err)
+		return
+	}
+	future.complete(envelope.Body, nil)
+}
+
+// Clone
+func (this *Client) Clone() gonetio.IoHandler {
+	return NewClient(this.defaultTimeout)
+}
@@ -0,0 +1,148 @@
+// File Client test
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"gonetio"
+	"gonetio/codec"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type registeredMsg struct{ N int }
+type unregisteredMsg struct{ N int }
+
+// start a client connection over the pipe, the peer never replies
+func startClientCon(t *testing.T) (*Client, net.Conn) {
+	registry := codec.NewMessageRegistry()
+	registry.Register(1, &registeredMsg{})
+
+	local, remote := net.Pipe()
+	con := gonetio.NewConnFull(local, 64, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	chain.AddLast("dec", codec.NewVarintFrameDecoder(1<<20))
+	chain.AddLast("enc", codec.NewVarintFrameEncoder())
+	chain.AddLast("msg", codec.NewMessageCodec(registry, codec.NewJsonSerializer(), true))
+	chain.AddLast(ClientName, NewClient(time.Minute))
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	t.Cleanup(func() {
+		con.Close()
+		remote.Close()
+	})
+	return GetClient(con), remote
+}
+
+func TestClientGoWriteFailed(t *testing.T) {
+	client, _ := startClientCon(t)
+
+	future := client.Go(&unregisteredMsg{N: 1}, 0)
+	select {
+	case <-future.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the call waits for the timeout after the encode failed")
+	}
+
+	if _, err := future.Wait(); err == nil || errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("err %v, expect the encode error", err)
+	}
+	if client.PendingCount() != 0 {
+		t.Fatalf("pending %d after the write failed", client.PendingCount())
+	}
+}
+
+func TestClientGoConnectionClosed(t *testing.T) {
+	client, remote := startClientCon(t)
+
+	// the peer never reads, the request is failed when the connection closed
+	future := client.Go(&registeredMsg{N: 1}, 0)
+	remote.Close()
+
+	select {
+	case <-future.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the call waits for the timeout after the connection closed")
+	}
+	if _, err := future.Wait(); err == nil || errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("err %v, expect the write error", err)
+	}
+}
+
+func TestClientGoTimeout(t *testing.T) {
+	// the tiny timeout fires before the request is written, the call is registered already
+	timeouts := []time.Duration{20 * time.Millisecond, time.Nanosecond}
+
+	for _, timeout := range timeouts {
+		client, _ := startClientCon(t)
+
+		start := time.Now()
+		future := client.Go(&registeredMsg{N: 1}, timeout)
+		select {
+		case <-future.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("timeout %v, the call is not timed out", timeout)
+		}
+		if _, err := future.Wait(); !errors.Is(err, ErrCallTimeout) {
+			t.Fatalf("timeout %v, err %v, expect ErrCallTimeout", timeout, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("timeout %v, timed out after %v", timeout, elapsed)
+		}
+		if client.PendingCount() != 0 {
+			t.Fatalf("timeout %v, pending %d after the timeout", timeout, client.PendingCount())
+		}
+	}
+}
+
+func TestReplySendFailed(t *testing.T) {
+	client, _ := startClientCon(t)
+	con := client.filter.GetCon()
+
+	request := &codec.Envelope{Seq: 1, Body: &registeredMsg{N: 1}}
+	if err := Reply(con, request, &unregisteredMsg{N: 1}); err == nil {
+		t.Fatal("reply the unregistered message, expect the encode error")
+	}
+}
+
+func TestClientCallContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		errs []error // any of them
+	}{
+		{"canceled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return ctx, cancel
+		}, []error{context.Canceled}},
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, []error{ErrCallTimeout, context.DeadlineExceeded}},
+		{"expired", func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		}, []error{ErrCallTimeout}},
+	}
+
+	client, _ := startClientCon(t)
+	for _, test := range tests {
+		ctx, cancel := test.ctx()
+		_, err := client.Call(ctx, &registeredMsg{N: 1})
+		cancel()
+
+		matched := false
+		for _, expect := range test.errs {
+			matched = matched || errors.Is(err, expect)
+		}
+		if !matched {
+			t.Fatalf("%s: err %v, expect one of %v", test.name, err, test.errs)
+		}
+		if client.PendingCount() != 0 {
+			t.Fatalf("%s: pending %d after the call failed", test.name, client.PendingCount())
+		}
+	}
+}
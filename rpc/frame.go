@@ -0,0 +1,111 @@
+// File Frame
+
+package rpc
+
+import (
+	"fmt"
+	"gonetio/codec"
+)
+
+// the count of the message ids the frames take
+const FrameIDCount = 8
+
+// the error code of the error frame
+const (
+	CodeUnknown          uint32 = 1 // the method returned a plain error
+	CodeMethodNotFound   uint32 = 2 // no such method
+	CodeBadRequest       uint32 = 3 // the request can't be decoded
+	CodeDeadlineExceeded uint32 = 4 // the deadline exceeded before the method returned
+	CodeCanceled         uint32 = 5 // the call was canceled
+	CodeInternal         uint32 = 6 // the method panicked or the reply can't be encoded
+	CodeFlowControl      uint32 = 7 // the peer sent more stream messages than the credits
+)
+
+// the frame calls a method registered to the server
+type CallFrame struct {
+	Method  string // the method name, "Service.Method"
+	Timeout int64  // the time left of the caller in nanoseconds, 0 if no deadline
+	Payload []byte // the serialized request
+}
+
+// the frame replies the call
+type ReplyFrame struct {
+	Payload []byte // the serialized response
+}
+
+// the frame fails the call, it's the error returned to the caller
+// a method can return an *ErrorFrame to choose the code
+type ErrorFrame struct {
+	Code    uint32 // the error code
+	Message string // the error message
+}
+
+// new error frame
+func NewErrorFrame(code uint32, format string, args ...interface{}) *ErrorFrame {
+	return &ErrorFrame{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (this *ErrorFrame) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", this.Code, this.Message)
+}
+
+// the frame opens a stream to a stream method registered to the server
+// the stream frames sent by the opener carry the id, the ones sent by the server carry the id with ReplyFlag,
+// so both peers can open streams over one connection
+type StreamOpenFrame struct {
+	ID      uint32 // the stream id
+	Method  string // the method name, "Service.Method"
+	Timeout int64  // the time left of the opener in nanoseconds, 0 if no deadline
+	Window  uint32 // the initial credits of both directions
+}
+
+// the frame carries a stream message
+type StreamDataFrame struct {
+	ID      uint32 // the stream id
+	Payload []byte // the serialized message
+}
+
+// the frame grants the peer more credits to send
+type StreamCreditFrame struct {
+	ID      uint32 // the stream id
+	Credits uint32 // the count of the messages the peer can send more
+}
+
+// the frame closes the send direction of the sender
+type StreamCloseFrame struct {
+	ID uint32 // the stream id
+}
+
+// the frame aborts both directions of the stream
+type StreamResetFrame struct {
+	ID      uint32 // the stream id
+	Code    uint32 // the error code
+	Message string // the error message
+}
+
+// the stream frames
+type streamFrame interface {
+	streamID() uint32
+}
+
+func (this *StreamOpenFrame) streamID() uint32   { return this.ID }
+func (this *StreamDataFrame) streamID() uint32   { return this.ID }
+func (this *StreamCreditFrame) streamID() uint32 { return this.ID }
+func (this *StreamCloseFrame) streamID() uint32  { return this.ID }
+func (this *StreamResetFrame) streamID() uint32  { return this.ID }
+
+// register the frames to the registry with the ids from firstID to firstID + FrameIDCount - 1
+// the frames have string and []byte fields, so serialize them with gob or json
+func RegisterFrames(registry *codec.MessageRegistry, firstID uint32) error {
+	frames := []interface{}{&CallFrame{}, &ReplyFrame{}, &ErrorFrame{},
+		&StreamOpenFrame{}, &StreamDataFrame{}, &StreamCreditFrame{}, &StreamCloseFrame{}, &StreamResetFrame{}}
+	for i, frame := range frames {
+		if err := registry.Register(firstID+uint32(i), frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// File Future
+
+package rpc
+
+import (
+	"sync"
+	"time"
+)
+
+// the future of a call, completed by the reply, the timeout or the connection closed
+type Future struct {
+	Seq     uint32        // the sequence number of the call
+	Request interface{}   // the request message
+	reply   interface{}   // the reply message
+	err     error         // the error of the call
+	done    chan struct{} // closed when completed
+	timer   *time.Timer   // the timeout timer
+	once    sync.Once     // make sure complete just once
+}
+
+// new future
+func newFuture(seq uint32, request interface{}) *Future {
+	return &Future{
+		Seq:     seq,
+		Request: request,
+		done:    make(chan struct{}),
+	}
+}
+
+// complete the future, return false if already completed
+func (this *Future) complete(reply interface{}, err error) bool {
+	completed := false
+	this.once.Do(func() {
+		this.reply = reply
+		this.err = err
+		completed = true
+		if this.timer != nil {
+			this.timer.Stop()
+		}
+		close(this.done)
+	})
+	return completed
+}
+
+// get the channel closed when the call completed
+func (this *Future) Done() <-chan struct{} {
+	return this.done
+}
+
+// wait for the call completed, return the reply message or the error
+func (this *Future) Wait() (interface{}, error) {
+	<-this.done
+	return this.reply, this.err
+}
@@ -0,0 +1,29 @@
+// File Reply
+
+package rpc
+
+import (
+	"gonetio"
+	"gonetio/codec"
+)
+
+// is the envelope a request waiting for the reply
+func IsRequest(envelope *codec.Envelope) bool {
+	return envelope != nil && envelope.Seq != 0 && envelope.Seq&ReplyFlag == 0
+}
+
+// reply the request, the msg is the reply message,
+// a registered message implements error fails the call of the peer
+// the error of the send is returned, like the encode failure or the send queue overflow
+// e.g. rpc.Reply(ctx.Con, ctx.Envelope, &LoginResponse{}) in a dispatcher handler func
+func Reply(con *gonetio.Tcpcon, request *codec.Envelope, msg interface{}) error {
+	if !IsRequest(request) {
+		return ErrNotRequest
+	}
+
+	if con == nil || !con.IsConnected() {
+		return ErrNotConnected
+	}
+
+	return con.Send(&codec.Envelope{Seq: request.Seq | ReplyFlag, Body: msg})
+}
@@ -0,0 +1,284 @@
+// File Server
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"gonetio"
+	"gonetio/codec"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// the name of the server filter
+const ServerName = "RpcServer"
+
+// the context key of the connection
+type conContextKey struct{}
+
+// get the connection the call arrived from
+func ConFromContext(ctx context.Context) *gonetio.Tcpcon {
+	con, _ := ctx.Value(conContextKey{}).(*gonetio.Tcpcon)
+	return con
+}
+
+// the rpc server filter, it dispatches the call frames to the registered service methods
+// it must be added after a codec.MessageCodec with the sequence number enabled and the frames registered,
+// each call runs in its own goroutine with the deadline of the caller,
+// the calls are canceled when the connection closed, the other messages go to the next filter
+// the services are shared by the cloned servers
+type Server struct {
+	gonetio.IoHandlerAdaptor
+	services   *serviceMap        // the registered services
+	serializer codec.Serializer   // the serializer of the payloads
+	mtx        *sync.Mutex        // guard the fields below
+	ctx        context.Context    // the context of the connection, canceled when closed
+	cancel     context.CancelFunc // cancel the context
+	streams    *streamTable       // the streams opened by the peer, keyed by the id
+}
+
+// new rpc server filter
+func NewServer(serializer codec.Serializer) *Server {
+	return newServer(newServiceMap(), serializer)
+}
+
+func newServer(services *serviceMap, serializer codec.Serializer) *Server {
+	handler := &Server{
+		services:   services,
+		serializer: serializer,
+		mtx:        &sync.Mutex{},
+		streams:    newStreamTable(),
+	}
+	handler.SetBoundType(gonetio.InBound)
+	return handler
+}
+
+// register the exported methods of shape func(ctx context.Context, *Req) (*Resp, error)
+// and the stream methods of shape func(ctx context.Context, *Stream) error of the object,
+// the service name is the type name of the object
+func (this *Server) Register(rcvr interface{}) error {
+	return this.services.register(reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), rcvr)
+}
+
+// register the methods of the object with the service name
+func (this *Server) RegisterName(name string, rcvr interface{}) error {
+	return this.services.register(name, rcvr)
+}
+
+// Connection opened
+func (this *Server) ConnOpened(filter *gonetio.IoFilter) {
+	con := filter.GetCon()
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), conContextKey{}, con))
+
+	this.mtx.Lock()
+	this.ctx, this.cancel = ctx, cancel
+	this.mtx.Unlock()
+
+	con.AddCloseListener(func(*gonetio.Tcpcon) {
+		this.connLost(ctx)
+	})
+
+	filter.ConnOpened()
+}
+
+// Connection closed
+func (this *Server) ConnClosed(filter *gonetio.IoFilter) {
+	this.mtx.Lock()
+	ctx := this.ctx
+	this.mtx.Unlock()
+
+	if ctx != nil {
+		this.connLost(ctx)
+	}
+
+	filter.ConnClosed()
+}
+
+// cancel the calls and reset the streams running
+func (this *Server) connLost(ctx context.Context) {
+	this.mtx.Lock()
+	if this.ctx != ctx {
+		this.mtx.Unlock()
+		return
+	}
+	this.cancel()
+	this.ctx, this.cancel = nil, nil
+	this.mtx.Unlock()
+
+	this.streams.resetAll(NewErrorFrame(CodeCanceled, "connection closed"))
+}
+
+// get the context of the connection
+func (this *Server) context() context.Context {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.ctx == nil {
+		return context.Background()
+	}
+	return this.ctx
+}
+
+// get the count of the streams opened by the peer
+func (this *Server) StreamCount() int {
+	return this.streams.count()
+}
+
+// The event fired when receive message from the connection
+func (this *Server) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	envelope, ok := obj.(*codec.Envelope)
+	if !ok {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	if frame, ok := envelope.Body.(streamFrame); ok && frame.streamID()&ReplyFlag == 0 {
+		if open, ok := frame.(*StreamOpenFrame); ok {
+			this.openStream(filter.GetCon(), open)
+		} else {
+			this.streams.dispatch(filter.GetCon(), frame.streamID(), frame)
+		}
+		return
+	}
+
+	if !IsRequest(envelope) {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	call, ok := envelope.Body.(*CallFrame)
+	if !ok {
+		filter.MessageReceived(obj)
+		return
+	}
+
+	con := filter.GetCon()
+	go func() {
+		if err := Reply(con, envelope, this.serve(con, call)); err != nil {
+			con.Logger().Log(gonetio.LvlWarn, "rpc reply failed", "method", call.Method, "seq", envelope.Seq, "err", err)
+		}
+	}()
+}
+
+// serve the call, return the reply frame or the error frame
+func (this *Server) serve(con *gonetio.Tcpcon, call *CallFrame) (reply interface{}) {
+	method := this.services.get(call.Method)
+	if method == nil {
+		return NewErrorFrame(CodeMethodNotFound, "method %s not found", call.Method)
+	}
+
+	if method.stream {
+		return NewErrorFrame(CodeMethodNotFound, "method %s is a stream method", call.Method)
+	}
+
+	req := method.newRequest()
+	if err := this.serializer.Unmarshal(call.Payload, req); err != nil {
+		return NewErrorFrame(CodeBadRequest, "decode request of %s, %s", call.Method, err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(this.context())
+	if call.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(call.Timeout))
+	}
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			con.Logger().Log(gonetio.LvlError, "rpc method panic recover", "method", call.Method, "panic", p, "stack", string(debug.Stack()))
+			reply = NewErrorFrame(CodeInternal, "method %s panic: %v", call.Method, p)
+		}
+	}()
+
+	resp, err := method.call(ctx, req)
+	if err != nil {
+		return toErrorFrame(ctx, err)
+	}
+
+	if reflect.ValueOf(resp).IsNil() {
+		return NewErrorFrame(CodeInternal, "method %s returned nil reply", call.Method)
+	}
+
+	payload, err := this.serializer.Marshal(resp)
+	if err != nil {
+		return NewErrorFrame(CodeInternal, "encode reply of %s, %s", call.Method, err.Error())
+	}
+
+	return &ReplyFrame{Payload: payload}
+}
+
+// accept the stream opened by the peer, run the stream method in its own goroutine
+// the stream finishes when the method returns, the error returned resets the stream
+func (this *Server) openStream(con *gonetio.Tcpcon, open *StreamOpenFrame) {
+	id := open.ID | ReplyFlag
+	method := this.services.get(open.Method)
+	if method == nil || !method.stream {
+		con.Write(&codec.Envelope{Body: &StreamResetFrame{ID: id, Code: CodeMethodNotFound, Message: "stream method " + open.Method + " not found"}})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(this.context())
+	if open.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(open.Timeout))
+	}
+
+	stream := newStream(ctx, id, open.Method, open.Window, con, this.serializer, func(s *Stream) {
+		cancel()
+		this.streams.remove(open.ID, s)
+	})
+	if !this.streams.add(open.ID, stream) {
+		cancel()
+		con.Write(&codec.Envelope{Body: &StreamResetFrame{ID: id, Code: CodeBadRequest, Message: "stream id already in use"}})
+		return
+	}
+	stream.start()
+
+	go func() {
+		err := this.serveStream(method, stream)
+		if err != nil {
+			stream.reset(toErrorFrame(stream.Context(), err), true)
+			return
+		}
+
+		stream.CloseSend()
+		stream.finish()
+	}()
+}
+
+// invoke the stream method, recover the panic
+func (this *Server) serveStream(method *methodType, stream *Stream) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			stream.con.Logger().Log(gonetio.LvlError, "rpc stream method panic recover", "method", stream.Method(), "panic", p, "stack", string(debug.Stack()))
+			err = NewErrorFrame(CodeInternal, "stream method %s panic: %v", stream.Method(), p)
+		}
+	}()
+
+	return method.callStream(stream.Context(), stream)
+}
+
+// convert the error returned by the method to the error frame
+func toErrorFrame(ctx context.Context, err error) *ErrorFrame {
+	var frame *ErrorFrame
+	if errors.As(err, &frame) {
+		return frame
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+		return NewErrorFrame(CodeDeadlineExceeded, "%s", err.Error())
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return NewErrorFrame(CodeCanceled, "%s", err.Error())
+	}
+
+	return NewErrorFrame(CodeUnknown, "%s", err.Error())
+}
+
+// Clone
+// the clone shares the services
+func (this *Server) Clone() gonetio.IoHandler {
+	return newServer(this.services, this.serializer)
+}
@@ -0,0 +1,165 @@
+// File Service
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// error type
+var (
+	ErrServiceInvalid   = errors.New("RPC service is invalid")
+	ErrServiceDuplicate = errors.New("RPC service already registered")
+)
+
+var (
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfStream  = reflect.TypeOf((*Stream)(nil))
+)
+
+// the method of a service, func(ctx context.Context, *Req) (*Resp, error),
+// or the stream method func(ctx context.Context, *Stream) error
+type methodType struct {
+	receiver reflect.Value // the service object
+	method   reflect.Method
+	reqType  reflect.Type // the request struct type, nil for the stream method
+	stream   bool         // is the stream method
+}
+
+// new a request to decode into
+func (this *methodType) newRequest() interface{} {
+	return reflect.New(this.reqType).Interface()
+}
+
+// invoke the method
+func (this *methodType) call(ctx context.Context, req interface{}) (interface{}, error) {
+	results := this.method.Func.Call([]reflect.Value{this.receiver, reflect.ValueOf(ctx), reflect.ValueOf(req)})
+
+	var err error = nil
+	if e := results[1].Interface(); e != nil {
+		err = e.(error)
+	}
+	return results[0].Interface(), err
+}
+
+// invoke the stream method
+func (this *methodType) callStream(ctx context.Context, stream *Stream) error {
+	results := this.method.Func.Call([]reflect.Value{this.receiver, reflect.ValueOf(ctx), reflect.ValueOf(stream)})
+
+	if e := results[0].Interface(); e != nil {
+		return e.(error)
+	}
+	return nil
+}
+
+// the registry of the service methods, keyed by "Service.Method"
+type serviceMap struct {
+	mtx      *sync.RWMutex
+	services map[string]bool        // the registered service names
+	methods  map[string]*methodType // <"Service.Method", method>
+}
+
+// new service map
+func newServiceMap() *serviceMap {
+	return &serviceMap{
+		mtx:      &sync.RWMutex{},
+		services: make(map[string]bool),
+		methods:  make(map[string]*methodType),
+	}
+}
+
+// is the method of shape func(ctx context.Context, *Req) (*Resp, error)
+func suitableMethod(method reflect.Method) bool {
+	mtype := method.Type
+	if method.PkgPath != "" || mtype.NumIn() != 3 || mtype.NumOut() != 2 {
+		return false
+	}
+
+	if mtype.In(1) != typeOfContext {
+		return false
+	}
+
+	reqType := mtype.In(2)
+	if reqType.Kind() != reflect.Ptr || reqType.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	respType := mtype.Out(0)
+	if respType.Kind() != reflect.Ptr || respType.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	return mtype.Out(1) == typeOfError
+}
+
+// is the method of shape func(ctx context.Context, *Stream) error
+func suitableStreamMethod(method reflect.Method) bool {
+	mtype := method.Type
+	if method.PkgPath != "" || mtype.NumIn() != 3 || mtype.NumOut() != 1 {
+		return false
+	}
+
+	return mtype.In(1) == typeOfContext && mtype.In(2) == typeOfStream && mtype.Out(0) == typeOfError
+}
+
+// register the suitable methods and stream methods of the object with the service name
+func (this *serviceMap) register(name string, rcvr interface{}) error {
+	if name == "" || rcvr == nil {
+		return fmt.Errorf("%w: no service name", ErrServiceInvalid)
+	}
+
+	receiver := reflect.ValueOf(rcvr)
+	rtype := receiver.Type()
+
+	methods := make(map[string]*methodType)
+	for i := 0; i < rtype.NumMethod(); i++ {
+		method := rtype.Method(i)
+		if suitableStreamMethod(method) {
+			methods[name+"."+method.Name] = &methodType{
+				receiver: receiver,
+				method:   method,
+				stream:   true,
+			}
+			continue
+		}
+
+		if !suitableMethod(method) {
+			continue
+		}
+		methods[name+"."+method.Name] = &methodType{
+			receiver: receiver,
+			method:   method,
+			reqType:  method.Type.In(2).Elem(),
+		}
+	}
+
+	if len(methods) == 0 {
+		return fmt.Errorf("%w: service %s has no method of func(context.Context, *Req) (*Resp, error) or func(context.Context, *Stream) error", ErrServiceInvalid, name)
+	}
+
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.services[name] {
+		return fmt.Errorf("%w: service %s", ErrServiceDuplicate, name)
+	}
+
+	this.services[name] = true
+	for methodName, method := range methods {
+		this.methods[methodName] = method
+	}
+	return nil
+}
+
+// get the method by "Service.Method"
+func (this *serviceMap) get(name string) *methodType {
+	this.mtx.RLock()
+	defer this.mtx.RUnlock()
+
+	return this.methods[name]
+}
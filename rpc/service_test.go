@@ -0,0 +1,153 @@
+// File Service test
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"gonetio"
+	"gonetio/codec"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type echoRequest struct {
+	Text  string
+	Sleep time.Duration // sleep before the reply, or until the context done
+}
+
+type echoResponse struct {
+	Text string
+}
+
+// the service of the tests, the methods report the context error ended them
+type testService struct {
+	ended chan error
+	sent  int64 // the messages sent by the stream methods
+}
+
+func newTestService() *testService {
+	return &testService{ended: make(chan error, 16)}
+}
+
+func (this *testService) Echo(ctx context.Context, req *echoRequest) (*echoResponse, error) {
+	if req.Sleep > 0 {
+		select {
+		case <-time.After(req.Sleep):
+		case <-ctx.Done():
+			this.ended <- ctx.Err()
+			return nil, ctx.Err()
+		}
+	}
+	return &echoResponse{Text: req.Text}, nil
+}
+
+// start the rpc peer over the conn, the chain has both the client and the server
+func startRPCPeer(t *testing.T, conn net.Conn, server *Server) *gonetio.Tcpcon {
+	registry := codec.NewMessageRegistry()
+	if err := RegisterFrames(registry, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	con := gonetio.NewConnFull(conn, 64, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	chain.AddLast("dec", codec.NewVarintFrameDecoder(1<<20))
+	chain.AddLast("enc", codec.NewVarintFrameEncoder())
+	chain.AddLast("msg", codec.NewMessageCodec(registry, codec.NewJsonSerializer(), true))
+	chain.AddLast(ClientName, NewClient(time.Minute))
+	chain.AddLast("server", server)
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	t.Cleanup(con.Close)
+	return con
+}
+
+// start the rpc peers over the pipe, both serve the service
+func startRPCPair(t *testing.T, service interface{}) (*gonetio.Tcpcon, *Server, *gonetio.Tcpcon, *Server) {
+	local, remote := net.Pipe()
+	localServer, remoteServer := NewServer(codec.NewJsonSerializer()), NewServer(codec.NewJsonSerializer())
+	if err := localServer.RegisterName("Test", service); err != nil {
+		t.Fatal(err)
+	}
+	if err := remoteServer.RegisterName("Test", service); err != nil {
+		t.Fatal(err)
+	}
+
+	return startRPCPeer(t, local, localServer), localServer, startRPCPeer(t, remote, remoteServer), remoteServer
+}
+
+func TestServiceClientInvoke(t *testing.T) {
+	service := newTestService()
+	con, _, _, _ := startRPCPair(t, service)
+	client := NewServiceClient(GetClient(con), codec.NewJsonSerializer())
+
+	resp := &echoResponse{}
+	if err := client.Invoke(context.Background(), "Test.Echo", &echoRequest{Text: "hello"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "hello" {
+		t.Fatalf("reply %q", resp.Text)
+	}
+
+	var frame *ErrorFrame
+	err := client.Invoke(context.Background(), "Test.Missing", &echoRequest{}, resp)
+	if !errors.As(err, &frame) || frame.Code != CodeMethodNotFound {
+		t.Fatalf("call the missing method err %v", err)
+	}
+}
+
+// the deadline of the caller is sent to the server, the method sees its context done
+func TestServiceClientInvokeDeadline(t *testing.T) {
+	service := newTestService()
+	con, _, _, _ := startRPCPair(t, service)
+	client := NewServiceClient(GetClient(con), codec.NewJsonSerializer())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the server may fail the call before the client times out
+	var frame *ErrorFrame
+	err := client.Invoke(ctx, "Test.Echo", &echoRequest{Sleep: time.Minute}, &echoResponse{})
+	if !errors.Is(err, ErrCallTimeout) && !errors.Is(err, context.DeadlineExceeded) &&
+		!(errors.As(err, &frame) && frame.Code == CodeDeadlineExceeded) {
+		t.Fatalf("err %v, expect the timeout", err)
+	}
+
+	select {
+	case err := <-service.ended:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("the method ended with %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the method runs after the deadline of the caller")
+	}
+
+	if GetClient(con).PendingCount() != 0 {
+		t.Fatalf("pending %d after the timeout", GetClient(con).PendingCount())
+	}
+}
+
+// the calls in flight fail when the connection closed, not at the timeout
+func TestServiceClientInvokeConnectionClosed(t *testing.T) {
+	service := newTestService()
+	con, _, peer, _ := startRPCPair(t, service)
+	client := NewServiceClient(GetClient(con), codec.NewJsonSerializer())
+
+	time.AfterFunc(50*time.Millisecond, peer.Close)
+	err := client.Invoke(context.Background(), "Test.Echo", &echoRequest{Sleep: time.Minute}, &echoResponse{})
+	if !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("err %v, expect ErrConnClosed", err)
+	}
+
+	select {
+	case err := <-service.ended:
+		if err != context.Canceled {
+			t.Fatalf("the method ended with %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the method runs after the connection closed")
+	}
+}
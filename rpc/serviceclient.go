@@ -0,0 +1,74 @@
+// File ServiceClient
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"gonetio/codec"
+	"time"
+)
+
+// the client calls the service methods through the rpc client filter
+type ServiceClient struct {
+	client     *Client          // the rpc client filter
+	serializer codec.Serializer // the serializer of the payloads
+	window     uint32           // the credits of each direction of the streams opened
+}
+
+// new service client
+func NewServiceClient(client *Client, serializer codec.Serializer) *ServiceClient {
+	return &ServiceClient{
+		client:     client,
+		serializer: serializer,
+		window:     DefaultStreamWindow,
+	}
+}
+
+// set the credits of each direction of the streams opened
+func (this *ServiceClient) SetStreamWindow(window uint32) {
+	this.window = window
+}
+
+// open a stream to the stream method "Service.Method" of the peer
+// the deadline of the context is sent to the peer, the stream is reset when the context canceled,
+// cancel the context or close send and recv until io.EOF to release it
+// e.g. a server streaming call: Send the request, CloseSend, then Recv until io.EOF
+func (this *ServiceClient) OpenStream(ctx context.Context, method string) (*Stream, error) {
+	return this.client.openStream(ctx, method, this.window, this.serializer)
+}
+
+// call the method "Service.Method", the reply is decoded into the resp
+// the deadline of the context is sent to the server, the error from the server is an *ErrorFrame
+func (this *ServiceClient) Invoke(ctx context.Context, method string, req interface{}, resp interface{}) error {
+	payload, err := this.serializer.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("%w: encode request of %s, %s", codec.ErrMessageBody, method, err.Error())
+	}
+
+	call := &CallFrame{
+		Method:  method,
+		Payload: payload,
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		call.Timeout = int64(time.Until(deadline))
+	} else {
+		call.Timeout = int64(this.client.defaultTimeout)
+	}
+
+	reply, err := this.client.Call(ctx, call)
+	if err != nil {
+		return err
+	}
+
+	frame, ok := reply.(*ReplyFrame)
+	if !ok {
+		return fmt.Errorf("%w: unexpected reply %T of %s", ErrUnexpectedReply, reply, method)
+	}
+
+	if err := this.serializer.Unmarshal(frame.Payload, resp); err != nil {
+		return fmt.Errorf("%w: decode reply of %s, %s", codec.ErrMessageBody, method, err.Error())
+	}
+	return nil
+}
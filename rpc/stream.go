@@ -0,0 +1,398 @@
+// File Stream
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gonetio"
+	"gonetio/codec"
+	"io"
+	"sync"
+)
+
+// the default credits of each direction of the stream
+const DefaultStreamWindow = 64
+
+// error type
+var (
+	ErrStreamClosed = errors.New("RPC stream send closed")
+)
+
+// the stream of messages in both directions, multiplexed over the connection with the other calls and streams
+// each direction is flow controlled by credits, Send blocks when the peer has not granted more,
+// the credits are granted back as Recv consumes the messages
+// Send and Recv can be called from different goroutines, but not Send or Recv concurrently
+type Stream struct {
+	id         uint32             // the id of the frames sent
+	method     string             // the method name
+	ctx        context.Context    // canceled when the stream finished
+	cancel     context.CancelFunc // cancel the context
+	serializer codec.Serializer   // the serializer of the messages
+	con        *gonetio.Tcpcon    // the connection
+	window     uint32             // the credits of each direction
+	recvQueue  chan []byte        // the payloads received, the capacity is the window
+	creditChan chan struct{}      // signal the credits granted
+	eofChan    chan struct{}      // closed when the peer closed send or the stream reset
+	doneChan   chan struct{}      // closed when the stream finished
+	eofOnce    sync.Once          // make sure the eof chan closed just once
+	doneOnce   sync.Once          // make sure the stream finished just once
+	onDone     func(*Stream)      // called when the stream finished
+	mtx        *sync.Mutex        // guard the fields below
+	credits    uint32             // the count of the messages can send
+	consumed   uint32             // the count of the messages received since the last grant
+	sendClosed bool               // is the send direction closed
+	recvClosed bool               // is the peer send direction closed
+	err        error              // the reset error
+}
+
+// new stream
+func newStream(ctx context.Context, id uint32, method string, window uint32, con *gonetio.Tcpcon,
+	serializer codec.Serializer, onDone func(*Stream)) *Stream {
+
+	if window == 0 {
+		window = DefaultStreamWindow
+	}
+
+	stream := &Stream{
+		id:         id,
+		method:     method,
+		serializer: serializer,
+		con:        con,
+		window:     window,
+		recvQueue:  make(chan []byte, window),
+		creditChan: make(chan struct{}, 1),
+		eofChan:    make(chan struct{}),
+		doneChan:   make(chan struct{}),
+		onDone:     onDone,
+		mtx:        &sync.Mutex{},
+		credits:    window,
+	}
+	stream.ctx, stream.cancel = context.WithCancel(ctx)
+	return stream
+}
+
+// start watching the context, call it after the stream added to the table
+func (this *Stream) start() {
+	go this.watch()
+}
+
+// get the context of the stream, canceled when the stream finished
+func (this *Stream) Context() context.Context {
+	return this.ctx
+}
+
+// get the method name
+func (this *Stream) Method() string {
+	return this.method
+}
+
+// get the channel closed when the stream finished
+func (this *Stream) Done() <-chan struct{} {
+	return this.doneChan
+}
+
+// reset the stream when the context canceled
+func (this *Stream) watch() {
+	select {
+	case <-this.ctx.Done():
+		this.reset(toErrorFrame(this.ctx, this.ctx.Err()), true)
+	case <-this.doneChan:
+	}
+}
+
+// write the frame to the peer
+func (this *Stream) writeFrame(frame interface{}) {
+	this.con.Write(&codec.Envelope{Body: frame})
+}
+
+// send the message, block until the peer granted the credits
+func (this *Stream) Send(msg interface{}) error {
+	payload, err := this.serializer.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("%w: encode stream message of %s, %s", codec.ErrMessageBody, this.method, err.Error())
+	}
+
+	for {
+		this.mtx.Lock()
+		if this.err != nil {
+			err = this.err
+			this.mtx.Unlock()
+			return err
+		}
+
+		if this.sendClosed {
+			this.mtx.Unlock()
+			return ErrStreamClosed
+		}
+
+		if this.credits > 0 {
+			this.credits--
+			this.mtx.Unlock()
+			this.writeFrame(&StreamDataFrame{ID: this.id, Payload: payload})
+			return nil
+		}
+		this.mtx.Unlock()
+
+		select {
+		case <-this.creditChan:
+		case <-this.doneChan:
+		case <-this.ctx.Done():
+			return this.ctx.Err()
+		}
+	}
+}
+
+// receive the message into the msg, io.EOF after the peer closed send,
+// the error of the peer if the stream reset
+func (this *Stream) Recv(msg interface{}) error {
+	select {
+	case payload := <-this.recvQueue:
+		return this.consume(payload, msg)
+	case <-this.eofChan:
+	case <-this.ctx.Done():
+		// the context is canceled too when the stream finished normally
+		if !this.isEOF() {
+			return this.ctx.Err()
+		}
+	}
+
+	// the frames before the close are all queued
+	select {
+	case payload := <-this.recvQueue:
+		return this.consume(payload, msg)
+	default:
+	}
+
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.err != nil {
+		return this.err
+	}
+	return io.EOF
+}
+
+// decode the payload, grant the credits back when half of the window consumed
+func (this *Stream) consume(payload []byte, msg interface{}) error {
+	this.mtx.Lock()
+	this.consumed++
+	grant := uint32(0)
+	if this.consumed*2 >= this.window && this.err == nil && !this.recvClosed {
+		grant = this.consumed
+		this.consumed = 0
+	}
+	this.mtx.Unlock()
+
+	if grant > 0 {
+		this.writeFrame(&StreamCreditFrame{ID: this.id, Credits: grant})
+	}
+
+	if err := this.serializer.Unmarshal(payload, msg); err != nil {
+		return fmt.Errorf("%w: decode stream message of %s, %s", codec.ErrMessageBody, this.method, err.Error())
+	}
+	return nil
+}
+
+// close the send direction, the peer receives io.EOF after the messages sent
+func (this *Stream) CloseSend() error {
+	this.mtx.Lock()
+	if this.err != nil {
+		err := this.err
+		this.mtx.Unlock()
+		return err
+	}
+
+	if this.sendClosed {
+		this.mtx.Unlock()
+		return nil
+	}
+
+	this.sendClosed = true
+	finished := this.recvClosed
+	this.mtx.Unlock()
+
+	this.writeFrame(&StreamCloseFrame{ID: this.id})
+	if finished {
+		this.finish()
+	}
+	return nil
+}
+
+// abort the stream, the peer receives the canceled error
+func (this *Stream) Cancel() {
+	this.reset(NewErrorFrame(CodeCanceled, "stream %s canceled", this.method), true)
+}
+
+// abort both directions, notify the peer if send
+func (this *Stream) reset(frame *ErrorFrame, send bool) {
+	this.mtx.Lock()
+	if this.err != nil || this.isDone() {
+		this.mtx.Unlock()
+		return
+	}
+	this.err = frame
+	this.mtx.Unlock()
+
+	if send {
+		this.writeFrame(&StreamResetFrame{ID: this.id, Code: frame.Code, Message: frame.Message})
+	}
+
+	this.closeEOF()
+	this.finish()
+}
+
+// is the stream finished
+func (this *Stream) isDone() bool {
+	select {
+	case <-this.doneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// is the peer send closed or the stream reset
+func (this *Stream) isEOF() bool {
+	select {
+	case <-this.eofChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// close the eof chan
+func (this *Stream) closeEOF() {
+	this.eofOnce.Do(func() {
+		close(this.eofChan)
+	})
+}
+
+// finish the stream
+func (this *Stream) finish() {
+	this.doneOnce.Do(func() {
+		close(this.doneChan)
+		this.cancel()
+		if this.onDone != nil {
+			this.onDone(this)
+		}
+	})
+}
+
+// handle the frame from the peer
+func (this *Stream) handleFrame(frame streamFrame) {
+	switch f := frame.(type) {
+	case *StreamDataFrame:
+		this.mtx.Lock()
+		closed := this.recvClosed || this.err != nil
+		this.mtx.Unlock()
+		if closed {
+			return
+		}
+
+		select {
+		case this.recvQueue <- f.Payload:
+		default:
+			this.reset(NewErrorFrame(CodeFlowControl, "stream %s recv more than %d messages without credits", this.method, this.window), true)
+		}
+
+	case *StreamCreditFrame:
+		this.mtx.Lock()
+		this.credits += f.Credits
+		this.mtx.Unlock()
+
+		select {
+		case this.creditChan <- struct{}{}:
+		default:
+		}
+
+	case *StreamCloseFrame:
+		this.mtx.Lock()
+		this.recvClosed = true
+		finished := this.sendClosed
+		this.mtx.Unlock()
+
+		this.closeEOF()
+		if finished {
+			this.finish()
+		}
+
+	case *StreamResetFrame:
+		this.reset(&ErrorFrame{Code: f.Code, Message: f.Message}, false)
+	}
+}
+
+// the streams of a connection, keyed by the id of the frames received
+type streamTable struct {
+	mtx     *sync.Mutex
+	streams map[uint32]*Stream
+}
+
+// new stream table
+func newStreamTable() *streamTable {
+	return &streamTable{
+		mtx:     &sync.Mutex{},
+		streams: make(map[uint32]*Stream),
+	}
+}
+
+// add the stream, return false if the id is taken
+func (this *streamTable) add(key uint32, stream *Stream) bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if _, ok := this.streams[key]; ok {
+		return false
+	}
+	this.streams[key] = stream
+	return true
+}
+
+// remove the stream
+func (this *streamTable) remove(key uint32, stream *Stream) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	if this.streams[key] == stream {
+		delete(this.streams, key)
+	}
+}
+
+// get the stream
+func (this *streamTable) get(key uint32) *Stream {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return this.streams[key]
+}
+
+// get the count of the streams
+func (this *streamTable) count() int {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return len(this.streams)
+}
+
+// abort all the streams without notifying the peer, the connection is gone
+func (this *streamTable) resetAll(frame *ErrorFrame) {
+	this.mtx.Lock()
+	streams := this.streams
+	this.streams = make(map[uint32]*Stream)
+	this.mtx.Unlock()
+
+	for _, stream := range streams {
+		stream.reset(frame, false)
+	}
+}
+
+// dispatch the frame to the stream, drop it if the stream is gone
+func (this *streamTable) dispatch(con *gonetio.Tcpcon, key uint32, frame streamFrame) {
+	stream := this.get(key)
+	if stream == nil {
+		con.Logger().Log(gonetio.LvlDebug, "rpc stream is gone, drop the frame", "stream", key, "frame", fmt.Sprintf("%T", frame))
+		return
+	}
+	stream.handleFrame(frame)
+}
@@ -0,0 +1,311 @@
+// File Stream test
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"gonetio"
+	"gonetio/codec"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recv the count n, then send 0 to n-1
+func (this *testService) Count(ctx context.Context, stream *Stream) error {
+	n := 0
+	if err := stream.Recv(&n); err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			<-ctx.Done()
+			this.ended <- ctx.Err()
+			return err
+		}
+		atomic.AddInt64(&this.sent, 1)
+	}
+	return nil
+}
+
+// recv the numbers until io.EOF, then send the sum
+func (this *testService) Sum(ctx context.Context, stream *Stream) error {
+	sum := 0
+	for {
+		n := 0
+		err := stream.Recv(&n)
+		if err == io.EOF {
+			return stream.Send(sum)
+		}
+		if err != nil {
+			return err
+		}
+		sum += n
+	}
+}
+
+// send back each message received until io.EOF
+func (this *testService) Chat(ctx context.Context, stream *Stream) error {
+	for {
+		text := ""
+		err := stream.Recv(&text)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(text); err != nil {
+			return err
+		}
+	}
+}
+
+// never recv, hold the stream until it's done
+func (this *testService) Hold(ctx context.Context, stream *Stream) error {
+	<-ctx.Done()
+	this.ended <- ctx.Err()
+	return ctx.Err()
+}
+
+// open the stream to the method of the peer of the con
+func openTestStream(t *testing.T, con *gonetio.Tcpcon, method string, window uint32) *Stream {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	client := NewServiceClient(GetClient(con), codec.NewJsonSerializer())
+	client.SetStreamWindow(window)
+	stream, err := client.OpenStream(ctx, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// wait until the condition is true
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expect the stream reset with the code
+func checkReset(t *testing.T, err error, code uint32) {
+	t.Helper()
+
+	var frame *ErrorFrame
+	if !errors.As(err, &frame) || frame.Code != code {
+		t.Fatalf("err %v, expect the reset of code %d", err, code)
+	}
+}
+
+func TestStreamServerStreaming(t *testing.T) {
+	con, _, _, server := startRPCPair(t, newTestService())
+	stream := openTestStream(t, con, "Test.Count", 4)
+
+	if err := stream.Send(50); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; ; i++ {
+		n := -1
+		err := stream.Recv(&n)
+		if err == io.EOF {
+			if i != 50 {
+				t.Fatalf("recv %d messages, expect 50", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Fatalf("recv %d, expect %d", n, i)
+		}
+	}
+
+	waitUntil(t, "the streams removed", func() bool {
+		return GetClient(con).StreamCount() == 0 && server.StreamCount() == 0
+	})
+}
+
+func TestStreamClientStreaming(t *testing.T) {
+	con, _, _, server := startRPCPair(t, newTestService())
+	stream := openTestStream(t, con, "Test.Sum", 4)
+
+	expect := 0
+	for i := 0; i < 50; i++ {
+		if err := stream.Send(i); err != nil {
+			t.Fatal(err)
+		}
+		expect += i
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := 0
+	if err := stream.Recv(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != expect {
+		t.Fatalf("sum %d, expect %d", sum, expect)
+	}
+	if err := stream.Recv(&sum); err != io.EOF {
+		t.Fatalf("err %v after the sum, expect io.EOF", err)
+	}
+
+	waitUntil(t, "the streams removed", func() bool {
+		return GetClient(con).StreamCount() == 0 && server.StreamCount() == 0
+	})
+}
+
+// the server sends no more than the credits, the credits are granted back as the client recv
+func TestStreamCredits(t *testing.T) {
+	service := newTestService()
+	con, _, _, _ := startRPCPair(t, service)
+	stream := openTestStream(t, con, "Test.Count", 4)
+	defer stream.Cancel()
+
+	if err := stream.Send(50); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSent := func(expect int64) {
+		t.Helper()
+
+		waitUntil(t, "the messages sent", func() bool {
+			return atomic.LoadInt64(&service.sent) >= expect
+		})
+		time.Sleep(50 * time.Millisecond)
+		if sent := atomic.LoadInt64(&service.sent); sent != expect {
+			t.Fatalf("sent %d, expect %d", sent, expect)
+		}
+	}
+
+	// blocked after the window sent
+	checkSent(4)
+
+	// half of the window consumed, they are granted back
+	for i := 0; i < 2; i++ {
+		n := -1
+		if err := stream.Recv(&n); err != nil || n != i {
+			t.Fatalf("recv %d, %v, expect %d", n, err, i)
+		}
+	}
+	checkSent(6)
+}
+
+// the cancel resets both sides, the streams are removed from both
+func TestStreamCancel(t *testing.T) {
+	service := newTestService()
+	con, _, _, server := startRPCPair(t, service)
+	stream := openTestStream(t, con, "Test.Count", 4)
+
+	if err := stream.Send(1000); err != nil {
+		t.Fatal(err)
+	}
+	n := -1
+	if err := stream.Recv(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	stream.Cancel()
+	select {
+	case <-stream.Done():
+	default:
+		t.Fatal("the stream is not done after canceled")
+	}
+
+	// the messages queued before the cancel may still be received
+	for {
+		if err := stream.Recv(&n); err != nil {
+			checkReset(t, err, CodeCanceled)
+			break
+		}
+	}
+
+	select {
+	case err := <-service.ended:
+		if err != context.Canceled {
+			t.Fatalf("the method ended with %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the method runs after the stream canceled")
+	}
+
+	waitUntil(t, "the streams removed", func() bool {
+		return GetClient(con).StreamCount() == 0 && server.StreamCount() == 0
+	})
+}
+
+// the peer sends more than the credits, the stream is reset
+func TestStreamFlowControl(t *testing.T) {
+	service := newTestService()
+	con, _, _, server := startRPCPair(t, service)
+	stream := openTestStream(t, con, "Test.Hold", 2)
+
+	// bypass the credits of Send
+	for i := 0; i < 3; i++ {
+		stream.writeFrame(&StreamDataFrame{ID: stream.id, Payload: []byte("1")})
+	}
+
+	n := 0
+	checkReset(t, stream.Recv(&n), CodeFlowControl)
+
+	select {
+	case err := <-service.ended:
+		if err != context.Canceled {
+			t.Fatalf("the method ended with %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the method runs after the stream reset")
+	}
+
+	waitUntil(t, "the streams removed", func() bool {
+		return GetClient(con).StreamCount() == 0 && server.StreamCount() == 0
+	})
+}
+
+// the server side opens the stream to the client side over the same connection
+func TestStreamFromServerSide(t *testing.T) {
+	con, localServer, peer, _ := startRPCPair(t, newTestService())
+	stream := openTestStream(t, peer, "Test.Chat", 2)
+
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		if err := stream.Send(text); err != nil {
+			t.Fatal(err)
+		}
+		reply := ""
+		if err := stream.Recv(&reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != text {
+			t.Fatalf("reply %q, expect %q", reply, text)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	reply := ""
+	if err := stream.Recv(&reply); err != io.EOF {
+		t.Fatalf("err %v after close send, expect io.EOF", err)
+	}
+
+	waitUntil(t, "the streams removed", func() bool {
+		return GetClient(peer).StreamCount() == 0 && localServer.StreamCount() == 0 && GetClient(con).StreamCount() == 0
+	})
+}
@@ -0,0 +1,345 @@
+// File SendQueue
+
+package gonetio
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// the policy when the send queue is full
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota // drop the packet being written, the default
+	OverflowDropOldest                       // drop the oldest packets queued to make room for the new one
+	OverflowBlock                            // block the writer until the queue has room or the timeout
+	OverflowClose                            // drop the packet and close the connection
+)
+
+func (policy OverflowPolicy) String() string {
+	switch policy {
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowDropOldest:
+		return "drop oldest"
+	case OverflowBlock:
+		return "block"
+	case OverflowClose:
+		return "close"
+	}
+
+	return "unknown"
+}
+
+const (
+	DefaultWriteHighWatermark = 64 * 1024 // default queued bytes the connection turns unwritable
+	DefaultWriteLowWatermark  = 32 * 1024 // default queued bytes the connection turns writable again
+)
+
+// the send queue config
+// the connection turns unwritable when the queued bytes reach the high watermark,
+// and writable again when they fall to the low watermark, no watermark when high is not positive
+type sendQueueConfig struct {
+	overflow      OverflowPolicy // the policy when the send queue is full
+	blockTimeout  time.Duration  // the max time blocking for OverflowBlock, wait until closed when not positive
+	lowWatermark  int            // the low watermark of the queued bytes
+	highWatermark int            // the high watermark of the queued bytes
+}
+
+// the default send queue config
+func defaultSendQueueConfig() sendQueueConfig {
+	return sendQueueConfig{
+		overflow:      OverflowDropNewest,
+		blockTimeout:  0,
+		lowWatermark:  DefaultWriteLowWatermark,
+		highWatermark: DefaultWriteHighWatermark,
+	}
+}
+
+// set the policy when the send queue is full
+// the blockTimeout is for OverflowBlock only, wait until the connection closed when not positive
+func (this *AcceptorConf) SetOverflowPolicy(policy OverflowPolicy, blockTimeout time.Duration) {
+	this.sendQueue.overflow = policy
+	this.sendQueue.blockTimeout = blockTimeout
+}
+
+// set the watermarks of the queued bytes firing the WritabilityChanged events
+// no watermark when high is not positive
+func (this *AcceptorConf) SetWriteWatermarks(low int, high int) {
+	this.sendQueue.lowWatermark = low
+	this.sendQueue.highWatermark = high
+}
+
+// set the policy when the send queue is full of the connections connected after
+// the blockTimeout is for OverflowBlock only, wait until the connection closed when not positive
+func (this *TcpConnector) SetOverflowPolicy(policy OverflowPolicy, blockTimeout time.Duration) {
+	this.config.sendQueue.overflow = policy
+	this.config.sendQueue.blockTimeout = blockTimeout
+}
+
+// set the watermarks of the queued bytes of the connections connected after
+// no watermark when high is not positive
+func (this *TcpConnector) SetWriteWatermarks(low int, high int) {
+	this.config.sendQueue.lowWatermark = low
+	this.config.sendQueue.highWatermark = high
+}
+
+// set the policy when the send queue is full, it must be called before Start
+// the blockTimeout is for OverflowBlock only, wait until the connection closed when not positive
+func (this *Tcpcon) SetOverflowPolicy(policy OverflowPolicy, blockTimeout time.Duration) {
+	this.sendQueue.overflow = policy
+	this.sendQueue.blockTimeout = blockTimeout
+}
+
+// set the watermarks of the queued bytes firing the WritabilityChanged events, it must be called before Start
+// no watermark when high is not positive
+func (this *Tcpcon) SetWriteWatermarks(low int, high int) {
+	this.sendQueue.lowWatermark = low
+	this.sendQueue.highWatermark = high
+}
+
+// get the bytes waiting in the send queue
+func (this *Tcpcon) SendQueueBytes() int64 {
+	return atomic.LoadInt64(&this.queuedBytes)
+}
+
+// is the queued bytes below the high watermark
+// the producers should pause when it's false, and resume at the WritabilityChanged event
+func (this *Tcpcon) IsWritable() bool {
+	return atomic.LoadInt32(&this.unwritable) == 0
+}
+
+// add the packet to the send queue by the policy
+// the future of the packet fails with the error if it's refused
+func (this *Tcpcon) enqueue(packet sendPacket, policy OverflowPolicy, timeout time.Duration) (err error) {
+	counted := false
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrConnException
+		}
+		if err == nil {
+			return
+		}
+
+		if counted {
+			this.addQueuedBytes(-packet.size)
+		}
+		if packet.future != nil {
+			packet.future.fail(err)
+		}
+	}()
+
+	if this.IsShutdown() {
+		return ErrConnShutdown
+	}
+
+	select {
+	case <-this.closeChan:
+		return ErrConnClosed
+	default:
+	}
+
+	packet.size = packet.buffer.Len()
+	// the write loop may finish the packet at once, so add it to the future
+	// and count the bytes first, the writability is checked after it's queued
+	if packet.future != nil {
+		packet.future.addPacket()
+	}
+	atomic.AddInt64(&this.queuedBytes, int64(packet.size))
+	counted = true
+
+	dropped, err := this.pushPacket(packet, policy, timeout)
+	for _, p := range dropped {
+		this.dropPacket(p)
+	}
+
+	if err == ErrWriteBlocking && policy == OverflowClose {
+		this.Logger().Log(LvlWarn, "send queue overflow, close the connection", "queueSize", cap(this.packetSendChan))
+		this.closeWithReason(CloseReasonOverflow)
+	}
+
+	if err == nil {
+		this.metrics.addMessageOut()
+		this.updateWritability(this.SendQueueBytes())
+	}
+	return err
+}
+
+// push the packet to the send queue by the policy, return the oldest packets dropped for it
+// it holds the read lock, so the send queue is never closed while pushing,
+// the dropped packets are discarded by the caller out of the lock, their futures may write again
+func (this *Tcpcon) pushPacket(packet sendPacket, policy OverflowPolicy, timeout time.Duration) ([]sendPacket, error) {
+	this.sendMtx.RLock()
+	defer this.sendMtx.RUnlock()
+
+	select {
+	case <-this.closeChan:
+		return nil, ErrConnClosed
+	default:
+	}
+
+	switch policy {
+	case OverflowBlock:
+		return nil, this.enqueueBlocking(packet, timeout)
+	case OverflowDropOldest:
+		return this.enqueueDropOldest(packet)
+	}
+
+	select {
+	case this.packetSendChan <- packet:
+		return nil, nil
+	default:
+		this.metrics.addWriteBlockingDrop()
+		return nil, ErrWriteBlocking
+	}
+}
+
+// wait for the room of the send queue
+func (this *Tcpcon) enqueueBlocking(packet sendPacket, timeout time.Duration) error {
+	select {
+	case this.packetSendChan <- packet:
+		return nil
+	default:
+	}
+
+	var timeoutChan <-chan time.Time = nil
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	select {
+	case this.packetSendChan <- packet:
+		return nil
+	case <-this.closeChan:
+		return ErrConnClosed
+	case <-timeoutChan:
+		this.metrics.addWriteBlockingDrop()
+		return ErrWriteBlocking
+	}
+}
+
+// take the oldest packets out until the packet queued, return the packets taken out
+func (this *Tcpcon) enqueueDropOldest(packet sendPacket) ([]sendPacket, error) {
+	// nothing to drop in the unbuffered queue
+	if cap(this.packetSendChan) == 0 {
+		select {
+		case this.packetSendChan <- packet:
+			return nil, nil
+		default:
+			this.metrics.addWriteBlockingDrop()
+			return nil, ErrWriteBlocking
+		}
+	}
+
+	var dropped []sendPacket = nil
+	for {
+		select {
+		case this.packetSendChan <- packet:
+			return dropped, nil
+		default:
+		}
+
+		select {
+		case old := <-this.packetSendChan:
+			dropped = append(dropped, old)
+		default:
+		}
+	}
+}
+
+// drop the packet taken from the send queue
+func (this *Tcpcon) dropPacket(p sendPacket) {
+	if p.buffer == nil {
+		return
+	}
+
+	this.metrics.addWriteBlockingDrop()
+	this.discardPacket(p, ErrWriteBlocking)
+}
+
+// discard the packet not written, fail its future with the error
+func (this *Tcpcon) discardPacket(p sendPacket, err error) {
+	this.addQueuedBytes(-p.size)
+	if p.pooled {
+		PutBuffer(p.buffer)
+	}
+	if p.future != nil {
+		p.future.packetDone(err)
+	}
+}
+
+// discard the packets left in the send queue after the connection closed
+func (this *Tcpcon) discardSendQueue() {
+	for p := range this.packetSendChan {
+		if p.buffer != nil {
+			this.discardPacket(p, ErrConnClosed)
+		}
+	}
+}
+
+// add the queued bytes, check the writability if it may cross the watermarks
+func (this *Tcpcon) addQueuedBytes(n int) {
+	this.updateWritability(atomic.AddInt64(&this.queuedBytes, int64(n)))
+}
+
+// check the writability if the queued bytes may cross the watermarks
+// the bytes fall mostly in the write loop, so the check turning writable runs on a new goroutine,
+// the handler resuming writing in the event never blocks the write loop, even with OverflowBlock
+func (this *Tcpcon) updateWritability(queued int64) {
+	if this.sendQueue.highWatermark <= 0 {
+		return
+	}
+
+	writable := this.IsWritable()
+	if writable && queued >= int64(this.sendQueue.highWatermark) {
+		this.checkWritability()
+	} else if !writable && queued <= int64(this.sendQueue.lowWatermark) {
+		go this.checkWritability()
+	}
+}
+
+// update the writability and fire the event
+// one goroutine fires at a time so the events are in order, the others just ask it to check again,
+// so the handler may write in the event without dead lock of the checks
+func (this *Tcpcon) checkWritability() {
+	if atomic.AddInt32(&this.writabilityChecks, 1) != 1 {
+		return
+	}
+
+	for {
+		checks := atomic.LoadInt32(&this.writabilityChecks)
+		queued := atomic.LoadInt64(&this.queuedBytes)
+
+		changed := false
+		if this.IsWritable() && queued >= int64(this.sendQueue.highWatermark) {
+			atomic.StoreInt32(&this.unwritable, 1)
+			this.fireWritabilityChanged(false)
+			changed = true
+		} else if !this.IsWritable() && queued <= int64(this.sendQueue.lowWatermark) {
+			atomic.StoreInt32(&this.unwritable, 0)
+			this.fireWritabilityChanged(true)
+			changed = true
+		}
+
+		// the bytes may change before the writability stored, check again
+		if changed {
+			continue
+		}
+
+		if atomic.AddInt32(&this.writabilityChecks, -checks) == 0 {
+			return
+		}
+	}
+}
+
+// fire the writability changed event at the chain
+func (this *Tcpcon) fireWritabilityChanged(writable bool) {
+	this.Logger().Log(LvlDebug, "writability changed", "writable", writable, "queuedBytes", this.SendQueueBytes())
+
+	if this.ioFilterChain != nil {
+		this.ioFilterChain.FireWritabilityChanged(writable)
+	}
+}
@@ -0,0 +1,210 @@
+// File SendQueue test
+
+package gonetio
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// record the writability events, resume writing in the first writable one
+type writabilityRecorder struct {
+	IoHandlerImp
+	mtx     sync.Mutex
+	events  []bool
+	resume  int
+	resumed sync.Once
+}
+
+func (this *writabilityRecorder) WritabilityChanged(filter *IoFilter, writable bool) {
+	this.mtx.Lock()
+	this.events = append(this.events, writable)
+	this.mtx.Unlock()
+
+	if writable {
+		this.resumed.Do(func() {
+			for i := 0; i < this.resume; i++ {
+				filter.GetCon().Write(bytes.NewBufferString("r"))
+			}
+		})
+	}
+}
+
+func (this *writabilityRecorder) getEvents() []bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return append([]bool{}, this.events...)
+}
+
+// start a connection over the pipe with the handler
+func startSendQueueCon(t *testing.T, queueSize int, handler IoHandler, setup func(*Tcpcon)) (*Tcpcon, net.Conn) {
+	local, remote := net.Pipe()
+	con := NewConnFull(local, queueSize, &sync.WaitGroup{}, 0)
+	chain := NewIoFilterChain(con)
+	chain.AddLast("handler", handler)
+	con.SetIoFilterChain(chain)
+	con.SetWriteBatch(0, 1, 0)
+	setup(con)
+	con.Start()
+
+	t.Cleanup(func() {
+		con.Close()
+		remote.Close()
+	})
+	return con, remote
+}
+
+// read the bytes from the peer, fail on timeout
+func readPeer(t *testing.T, peer net.Conn, size int) []byte {
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data := make([]byte, size)
+	if _, err := io.ReadFull(peer, data); err != nil {
+		t.Fatalf("read %d bytes from the peer: %v", size, err)
+	}
+	return data
+}
+
+func TestWritabilityResumeWithOverflowBlock(t *testing.T) {
+	handler := &writabilityRecorder{resume: 5}
+	handler.SetBoundType(InBound)
+	con, peer := startSendQueueCon(t, 2, handler, func(con *Tcpcon) {
+		con.SetOverflowPolicy(OverflowBlock, 0)
+		con.SetWriteWatermarks(1, 3)
+	})
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			con.Write(bytes.NewBufferString("w"))
+		}
+	}()
+
+	// read after the queue reached the high watermark
+	deadline := time.Now().Add(2 * time.Second)
+	for con.IsWritable() {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection never turned unwritable")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the handler resumes in the writable event with more packets than the queue holds,
+	// it must not block the write loop
+	data := readPeer(t, peer, 9)
+	if bytes.Count(data, []byte("w")) != 4 || bytes.Count(data, []byte("r")) != 5 {
+		t.Fatalf("peer read %q", data)
+	}
+
+	events := handler.getEvents()
+	if len(events) < 2 || events[0] || !events[1] {
+		t.Fatalf("events %v, expect unwritable then writable", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i] == events[i-1] {
+			t.Fatalf("events %v, expect alternated", events)
+		}
+	}
+}
+
+// the raw connection checks the packet being written is still counted in the queued bytes
+type countedConn struct {
+	net.Conn
+	con       *Tcpcon
+	uncounted int32
+}
+
+func (this *countedConn) Write(b []byte) (int, error) {
+	if this.con.SendQueueBytes() < int64(len(b)) {
+		atomic.StoreInt32(&this.uncounted, 1)
+	}
+	return len(b), nil
+}
+
+func TestSendQueueBytesCountedBeforeQueued(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	raw := &countedConn{Conn: local}
+	con := NewConnFull(raw, 64, &sync.WaitGroup{}, 0)
+	raw.con = con
+	chain := NewIoFilterChain(con)
+	con.SetIoFilterChain(chain)
+	con.SetWriteBatch(0, 1, 0)
+	con.Start()
+	defer con.Close()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5000; j++ {
+				con.Write(bytes.NewBufferString("0123456789"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&raw.uncounted) != 0 {
+		t.Fatal("the packet was written before its bytes counted")
+	}
+}
+
+func TestWritabilityHysteresis(t *testing.T) {
+	handler := &writabilityRecorder{}
+	handler.SetBoundType(InBound)
+	con, raw := startRecordingCon(t, 64, handler, func(con *Tcpcon) {
+		con.SetWriteBatch(0, 1, 0)
+		con.SetWriteWatermarks(2, 4)
+	})
+
+	checkEvents := func(step string, writable bool, events ...bool) {
+		t.Helper()
+		if con.IsWritable() != writable {
+			t.Fatalf("%s: writable %v, %d bytes queued", step, con.IsWritable(), con.SendQueueBytes())
+		}
+		if got := handler.getEvents(); !reflect.DeepEqual(got, append([]bool{}, events...)) {
+			t.Fatalf("%s: events %v, expect %v", step, got, events)
+		}
+	}
+
+	// the write loop holds the first packet, the bytes are counted until written
+	con.Write(bytes.NewBufferString("a"))
+	<-raw.entered
+	con.Write(bytes.NewBufferString("b"))
+	con.Write(bytes.NewBufferString("c"))
+	checkEvents("below the high watermark", true)
+
+	con.Write(bytes.NewBufferString("d"))
+	checkEvents("reach the high watermark", false, false)
+
+	// the next write entered after the bytes of the last one uncounted
+	// the writable event fires on its own goroutine, give it the time to show if wrongly fired
+	raw.release <- struct{}{}
+	<-raw.entered
+	time.Sleep(50 * time.Millisecond)
+	checkEvents("above the low watermark", false, false)
+
+	raw.release <- struct{}{}
+	<-raw.entered
+	deadline := time.Now().Add(2 * time.Second)
+	for !con.IsWritable() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	checkEvents("reach the low watermark", true, false, true)
+
+	// the bytes rise again but below the high watermark
+	con.Write(bytes.NewBufferString("e"))
+	close(raw.release)
+	deadline = time.Now().Add(2 * time.Second)
+	for con.SendQueueBytes() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	checkEvents("all written", true, false, true)
+}
@@ -0,0 +1,212 @@
+// File TLS test
+
+package gonetio
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+const testALPN = "gonetio/test"
+
+// generate the self signed certificate of localhost, it's the ca of itself
+func newSelfSignedCert(t *testing.T, name string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+// the tls state seen by a side in ConnOpened
+type tlsState struct {
+	protocol string
+	peerName string
+}
+
+// record the tls state when opened, echo the server side messages, collect the client side ones
+type tlsHandler struct {
+	IoHandlerImp
+	server   bool
+	opened   chan tlsState
+	received chan string
+}
+
+func newTLSHandler(server bool) *tlsHandler {
+	handler := &tlsHandler{
+		server:   server,
+		opened:   make(chan tlsState, 1),
+		received: make(chan string, 16),
+	}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *tlsHandler) ConnOpened(filter *IoFilter) {
+	con := filter.GetCon()
+	state := tlsState{protocol: con.NegotiatedProtocol()}
+	if certs := con.PeerCertificates(); len(certs) > 0 {
+		state.peerName = certs[0].Subject.CommonName
+	}
+	this.opened <- state
+
+	if !this.server {
+		con.Write(bytes.NewBufferString("hello"))
+	}
+}
+
+func (this *tlsHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	input := obj.(*bytes.Buffer)
+	if this.server {
+		filter.GetCon().Write(bytes.NewBuffer(append([]byte{}, input.Bytes()...)))
+	} else {
+		this.received <- input.String()
+	}
+	input.Reset()
+}
+
+// the handlers are shared by all the connections of the test
+func (this *tlsHandler) Clone() IoHandler {
+	return this
+}
+
+// start the tls acceptor at a random loopback port
+func startTLSAcceptor(t *testing.T, config *tls.Config, handler IoHandler) *TcpAcceptor {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig(0, 16, 0)
+	conf.SetTLSConfig(config)
+	acceptor := NewAcceptor(conf)
+	acceptor.SetListener(listener)
+	acceptor.GetFilterChain().AddLast("handler", handler)
+	if !acceptor.Start() {
+		t.Fatal("acceptor start failed")
+	}
+
+	t.Cleanup(acceptor.Stop)
+	return acceptor
+}
+
+// wait for the value from the channel
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+
+	var zero T
+	return zero
+}
+
+func TestTLSLoopback(t *testing.T) {
+	serverCert, serverPool := newSelfSignedCert(t, "server")
+	clientCert, clientPool := newSelfSignedCert(t, "client")
+
+	server := newTLSHandler(true)
+	acceptor := startTLSAcceptor(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		NextProtos:   []string{testALPN},
+	}, server)
+
+	client := newTLSHandler(false)
+	connector := NewConnector("tls", 16, 0)
+	connector.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      serverPool,
+		NextProtos:   []string{testALPN},
+	})
+	connector.GetIoFilterChain().AddLast("handler", client)
+	connector.AsyncConnect(acceptor.Addr().String())
+	defer connector.Stop()
+
+	serverState := waitFor(t, server.opened, "the server opened")
+	if serverState.protocol != testALPN || serverState.peerName != "client" {
+		t.Fatalf("server side tls state %+v", serverState)
+	}
+
+	clientState := waitFor(t, client.opened, "the client opened")
+	if clientState.protocol != testALPN || clientState.peerName != "server" {
+		t.Fatalf("client side tls state %+v", clientState)
+	}
+
+	got := ""
+	for got != "hello" {
+		got += waitFor(t, client.received, "the echo")
+		if len(got) > len("hello") {
+			t.Fatalf("client received %q", got)
+		}
+	}
+}
+
+func TestTLSUntrustedServer(t *testing.T) {
+	serverCert, _ := newSelfSignedCert(t, "server")
+	_, otherPool := newSelfSignedCert(t, "other")
+
+	server := newTLSHandler(true)
+	acceptor := startTLSAcceptor(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, server)
+
+	client := newTLSHandler(false)
+	connector := NewConnector("tls", 16, 0)
+	connector.SetTLSConfig(&tls.Config{RootCAs: otherPool})
+	connector.SetTLSHandshakeTimeout(time.Second)
+	connector.GetIoFilterChain().AddLast("handler", client)
+	connector.AsyncConnect(acceptor.Addr().String())
+	defer connector.Stop()
+
+	// the client aborts the handshake, the server counts it failed too
+	deadline := time.Now().Add(3 * time.Second)
+	for acceptor.Stats().AcceptErrors == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed handshake is not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case state := <-client.opened:
+		t.Fatalf("client opened with the untrusted server, %+v", state)
+	default:
+	}
+}
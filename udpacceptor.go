@@ -0,0 +1,349 @@
+// File UdpAcceptor
+
+package gonetio
+
+import (
+	"io"
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	udpSessionRecvQueueSize = 1024  // each session datagram recv queue size
+	udpMaxDatagramSize      = 65535 // max datagram size
+)
+
+type UdpAcceptorConf struct {
+	listenPort               int // listen port
+	sessionSendChanSizeLimit int // each session packet send queue size
+	idleTimeout              int // in seconds, close the session when nothing received for the time, valid only when the value is positive
+}
+
+// new udp config
+func NewUdpConfig(port int, sendQueueSize int, idleTimeoutDuration int) *UdpAcceptorConf {
+	return &UdpAcceptorConf{
+		listenPort:               port,
+		sessionSendChanSizeLimit: sendQueueSize,
+		idleTimeout:              idleTimeoutDuration,
+	}
+}
+
+// the udp acceptor
+// each remote address gets a virtual session with its own filter chain,
+// each datagram received is fired as one message
+type UdpAcceptor struct {
+	nextConID   uint32
+	config      *UdpAcceptorConf          // the acceptor config
+	filterChain *IoFilterChain            // filter chain
+	conn        *net.UDPConn              // the packet connection
+	sessions    map[string]*udpSessionCon // <remote addr, session>
+	sessionMtx  *sync.Mutex               // guard the sessions
+	exitChan    chan struct{}             // notify all goroutines to shutdown
+	waitGroup   *sync.WaitGroup           // wait for all goroutines to stop
+	stopFlag    int32                     // stop flag
+	stopOnce    sync.Once                 // make sure the acceptor stop just once
+	metrics     *metrics                  // the counters of all the sessions
+	logger      FieldLogger               // the logger
+}
+
+// create new udp acceptor instance
+func NewUdpAcceptor(conf *UdpAcceptorConf) *UdpAcceptor {
+	return &UdpAcceptor{
+		nextConID:   0,
+		config:      conf,
+		filterChain: NewIoFilterChain(nil),
+		conn:        nil,
+		sessions:    make(map[string]*udpSessionCon),
+		sessionMtx:  &sync.Mutex{},
+		exitChan:    make(chan struct{}),
+		waitGroup:   &sync.WaitGroup{},
+		stopFlag:    0,
+		metrics:     newMetrics(),
+		logger:      DefaultLogger(),
+	}
+}
+
+// set the logger, it must be called before Start
+// the sessions log to its child with the conID and the remote addr attached
+func (this *UdpAcceptor) SetLogger(logger FieldLogger) {
+	this.logger = logger
+}
+
+// get the logger
+func (this *UdpAcceptor) GetLogger() FieldLogger {
+	return this.logger
+}
+
+// get the stats snapshot of the acceptor, the accepts are the sessions created
+func (this *UdpAcceptor) Stats() Stats {
+	this.sessionMtx.Lock()
+	conns := make([]*Tcpcon, 0, len(this.sessions))
+	for _, session := range this.sessions {
+		conns = append(conns, session.con)
+	}
+	this.sessionMtx.Unlock()
+
+	return this.metrics.stats(conns)
+}
+
+// get io filter chain
+func (this *UdpAcceptor) GetFilterChain() *IoFilterChain {
+	return this.filterChain
+}
+
+// get the address the acceptor listen to, nil before started
+func (this *UdpAcceptor) Addr() net.Addr {
+	if this.conn == nil {
+		return nil
+	}
+	return this.conn.LocalAddr()
+}
+
+// get the session count
+func (this *UdpAcceptor) SessionCount() int {
+	this.sessionMtx.Lock()
+	defer this.sessionMtx.Unlock()
+
+	return len(this.sessions)
+}
+
+func (this *UdpAcceptor) generateNextConID() uint32 {
+	return atomic.AddUint32(&this.nextConID, 1)
+}
+
+// the acceptor start
+func (this *UdpAcceptor) Start() bool {
+	addr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(this.config.listenPort))
+	if err != nil {
+		this.logger.Log(LvlError, "resolve udp addr failed", "port", this.config.listenPort, "err", err)
+		return false
+	}
+
+	this.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		this.logger.Log(LvlError, "bind to udp port failed", "port", this.config.listenPort, "err", err)
+		return false
+	}
+
+	this.logger.Log(LvlInfo, "udp acceptor listen", "port", this.config.listenPort)
+
+	this.waitGroup.Add(1)
+	go this.recvLoop()
+
+	return true
+}
+
+// the acceptor main loop, dispatch the datagrams to the sessions
+func (this *UdpAcceptor) recvLoop() {
+
+	defer func() {
+		this.waitGroup.Done()
+
+		this.logger.Log(LvlInfo, "udp acceptor loop exit")
+
+		if p := recover(); p != nil {
+			this.logger.Log(LvlError, "panic recover", "panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+
+	this.logger.Log(LvlInfo, "udp acceptor loop start")
+
+	buffer := make([]byte, udpMaxDatagramSize)
+	for {
+		readLen, addr, err := this.conn.ReadFromUDP(buffer)
+		if err != nil {
+			if atomic.LoadInt32(&this.stopFlag) == 1 {
+				return
+			}
+			this.logger.Log(LvlError, "udp acceptor read failed", "err", err)
+			continue
+		}
+
+		if readLen == 0 {
+			continue
+		}
+
+		datagram := make([]byte, readLen)
+		copy(datagram, buffer[:readLen])
+
+		this.getOrNewSession(addr).push(datagram)
+	}
+}
+
+// get the session of the remote addr, new one if not exists
+func (this *UdpAcceptor) getOrNewSession(addr *net.UDPAddr) *udpSessionCon {
+	key := addr.String()
+
+	this.sessionMtx.Lock()
+	session := this.sessions[key]
+	if session != nil {
+		this.sessionMtx.Unlock()
+		return session
+	}
+
+	session = newUdpSessionCon(this, addr)
+	con := NewConnFull(session, this.config.sessionSendChanSizeLimit, this.waitGroup, this.config.idleTimeout)
+	session.con = con
+	this.sessions[key] = session
+	this.sessionMtx.Unlock()
+
+	this.logger.Log(LvlInfo, "udp acceptor new session", "remote", key)
+	this.metrics.addAccept()
+
+	con.setGlobalExitChan(this.exitChan)
+	con.setParentMetrics(this.metrics)
+	con.SetLogger(this.logger)
+	con.setDatagramMode(true)
+	con.SetConID(this.generateNextConID())
+	con.SetIoFilterChain(this.filterChain.NewInstanceAndClone(con))
+	con.setCloseCallback(func(*Tcpcon) {
+		this.removeSession(session)
+	})
+	con.Start()
+
+	return session
+}
+
+// remove the session
+func (this *UdpAcceptor) removeSession(session *udpSessionCon) {
+	this.sessionMtx.Lock()
+	defer this.sessionMtx.Unlock()
+
+	key := session.remoteAddr.String()
+	if this.sessions[key] == session {
+		delete(this.sessions, key)
+	}
+}
+
+// stop
+func (this *UdpAcceptor) Stop() {
+	this.stopOnce.Do(func() {
+		atomic.StoreInt32(&this.stopFlag, 1)
+		close(this.exitChan)
+
+		if this.conn != nil {
+			this.conn.Close()
+		}
+
+		this.sessionMtx.Lock()
+		sessions := make([]*udpSessionCon, 0, len(this.sessions))
+		for _, session := range this.sessions {
+			sessions = append(sessions, session)
+		}
+		this.sessionMtx.Unlock()
+
+		for _, session := range sessions {
+			session.Close()
+		}
+	})
+}
+
+// wait for stop
+func (this *UdpAcceptor) WaitForStop() {
+	this.waitGroup.Wait()
+}
+
+// the virtual connection of a remote address
+// reads the datagrams dispatched by the acceptor, writes to the acceptor packet connection
+type udpSessionCon struct {
+	aptor        *UdpAcceptor  // the acceptor
+	remoteAddr   *net.UDPAddr  // the remote addr
+	con          *Tcpcon       // the connection of the session
+	recvChan     chan []byte   // the datagrams recv queue
+	closeChan    chan struct{} // close signal
+	closeOnce    sync.Once     // make sure close just once
+	deadlineMtx  *sync.Mutex   // guard the read deadline
+	readDeadline time.Time     // the read deadline
+}
+
+// new udp session
+func newUdpSessionCon(aptor *UdpAcceptor, addr *net.UDPAddr) *udpSessionCon {
+	return &udpSessionCon{
+		aptor:       aptor,
+		remoteAddr:  addr,
+		recvChan:    make(chan []byte, udpSessionRecvQueueSize),
+		closeChan:   make(chan struct{}),
+		deadlineMtx: &sync.Mutex{},
+	}
+}
+
+// push the datagram to the recv queue, drop it if the queue is full, the drop is counted to RecvQueueDrops
+func (this *udpSessionCon) push(datagram []byte) {
+	select {
+	case this.recvChan <- datagram:
+	case <-this.closeChan:
+	default:
+		this.con.metrics.addRecvQueueDrop()
+		this.con.Logger().Log(LvlWarn, "udp session recv queue is full, drop the datagram")
+	}
+}
+
+// read one datagram, the bytes beyond len(b) are discarded
+func (this *udpSessionCon) Read(b []byte) (int, error) {
+	this.deadlineMtx.Lock()
+	deadline := this.readDeadline
+	this.deadlineMtx.Unlock()
+
+	var timeout <-chan time.Time = nil
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case datagram := <-this.recvChan:
+		return copy(b, datagram), nil
+	case <-this.closeChan:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// write one datagram to the remote addr
+func (this *udpSessionCon) Write(b []byte) (int, error) {
+	return this.aptor.conn.WriteToUDP(b, this.remoteAddr)
+}
+
+// close the session
+func (this *udpSessionCon) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closeChan)
+	})
+	return nil
+}
+
+// local addr
+func (this *udpSessionCon) LocalAddr() net.Addr {
+	return this.aptor.conn.LocalAddr()
+}
+
+// remote addr
+func (this *udpSessionCon) RemoteAddr() net.Addr {
+	return this.remoteAddr
+}
+
+// set deadline
+func (this *udpSessionCon) SetDeadline(t time.Time) error {
+	return this.SetReadDeadline(t)
+}
+
+// set read deadline
+func (this *udpSessionCon) SetReadDeadline(t time.Time) error {
+	this.deadlineMtx.Lock()
+	defer this.deadlineMtx.Unlock()
+
+	this.readDeadline = t
+	return nil
+}
+
+// set write deadline, writes never block
+func (this *udpSessionCon) SetWriteDeadline(t time.Time) error {
+	return nil
+}
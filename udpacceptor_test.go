@@ -0,0 +1,211 @@
+// File UdpAcceptor test
+
+package gonetio
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echo the datagrams, count the sessions opened and closed
+// the first message is held until released if hold
+type udpEchoHandler struct {
+	IoHandlerImp
+	opened int32
+	closed int32
+	held   chan struct{}
+	hold   chan struct{}
+}
+
+func newUdpEchoHandler(hold bool) *udpEchoHandler {
+	handler := &udpEchoHandler{}
+	if hold {
+		handler.held = make(chan struct{}, 1)
+		handler.hold = make(chan struct{})
+	}
+	handler.SetBoundType(InBound)
+	return handler
+}
+
+func (this *udpEchoHandler) ConnOpened(filter *IoFilter) {
+	atomic.AddInt32(&this.opened, 1)
+}
+
+func (this *udpEchoHandler) ConnClosed(filter *IoFilter) {
+	atomic.AddInt32(&this.closed, 1)
+}
+
+func (this *udpEchoHandler) MessageReceived(filter *IoFilter, obj BaseObject) {
+	if this.hold != nil {
+		select {
+		case this.held <- struct{}{}:
+		default:
+		}
+		<-this.hold
+	}
+
+	input := obj.(*bytes.Buffer)
+	filter.GetCon().Write(bytes.NewBuffer(append([]byte{}, input.Bytes()...)))
+	input.Reset()
+}
+
+// the handlers are shared by all the sessions of the test
+func (this *udpEchoHandler) Clone() IoHandler {
+	return this
+}
+
+// start the udp acceptor at a random port
+func startUdpAcceptor(t *testing.T, idleTimeout int, handler IoHandler) *UdpAcceptor {
+	acceptor := NewUdpAcceptor(NewUdpConfig(0, 16, idleTimeout))
+	acceptor.GetFilterChain().AddLast("handler", handler)
+	if !acceptor.Start() {
+		t.Fatal("udp acceptor start failed")
+	}
+
+	t.Cleanup(acceptor.Stop)
+	return acceptor
+}
+
+// dial the acceptor from a new local port
+func dialUdp(t *testing.T, acceptor *UdpAcceptor) *net.UDPConn {
+	port := acceptor.Addr().(*net.UDPAddr).Port
+	client, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// send the datagram and expect the echo
+func expectUdpEcho(t *testing.T, client *net.UDPConn, message string) {
+	t.Helper()
+
+	if _, err := client.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 1024)
+	client.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, err := client.Read(buffer)
+	if err != nil || string(buffer[:n]) != message {
+		t.Fatalf("echo %q, err %v, expect %q", buffer[:n], err, message)
+	}
+}
+
+// wait until the condition is true
+func waitUdp(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// each remote address gets its own session
+func TestUdpAcceptorSessions(t *testing.T) {
+	handler := newUdpEchoHandler(false)
+	acceptor := startUdpAcceptor(t, 0, handler)
+
+	clients := []*net.UDPConn{dialUdp(t, acceptor), dialUdp(t, acceptor)}
+	for i := 0; i < 3; i++ {
+		for j, client := range clients {
+			expectUdpEcho(t, client, string(rune('a'+j))+string(rune('0'+i)))
+		}
+	}
+
+	if count := acceptor.SessionCount(); count != 2 {
+		t.Fatalf("session count %d, expect 2", count)
+	}
+	if opened := atomic.LoadInt32(&handler.opened); opened != 2 {
+		t.Fatalf("sessions opened %d, expect 2", opened)
+	}
+
+	stats := acceptor.Stats()
+	if stats.Accepts != 2 || stats.ActiveConnections != 2 || stats.MessagesIn != 6 {
+		t.Fatalf("stats accepts %d, active %d, messages in %d", stats.Accepts, stats.ActiveConnections, stats.MessagesIn)
+	}
+}
+
+func TestUdpAcceptorIdleTimeout(t *testing.T) {
+	handler := newUdpEchoHandler(false)
+	acceptor := startUdpAcceptor(t, 1, handler)
+
+	client := dialUdp(t, acceptor)
+	expectUdpEcho(t, client, "ping")
+
+	waitUdp(t, "the idle session removed", func() bool {
+		return acceptor.SessionCount() == 0
+	})
+	if closed := atomic.LoadInt32(&handler.closed); closed != 1 {
+		t.Fatalf("sessions closed %d, expect 1", closed)
+	}
+	if count := acceptor.Stats().CloseReasons[CloseReasonIdleTimeout]; count != 1 {
+		t.Fatalf("idle timeout closes %d, expect 1", count)
+	}
+
+	// the next datagram gets a new session
+	expectUdpEcho(t, client, "again")
+	if opened := atomic.LoadInt32(&handler.opened); opened != 2 {
+		t.Fatalf("sessions opened %d, expect 2", opened)
+	}
+}
+
+func TestUdpAcceptorStop(t *testing.T) {
+	handler := newUdpEchoHandler(false)
+	acceptor := startUdpAcceptor(t, 0, handler)
+
+	for i := 0; i < 3; i++ {
+		expectUdpEcho(t, dialUdp(t, acceptor), "hello")
+	}
+
+	acceptor.Stop()
+	done := make(chan struct{})
+	go func() {
+		acceptor.WaitForStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the sessions don't exit after the stop")
+	}
+
+	if count := acceptor.SessionCount(); count != 0 {
+		t.Fatalf("session count %d after the stop", count)
+	}
+	if closed := atomic.LoadInt32(&handler.closed); closed != 3 {
+		t.Fatalf("sessions closed %d, expect 3", closed)
+	}
+}
+
+// the datagrams beyond the recv queue are dropped and counted
+func TestUdpSessionRecvQueueDrops(t *testing.T) {
+	handler := newUdpEchoHandler(true)
+	acceptor := startUdpAcceptor(t, 0, handler)
+	defer close(handler.hold)
+
+	session := acceptor.getOrNewSession(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9})
+	session.push([]byte("first"))
+	waitFor(t, handler.held, "the first datagram held")
+
+	// the read loop holds the first one, the queue takes the next udpSessionRecvQueueSize
+	drops := 3
+	for i := 0; i < udpSessionRecvQueueSize+drops; i++ {
+		session.push([]byte("x"))
+	}
+
+	if count := session.con.Stats().RecvQueueDrops; count != uint64(drops) {
+		t.Fatalf("session recv queue drops %d, expect %d", count, drops)
+	}
+	if count := acceptor.Stats().RecvQueueDrops; count != uint64(drops) {
+		t.Fatalf("acceptor recv queue drops %d, expect %d", count, drops)
+	}
+}
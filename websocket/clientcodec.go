@@ -0,0 +1,145 @@
+// File ClientCodec
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"gonetio"
+	"net/http"
+)
+
+// the client side websocket codec
+// it must be the first filter of the chain, it sends the upgrade request when
+// the connection opened, fires ConnOpened to the next filters after the handshake
+// done, then fires each text or binary message as a *bytes.Buffer
+type ClientCodec struct {
+	gonetio.IoHandlerAdaptor
+	frameCodec
+	host string // the Host header, the remote addr when empty
+	path string // the request path
+	key  string // the Sec-WebSocket-Key sent
+}
+
+// new client codec
+func NewClientCodec(host string, path string) *ClientCodec {
+	if path == "" {
+		path = "/"
+	}
+
+	handler := &ClientCodec{
+		frameCodec: frameCodec{
+			client:         true,
+			maxMessageSize: DefaultMaxMessageSize,
+			messageType:    BinaryMessage,
+		},
+		host: host,
+		path: path,
+	}
+	handler.SetBoundType(gonetio.InBound | gonetio.OutBound)
+	return handler
+}
+
+// new connector speaking websocket, the codec is added as the first filter
+func NewConnector(name string, maxSendQueueSize int, keepAliveTimeDuration int, host string, path string) *gonetio.TcpConnector {
+	connector := gonetio.NewConnector(name, maxSendQueueSize, keepAliveTimeDuration)
+	connector.GetIoFilterChain().AddFirst(CodecName, NewClientCodec(host, path))
+	return connector
+}
+
+// Connection opened
+// send the upgrade request, the next filters see it after the handshake done
+func (this *ClientCodec) ConnOpened(filter *gonetio.IoFilter) {
+	this.reset()
+
+	host := this.host
+	if host == "" {
+		host = filter.GetCon().RemoteAddr()
+	}
+
+	this.key = newChallengeKey()
+	request := "GET " + this.path + " HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + this.key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	filter.FireWrite(bytes.NewBufferString(request))
+}
+
+// The event fired when receive message from the connection
+func (this *ClientCodec) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	input := obj.(*bytes.Buffer)
+
+	if this.closed {
+		input.Reset()
+		return
+	}
+
+	if !this.IsUpgraded() && !this.handshake(filter, input) {
+		return
+	}
+
+	this.decodeFrames(filter, input)
+}
+
+// Fire Write
+func (this *ClientCodec) FireWrite(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.encode(filter, obj)
+}
+
+// check the upgrade response, return true if the handshake done
+func (this *ClientCodec) handshake(filter *gonetio.IoFilter, input *bytes.Buffer) bool {
+	data := input.Bytes()
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(data) > maxHeaderSize {
+			this.fail(filter, fmt.Errorf("%w: response header too large", ErrHandshake))
+		}
+		return false
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data[:end+4])), nil)
+	input.Next(end + 4)
+	if err != nil {
+		this.fail(filter, fmt.Errorf("%w: %s", ErrHandshake, err.Error()))
+		return false
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		this.fail(filter, fmt.Errorf("%w: status %s", ErrHandshake, response.Status))
+		return false
+	}
+
+	if !headerContainsToken(response.Header, "Connection", "upgrade") || !headerContainsToken(response.Header, "Upgrade", "websocket") {
+		this.fail(filter, fmt.Errorf("%w: not a websocket upgrade response", ErrHandshake))
+		return false
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != computeAcceptKey(this.key) {
+		this.fail(filter, fmt.Errorf("%w: bad Sec-WebSocket-Accept", ErrHandshake))
+		return false
+	}
+
+	this.setUpgraded()
+	filter.ConnOpened()
+
+	return true
+}
+
+// the handshake failed, close the connection
+func (this *ClientCodec) fail(filter *gonetio.IoFilter, err error) {
+	filter.Logger().Log(gonetio.LvlError, "WebSocket handshake failed, close the connection", "err", err)
+
+	this.closed = true
+	filter.GetCon().Close()
+}
+
+// Clone
+func (this *ClientCodec) Clone() gonetio.IoHandler {
+	handler := NewClientCodec(this.host, this.path)
+	handler.maxMessageSize = this.maxMessageSize
+	handler.messageType = this.messageType
+	return handler
+}
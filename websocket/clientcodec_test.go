@@ -0,0 +1,102 @@
+// File ClientCodec test
+
+package websocket
+
+import (
+	"bytes"
+	"gonetio"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// start the client codec, answer the upgrade request from the raw peer with the accept
+// the accept of the key sent is used if accept is empty
+func startClientCodec(t *testing.T, accept string) (*gonetio.Tcpcon, *ClientCodec, *messageRecorder, *rawPeer) {
+	t.Helper()
+
+	codec := NewClientCodec("localhost", "/ws")
+	con, recorder, peer := startCodecCon(t, codec)
+
+	request, err := http.ReadRequest(peer.reader)
+	if err != nil {
+		t.Fatalf("read the upgrade request failed, %v", err)
+	}
+	if request.URL.Path != "/ws" || request.Host != "localhost" || request.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("upgrade request path %s, host %s, header %v", request.URL.Path, request.Host, request.Header)
+	}
+
+	if accept == "" {
+		accept = computeAcceptKey(request.Header.Get("Sec-WebSocket-Key"))
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+	if _, err := peer.conn.Write([]byte(response)); err != nil {
+		t.Fatalf("write the upgrade response failed, %v", err)
+	}
+	return con, codec, recorder, peer
+}
+
+func TestClientHandshake(t *testing.T) {
+	_, codec, recorder, _ := startClientCodec(t, "")
+
+	select {
+	case <-recorder.opened:
+	case <-time.After(3 * time.Second):
+		t.Fatal("ConnOpened is not fired after the handshake")
+	}
+	if !codec.IsUpgraded() {
+		t.Fatal("not upgraded after the handshake")
+	}
+}
+
+func TestClientHandshakeBadAccept(t *testing.T) {
+	_, codec, recorder, peer := startClientCodec(t, "bad")
+
+	if _, err := peer.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("read after the bad accept err %v, expect EOF", err)
+	}
+	select {
+	case <-recorder.opened:
+		t.Fatal("ConnOpened fired for the bad accept")
+	default:
+	}
+	if codec.IsUpgraded() {
+		t.Fatal("upgraded with the bad accept")
+	}
+}
+
+// the client masks the frames written, and takes the unmasked frames only
+func TestClientFrameMask(t *testing.T) {
+	_, _, recorder, peer := startClientCodec(t, "")
+	<-recorder.opened
+	peer.readFrames()
+
+	peer.writeFrame(t, true, TextMessage, []byte("from server"), false)
+	recorder.expectMessage(t, "from server")
+
+	peer.writeFrame(t, true, PingMessage, []byte("p"), false)
+	if frame := peer.expectFrame(t, PongMessage, []byte("p")); !frame.masked {
+		t.Fatal("the client pong is not masked")
+	}
+
+	peer.writeFrame(t, true, BinaryMessage, []byte("masked"), true)
+	peer.expectClose(t, CloseProtocolError)
+	recorder.expectNoMessage(t)
+}
+
+func TestClientWrite(t *testing.T) {
+	con, _, recorder, peer := startClientCodec(t, "")
+	<-recorder.opened
+	peer.readFrames()
+
+	if err := con.SendAsync(bytes.NewBufferString("hello")).Wait(); err != nil {
+		t.Fatalf("send failed, %v", err)
+	}
+	if frame := peer.expectFrame(t, BinaryMessage, []byte("hello")); !frame.masked {
+		t.Fatal("the client frame is not masked")
+	}
+}
@@ -0,0 +1,364 @@
+// File Frame
+
+package websocket
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gonetio"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// the name of the codec filter
+const CodecName = "WebSocketCodec"
+
+const (
+	DefaultMaxMessageSize = 5 * 1024 * 1024 // default max message size 5m
+	maxHeaderSize         = 8 * 1024        // max http upgrade header size
+	acceptGUID            = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// message type, the opcode of the frame
+const (
+	ContinuationMessage = 0
+	TextMessage         = 1
+	BinaryMessage       = 2
+	CloseMessage        = 8
+	PingMessage         = 9
+	PongMessage         = 10
+)
+
+// close code
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseInvalidFramePayloadData = 1007
+	CloseMessageTooBig           = 1009
+)
+
+// error type
+var (
+	ErrProtocol           = errors.New("WebSocket protocol error")
+	ErrMessageTooBig      = errors.New("WebSocket message extends the max message size")
+	ErrInvalidUTF8        = errors.New("WebSocket text message is not valid utf8")
+	ErrHandshake          = errors.New("WebSocket handshake failed")
+	ErrUnsupportedMessage = errors.New("WebSocket unsupported message to write")
+)
+
+// the message to write with an explicit type
+// a *bytes.Buffer written is sent as the default message type of the codec
+type Message struct {
+	Type int    // message type
+	Data []byte // message data
+}
+
+// format the payload of the close message
+func FormatCloseMessage(code int, text string) []byte {
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return payload
+}
+
+// compute the Sec-WebSocket-Accept of the key
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// new a random Sec-WebSocket-Key
+func newChallengeKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// encode a frame into the buffer, the client masks the payload
+func encodeFrame(buffer *bytes.Buffer, opcode int, payload []byte, mask bool) {
+	length := len(payload)
+	buffer.WriteByte(0x80 | byte(opcode))
+
+	var maskBit byte = 0
+	if mask {
+		maskBit = 0x80
+	}
+
+	if length <= 125 {
+		buffer.WriteByte(maskBit | byte(length))
+	} else if length <= 0xffff {
+		var lengthBuffer [2]byte
+		binary.BigEndian.PutUint16(lengthBuffer[:], uint16(length))
+		buffer.WriteByte(maskBit | 126)
+		buffer.Write(lengthBuffer[:])
+	} else {
+		var lengthBuffer [8]byte
+		binary.BigEndian.PutUint64(lengthBuffer[:], uint64(length))
+		buffer.WriteByte(maskBit | 127)
+		buffer.Write(lengthBuffer[:])
+	}
+
+	if !mask {
+		buffer.Write(payload)
+		return
+	}
+
+	var maskKey [4]byte
+	rand.Read(maskKey[:])
+	buffer.Write(maskKey[:])
+
+	start := buffer.Len()
+	buffer.Write(payload)
+	maskBytes(maskKey[:], buffer.Bytes()[start:])
+}
+
+// mask or unmask the data in place
+func maskBytes(key []byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i&3]
+	}
+}
+
+// the frame codec shared by the server and the client
+type frameCodec struct {
+	client         bool          // the client masks the outbound frames, the server requires masked inbound frames
+	maxMessageSize int           // max message size
+	messageType    int           // the type of the *bytes.Buffer written
+	upgraded       int32         // is the handshake done
+	closeSent      int32         // is the close frame sent
+	closed         bool          // stop decoding, discard all the input
+	fragments      *bytes.Buffer // the data of the fragmented message
+	fragmentType   int           // the type of the fragmented message, 0 if none
+}
+
+// reset the state for a new connection
+func (this *frameCodec) reset() {
+	atomic.StoreInt32(&this.upgraded, 0)
+	atomic.StoreInt32(&this.closeSent, 0)
+	this.closed = false
+	this.fragments = nil
+	this.fragmentType = 0
+}
+
+// set the max message size
+func (this *frameCodec) SetMaxMessageSize(size int) {
+	this.maxMessageSize = size
+}
+
+// set the type of the *bytes.Buffer written, BinaryMessage or TextMessage
+func (this *frameCodec) SetMessageType(messageType int) {
+	this.messageType = messageType
+}
+
+// is the handshake done
+func (this *frameCodec) IsUpgraded() bool {
+	return atomic.LoadInt32(&this.upgraded) == 1
+}
+
+// mark the handshake done
+func (this *frameCodec) setUpgraded() {
+	atomic.StoreInt32(&this.upgraded, 1)
+}
+
+// write a frame to the next out bound filter
+func (this *frameCodec) writeFrame(filter *gonetio.IoFilter, opcode int, payload []byte) {
+	if opcode == CloseMessage {
+		atomic.StoreInt32(&this.closeSent, 1)
+	}
+	buffer := filter.GetCon().NewWriteBuffer(len(payload) + 14)
+	encodeFrame(buffer, opcode, payload, this.client)
+	filter.FireWrite(buffer)
+	filter.GetCon().ReleaseWriteBuffer(buffer)
+}
+
+// send the close frame and close the connection after it's written
+func (this *frameCodec) closeWith(filter *gonetio.IoFilter, code int, err error) {
+	if err != nil {
+		filter.Logger().Log(gonetio.LvlError, "WebSocket error, close the connection", "err", err)
+	}
+
+	this.closed = true
+	if atomic.LoadInt32(&this.closeSent) == 0 {
+		this.writeFrame(filter, CloseMessage, FormatCloseMessage(code, ""))
+	}
+	filter.GetCon().FlushAndClose()
+}
+
+// decode the frames in the input, fire the messages to the next filter
+func (this *frameCodec) decodeFrames(filter *gonetio.IoFilter, input *bytes.Buffer) {
+	for !this.closed {
+		data := input.Bytes()
+		if len(data) < 2 {
+			return
+		}
+
+		fin := data[0]&0x80 != 0
+		rsv := data[0] & 0x70
+		opcode := int(data[0] & 0x0f)
+		masked := data[1]&0x80 != 0
+		payloadLen := uint64(data[1] & 0x7f)
+
+		headerLen := 2
+		if payloadLen == 126 {
+			if len(data) < 4 {
+				return
+			}
+			payloadLen = uint64(binary.BigEndian.Uint16(data[2:4]))
+			headerLen = 4
+		} else if payloadLen == 127 {
+			if len(data) < 10 {
+				return
+			}
+			payloadLen = binary.BigEndian.Uint64(data[2:10])
+			headerLen = 10
+		}
+
+		if rsv != 0 {
+			this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: reserved bits set", ErrProtocol))
+			return
+		}
+
+		if masked == this.client {
+			this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: bad frame mask", ErrProtocol))
+			return
+		}
+
+		switch opcode {
+		case ContinuationMessage, TextMessage, BinaryMessage:
+		case CloseMessage, PingMessage, PongMessage:
+			if !fin || payloadLen > 125 {
+				this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: bad control frame", ErrProtocol))
+				return
+			}
+		default:
+			this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: unknown opcode %d", ErrProtocol, opcode))
+			return
+		}
+
+		if payloadLen > uint64(this.maxMessageSize) {
+			this.closeWith(filter, CloseMessageTooBig, fmt.Errorf("%w: frame size %d", ErrMessageTooBig, payloadLen))
+			return
+		}
+
+		var maskKey []byte = nil
+		if masked {
+			if len(data) < headerLen+4 {
+				return
+			}
+			maskKey = data[headerLen : headerLen+4]
+			headerLen += 4
+		}
+
+		if uint64(len(data)-headerLen) < payloadLen {
+			return
+		}
+
+		payload := make([]byte, payloadLen)
+		copy(payload, data[headerLen:])
+		if masked {
+			maskBytes(maskKey, payload)
+		}
+		input.Next(headerLen + int(payloadLen))
+
+		this.handleFrame(filter, fin, opcode, payload)
+	}
+
+	input.Reset()
+}
+
+// handle a whole frame
+func (this *frameCodec) handleFrame(filter *gonetio.IoFilter, fin bool, opcode int, payload []byte) {
+	switch opcode {
+	case TextMessage, BinaryMessage:
+		if this.fragmentType != 0 {
+			this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: expect continuation frame", ErrProtocol))
+			return
+		}
+
+		if fin {
+			this.emit(filter, opcode, payload)
+			return
+		}
+
+		this.fragmentType = opcode
+		this.fragments = bytes.NewBuffer(payload)
+
+	case ContinuationMessage:
+		if this.fragmentType == 0 {
+			this.closeWith(filter, CloseProtocolError, fmt.Errorf("%w: unexpected continuation frame", ErrProtocol))
+			return
+		}
+
+		if this.fragments.Len()+len(payload) > this.maxMessageSize {
+			this.closeWith(filter, CloseMessageTooBig, fmt.Errorf("%w: message size %d", ErrMessageTooBig, this.fragments.Len()+len(payload)))
+			return
+		}
+
+		this.fragments.Write(payload)
+		if fin {
+			messageType := this.fragmentType
+			message := this.fragments.Bytes()
+			this.fragmentType = 0
+			this.fragments = nil
+			this.emit(filter, messageType, message)
+		}
+
+	case CloseMessage:
+		code := CloseNoStatusReceived
+		if len(payload) >= 2 {
+			code = int(binary.BigEndian.Uint16(payload))
+		}
+
+		// echo the close frame, then close the connection
+		if code == CloseNoStatusReceived {
+			code = CloseNormalClosure
+		}
+		this.closeWith(filter, code, nil)
+
+	case PingMessage:
+		this.writeFrame(filter, PongMessage, payload)
+
+	case PongMessage:
+	}
+}
+
+// fire the message to the next filter
+func (this *frameCodec) emit(filter *gonetio.IoFilter, messageType int, payload []byte) {
+	if messageType == TextMessage && !utf8.Valid(payload) {
+		this.closeWith(filter, CloseInvalidFramePayloadData, ErrInvalidUTF8)
+		return
+	}
+
+	filter.MessageReceived(bytes.NewBuffer(payload))
+}
+
+// encode the object written as a frame
+func (this *frameCodec) encode(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	if !this.IsUpgraded() {
+		filter.Logger().Log(gonetio.LvlError, "WebSocket write before the handshake done, drop it")
+		return
+	}
+
+	switch msg := obj.(type) {
+	case *bytes.Buffer:
+		this.writeFrame(filter, this.messageType, msg.Bytes())
+	case *Message:
+		this.writeFrame(filter, msg.Type, msg.Data)
+	default:
+		// the failure goes to the writer, it's only logged if the write has no future
+		err := fmt.Errorf("%w: %T", ErrUnsupportedMessage, obj)
+		if !filter.FailWrite(err) {
+			filter.Logger().Log(gonetio.LvlWarn, "WebSocket write failed", "err", err)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// File Frame test
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gonetio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record the events the codec fires to the next filter
+type messageRecorder struct {
+	gonetio.IoHandlerImp
+	opened   chan struct{}
+	messages chan string
+	errs     chan error
+}
+
+func newMessageRecorder() *messageRecorder {
+	handler := &messageRecorder{
+		opened:   make(chan struct{}, 1),
+		messages: make(chan string, 16),
+		errs:     make(chan error, 16),
+	}
+	handler.SetBoundType(gonetio.InBound)
+	return handler
+}
+
+func (this *messageRecorder) ConnOpened(filter *gonetio.IoFilter) {
+	this.opened <- struct{}{}
+}
+
+func (this *messageRecorder) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.messages <- obj.(*bytes.Buffer).String()
+}
+
+func (this *messageRecorder) ExceptionCaught(filter *gonetio.IoFilter, err error) {
+	this.errs <- err
+}
+
+func (this *messageRecorder) Clone() gonetio.IoHandler {
+	return newMessageRecorder()
+}
+
+// expect the message fired
+func (this *messageRecorder) expectMessage(t *testing.T, message string) {
+	t.Helper()
+
+	select {
+	case received := <-this.messages:
+		if received != message {
+			t.Fatalf("recv message %q, expect %q", received, message)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for the message %q", message)
+	}
+}
+
+// expect no message fired
+func (this *messageRecorder) expectNoMessage(t *testing.T) {
+	t.Helper()
+
+	select {
+	case received := <-this.messages:
+		t.Fatalf("unexpected message %q", received)
+	default:
+	}
+}
+
+// a frame read by the raw peer
+type rawFrame struct {
+	fin     bool
+	opcode  int
+	masked  bool
+	payload []byte
+}
+
+// the raw peer of the codec, it reads the frames in its own goroutine once started
+type rawPeer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	frames chan rawFrame
+}
+
+// start the connection over the pipe with the codec and the recorder
+func startCodecCon(t *testing.T, codec gonetio.IoHandler) (*gonetio.Tcpcon, *messageRecorder, *rawPeer) {
+	local, remote := net.Pipe()
+	recorder := newMessageRecorder()
+
+	con := gonetio.NewConnFull(local, 64, &sync.WaitGroup{}, 0)
+	chain := gonetio.NewIoFilterChain(con)
+	chain.AddLast(CodecName, codec)
+	chain.AddLast("recorder", recorder)
+	con.SetIoFilterChain(chain)
+	con.Start()
+
+	t.Cleanup(func() {
+		con.Close()
+		remote.Close()
+	})
+	return con, recorder, &rawPeer{conn: remote, reader: bufio.NewReader(remote)}
+}
+
+// start the server codec and upgrade it from the raw peer
+func startUpgradedServer(t *testing.T) (*gonetio.Tcpcon, *ServerCodec, *messageRecorder, *rawPeer) {
+	t.Helper()
+
+	codec := NewServerCodec("/ws")
+	con, recorder, peer := startCodecCon(t, codec)
+
+	response := peer.upgrade(t, "/ws", "13")
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status %d", response.StatusCode)
+	}
+	peer.readFrames()
+	return con, codec, recorder, peer
+}
+
+// send the upgrade request, return the response
+func (this *rawPeer) upgrade(t *testing.T, path string, version string) *http.Response {
+	t.Helper()
+
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: " + version + "\r\n\r\n"
+	return this.sendRequest(t, request)
+}
+
+// send the raw http request, return the response
+func (this *rawPeer) sendRequest(t *testing.T, request string) *http.Response {
+	t.Helper()
+
+	go this.conn.Write([]byte(request))
+	response, err := http.ReadResponse(this.reader, nil)
+	if err != nil {
+		t.Fatalf("read the upgrade response failed, %v", err)
+	}
+	return response
+}
+
+// read the frames to the channel until the pipe closed
+func (this *rawPeer) readFrames() {
+	this.frames = make(chan rawFrame, 16)
+	go func() {
+		defer close(this.frames)
+		for {
+			frame, err := readRawFrame(this.reader)
+			if err != nil {
+				return
+			}
+			this.frames <- frame
+		}
+	}()
+}
+
+// write the frame, the fin bit is cleared if not fin
+func (this *rawPeer) writeFrame(t *testing.T, fin bool, opcode int, payload []byte, mask bool) {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	encodeFrame(buffer, opcode, payload, mask)
+	if !fin {
+		buffer.Bytes()[0] &^= 0x80
+	}
+	if _, err := this.conn.Write(buffer.Bytes()); err != nil {
+		t.Fatalf("write frame failed, %v", err)
+	}
+}
+
+// expect the frame read
+func (this *rawPeer) expectFrame(t *testing.T, opcode int, payload []byte) rawFrame {
+	t.Helper()
+
+	select {
+	case frame, ok := <-this.frames:
+		if !ok {
+			t.Fatalf("the pipe closed, expect the frame of opcode %d", opcode)
+		}
+		if frame.opcode != opcode || !bytes.Equal(frame.payload, payload) {
+			t.Fatalf("recv frame opcode %d, payload %q, expect opcode %d, payload %q", frame.opcode, frame.payload, opcode, payload)
+		}
+		return frame
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for the frame of opcode %d", opcode)
+	}
+	return rawFrame{}
+}
+
+// expect the close frame with the code, then the pipe closed
+func (this *rawPeer) expectClose(t *testing.T, code int) {
+	t.Helper()
+
+	this.expectFrame(t, CloseMessage, FormatCloseMessage(code, ""))
+	select {
+	case frame, ok := <-this.frames:
+		if ok {
+			t.Fatalf("recv frame opcode %d after the close frame", frame.opcode)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the connection closed")
+	}
+}
+
+// read a frame, unmask the payload
+func readRawFrame(reader *bufio.Reader) (rawFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return rawFrame{}, err
+	}
+
+	frame := rawFrame{
+		fin:    header[0]&0x80 != 0,
+		opcode: int(header[0] & 0x0f),
+		masked: header[1]&0x80 != 0,
+	}
+
+	length := uint64(header[1] & 0x7f)
+	if length == 126 {
+		var lengthBuffer [2]byte
+		if _, err := io.ReadFull(reader, lengthBuffer[:]); err != nil {
+			return rawFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(lengthBuffer[:]))
+	} else if length == 127 {
+		var lengthBuffer [8]byte
+		if _, err := io.ReadFull(reader, lengthBuffer[:]); err != nil {
+			return rawFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(lengthBuffer[:])
+	}
+
+	var maskKey [4]byte
+	if frame.masked {
+		if _, err := io.ReadFull(reader, maskKey[:]); err != nil {
+			return rawFrame{}, err
+		}
+	}
+
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(reader, frame.payload); err != nil {
+		return rawFrame{}, err
+	}
+	if frame.masked {
+		maskBytes(maskKey[:], frame.payload)
+	}
+	return frame, nil
+}
+
+func TestEncodeFrame(t *testing.T) {
+	tests := []struct {
+		length int
+		header int // the header size without the mask key
+	}{
+		{0, 2},
+		{125, 2},
+		{126, 4},
+		{0xffff, 4},
+		{0x10000, 10},
+	}
+
+	for _, test := range tests {
+		for _, mask := range []bool{false, true} {
+			payload := bytes.Repeat([]byte("x"), test.length)
+			buffer := &bytes.Buffer{}
+			encodeFrame(buffer, BinaryMessage, payload, mask)
+
+			expectSize := test.header + test.length
+			if mask {
+				expectSize += 4
+			}
+			if buffer.Len() != expectSize {
+				t.Fatalf("length %d, mask %v, frame size %d, expect %d", test.length, mask, buffer.Len(), expectSize)
+			}
+
+			frame, err := readRawFrame(bufio.NewReader(buffer))
+			if err != nil {
+				t.Fatalf("length %d, mask %v, read frame failed, %v", test.length, mask, err)
+			}
+			if !frame.fin || frame.opcode != BinaryMessage || frame.masked != mask || !bytes.Equal(frame.payload, payload) {
+				t.Fatalf("length %d, mask %v, decoded fin %v, opcode %d, masked %v", test.length, mask, frame.fin, frame.opcode, frame.masked)
+			}
+		}
+	}
+}
+
+// the server takes the masked frames only
+func TestServerFrameMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  int
+		payload string
+		mask    bool
+		close   int // the close code expected, 0 if the message is fired
+	}{
+		{"masked text", TextMessage, "hello", true, 0},
+		{"masked binary", BinaryMessage, "\x00\x01\x02", true, 0},
+		{"masked long", BinaryMessage, strings.Repeat("y", 300), true, 0},
+		{"unmasked", TextMessage, "hello", false, CloseProtocolError},
+		{"invalid utf8", TextMessage, "\xff\xfe", true, CloseInvalidFramePayloadData},
+	}
+
+	for _, test := range tests {
+		_, _, recorder, peer := startUpgradedServer(t)
+		peer.writeFrame(t, true, test.opcode, []byte(test.payload), test.mask)
+
+		if test.close == 0 {
+			recorder.expectMessage(t, test.payload)
+			continue
+		}
+		peer.expectClose(t, test.close)
+		recorder.expectNoMessage(t)
+	}
+}
+
+func TestServerFragmentedMessage(t *testing.T) {
+	_, _, recorder, peer := startUpgradedServer(t)
+
+	// the ping between the fragments is answered at once
+	peer.writeFrame(t, false, TextMessage, []byte("hel"), true)
+	peer.writeFrame(t, false, ContinuationMessage, []byte("lo "), true)
+	peer.writeFrame(t, true, PingMessage, []byte("p"), true)
+	peer.expectFrame(t, PongMessage, []byte("p"))
+	recorder.expectNoMessage(t)
+
+	peer.writeFrame(t, true, ContinuationMessage, []byte("world"), true)
+	recorder.expectMessage(t, "hello world")
+
+	// the continuation without a first frame breaks the protocol
+	peer.writeFrame(t, true, ContinuationMessage, []byte("x"), true)
+	peer.expectClose(t, CloseProtocolError)
+}
+
+func TestServerPingPong(t *testing.T) {
+	_, _, recorder, peer := startUpgradedServer(t)
+
+	payloads := []string{"", "ping", strings.Repeat("p", 125)}
+	for _, payload := range payloads {
+		peer.writeFrame(t, true, PingMessage, []byte(payload), true)
+		frame := peer.expectFrame(t, PongMessage, []byte(payload))
+		if frame.masked {
+			t.Fatal("the server masked the pong")
+		}
+	}
+
+	// the pong is not fired to the handlers
+	peer.writeFrame(t, true, PongMessage, []byte("pong"), true)
+	peer.writeFrame(t, true, TextMessage, []byte("after"), true)
+	recorder.expectMessage(t, "after")
+}
+
+func TestServerCloseEcho(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		echo    int
+	}{
+		{"normal", FormatCloseMessage(CloseNormalClosure, "bye"), CloseNormalClosure},
+		{"going away", FormatCloseMessage(CloseGoingAway, ""), CloseGoingAway},
+		{"no status", nil, CloseNormalClosure},
+	}
+
+	for _, test := range tests {
+		con, _, _, peer := startUpgradedServer(t)
+		peer.writeFrame(t, true, CloseMessage, test.payload, true)
+		peer.expectClose(t, test.echo)
+
+		deadline := time.Now().Add(3 * time.Second)
+		for con.IsConnected() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: the connection not closed after the close echo", test.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestServerMessageTooBig(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []string // the fragments of the message
+	}{
+		{"one frame", []string{strings.Repeat("x", 17)}},
+		{"fragments", []string{strings.Repeat("x", 10), strings.Repeat("x", 7)}},
+	}
+
+	for _, test := range tests {
+		_, codec, recorder, peer := startUpgradedServer(t)
+		codec.SetMaxMessageSize(16)
+
+		for i, fragment := range test.frames {
+			opcode := BinaryMessage
+			if i > 0 {
+				opcode = ContinuationMessage
+			}
+			peer.writeFrame(t, i == len(test.frames)-1, opcode, []byte(fragment), true)
+		}
+
+		peer.expectClose(t, CloseMessageTooBig)
+		recorder.expectNoMessage(t)
+	}
+}
+
+// the unsupported message fails the write only, no exception is fired
+func TestServerWriteUnsupported(t *testing.T) {
+	con, _, recorder, peer := startUpgradedServer(t)
+
+	if err := con.Send(42); !errors.Is(err, ErrUnsupportedMessage) {
+		t.Fatalf("send int err %v, expect ErrUnsupportedMessage", err)
+	}
+	select {
+	case err := <-recorder.errs:
+		t.Fatalf("unexpected exception %v", err)
+	default:
+	}
+
+	// the connection still works
+	if err := con.SendAsync(&Message{Type: TextMessage, Data: []byte("ok")}).Wait(); err != nil {
+		t.Fatalf("send text failed, %v", err)
+	}
+	peer.expectFrame(t, TextMessage, []byte("ok"))
+}
@@ -0,0 +1,180 @@
+// File ServerCodec
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"gonetio"
+	"net/http"
+	"strings"
+)
+
+// the server side websocket codec
+// it must be the first filter of the chain, it performs the http upgrade,
+// fires ConnOpened to the next filters after the handshake done, then fires
+// each text or binary message as a *bytes.Buffer
+type ServerCodec struct {
+	gonetio.IoHandlerAdaptor
+	frameCodec
+	path    string        // the request path to accept, any path when empty
+	request *http.Request // the upgrade request
+}
+
+// new server codec
+func NewServerCodec(path string) *ServerCodec {
+	handler := &ServerCodec{
+		frameCodec: frameCodec{
+			client:         false,
+			maxMessageSize: DefaultMaxMessageSize,
+			messageType:    BinaryMessage,
+		},
+		path: path,
+	}
+	handler.SetBoundType(gonetio.InBound | gonetio.OutBound)
+	return handler
+}
+
+// new acceptor serving websocket on the path, the codec is added as the first filter
+func NewAcceptor(conf *gonetio.AcceptorConf, path string) *gonetio.TcpAcceptor {
+	acceptor := gonetio.NewAcceptor(conf)
+	acceptor.GetFilterChain().AddFirst(CodecName, NewServerCodec(path))
+	return acceptor
+}
+
+// get the upgrade request, nil before the handshake done
+func (this *ServerCodec) Request() *http.Request {
+	return this.request
+}
+
+// Connection opened
+// wait for the upgrade request, the next filters see it after the handshake done
+func (this *ServerCodec) ConnOpened(filter *gonetio.IoFilter) {
+	this.reset()
+	this.request = nil
+}
+
+// Connection closed
+func (this *ServerCodec) ConnClosed(filter *gonetio.IoFilter) {
+	if this.IsUpgraded() {
+		filter.ConnClosed()
+	}
+}
+
+// Connection closing
+// let the next filters say goodbye, then start the close handshake
+func (this *ServerCodec) ConnClosing(filter *gonetio.IoFilter) {
+	if this.IsUpgraded() {
+		filter.ConnClosing()
+		this.writeFrame(filter, CloseMessage, FormatCloseMessage(CloseGoingAway, ""))
+	}
+}
+
+// The event fired when receive message from the connection
+func (this *ServerCodec) MessageReceived(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	input := obj.(*bytes.Buffer)
+
+	if this.closed {
+		input.Reset()
+		return
+	}
+
+	if !this.IsUpgraded() && !this.upgrade(filter, input) {
+		return
+	}
+
+	this.decodeFrames(filter, input)
+}
+
+// Fire Write
+func (this *ServerCodec) FireWrite(filter *gonetio.IoFilter, obj gonetio.BaseObject) {
+	this.encode(filter, obj)
+}
+
+// perform the http upgrade, return true if the handshake done
+func (this *ServerCodec) upgrade(filter *gonetio.IoFilter, input *bytes.Buffer) bool {
+	data := input.Bytes()
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(data) > maxHeaderSize {
+			this.reject(filter, http.StatusRequestHeaderFieldsTooLarge, "request header too large")
+		}
+		return false
+	}
+
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data[:end+4])))
+	input.Next(end + 4)
+	if err != nil {
+		this.reject(filter, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if request.Method != http.MethodGet {
+		this.reject(filter, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+
+	if this.path != "" && request.URL.Path != this.path {
+		this.reject(filter, http.StatusNotFound, "path not found")
+		return false
+	}
+
+	if !headerContainsToken(request.Header, "Connection", "upgrade") || !headerContainsToken(request.Header, "Upgrade", "websocket") {
+		this.reject(filter, http.StatusBadRequest, "not a websocket upgrade request")
+		return false
+	}
+
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		this.reject(filter, http.StatusUpgradeRequired, "unsupported websocket version")
+		return false
+	}
+
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		this.reject(filter, http.StatusBadRequest, "missing Sec-WebSocket-Key")
+		return false
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + computeAcceptKey(key) + "\r\n\r\n"
+	filter.FireWrite(bytes.NewBufferString(response))
+
+	this.request = request
+	this.setUpgraded()
+	filter.ConnOpened()
+
+	return true
+}
+
+// reject the upgrade request, close the connection after the response written
+func (this *ServerCodec) reject(filter *gonetio.IoFilter, status int, reason string) {
+	filter.Logger().Log(gonetio.LvlError, "WebSocket reject the upgrade request", "reason", reason)
+
+	this.closed = true
+	response := fmt.Sprintf("HTTP/1.1 %d %s\r\nConnection: close\r\nContent-Length: 0\r\n\r\n", status, http.StatusText(status))
+	filter.FireWrite(bytes.NewBufferString(response))
+	filter.GetCon().FlushAndClose()
+}
+
+// is the header contains the token, case insensitive
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Clone
+func (this *ServerCodec) Clone() gonetio.IoHandler {
+	handler := NewServerCodec(this.path)
+	handler.maxMessageSize = this.maxMessageSize
+	handler.messageType = this.messageType
+	return handler
+}
@@ -0,0 +1,75 @@
+// File ServerCodec test
+
+package websocket
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerUpgrade(t *testing.T) {
+	codec := NewServerCodec("/ws")
+	_, recorder, peer := startCodecCon(t, codec)
+
+	response := peer.upgrade(t, "/ws", "13")
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status %d", response.StatusCode)
+	}
+	// the accept of the key in rfc 6455
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept %q", accept)
+	}
+
+	select {
+	case <-recorder.opened:
+	case <-time.After(3 * time.Second):
+		t.Fatal("ConnOpened is not fired after the upgrade")
+	}
+	if !codec.IsUpgraded() || codec.Request() == nil || codec.Request().URL.Path != "/ws" {
+		t.Fatalf("upgraded %v, request %v", codec.IsUpgraded(), codec.Request())
+	}
+}
+
+func TestServerUpgradeReject(t *testing.T) {
+	header := "Host: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+	key := "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	version := "Sec-WebSocket-Version: 13\r\n"
+
+	tests := []struct {
+		name    string
+		request string
+		status  int
+	}{
+		{"path", "GET /other HTTP/1.1\r\n" + header + key + version + "\r\n", http.StatusNotFound},
+		{"method", "POST /ws HTTP/1.1\r\n" + header + key + version + "\r\n", http.StatusMethodNotAllowed},
+		{"not upgrade", "GET /ws HTTP/1.1\r\nHost: localhost\r\n" + key + version + "\r\n", http.StatusBadRequest},
+		{"version", "GET /ws HTTP/1.1\r\n" + header + key + "Sec-WebSocket-Version: 8\r\n\r\n", http.StatusUpgradeRequired},
+		{"no key", "GET /ws HTTP/1.1\r\n" + header + version + "\r\n", http.StatusBadRequest},
+		{"bad request", "NOT HTTP\r\n\r\n", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		codec := NewServerCodec("/ws")
+		_, recorder, peer := startCodecCon(t, codec)
+
+		response := peer.sendRequest(t, test.request)
+		if response.StatusCode != test.status {
+			t.Fatalf("%s: status %d, expect %d", test.name, response.StatusCode, test.status)
+		}
+
+		// the connection is closed after the response written
+		if _, err := peer.reader.ReadByte(); err != io.EOF {
+			t.Fatalf("%s: read after the reject err %v, expect EOF", test.name, err)
+		}
+		select {
+		case <-recorder.opened:
+			t.Fatalf("%s: ConnOpened fired for the rejected request", test.name)
+		default:
+		}
+		if codec.IsUpgraded() {
+			t.Fatalf("%s: upgraded after the reject", test.name)
+		}
+	}
+}
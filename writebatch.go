@@ -0,0 +1,181 @@
+// File WriteBatch
+
+package gonetio
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	DefaultWriteBatchBytes = 64 * 1024 // default max bytes of the packets written in one batch
+	DefaultWriteBatchCount = 64        // default max count of the packets written in one batch
+)
+
+// the write coalescing config
+// the write loop takes all the packets queued, at most maxCount packets and
+// about maxBytes bytes, and writes them by one writev. it waits up to linger
+// for more packets when the batch is not full, no waiting when linger is 0
+type writeBatchConfig struct {
+	maxBytes int           // stop adding packets when the batch reaches the bytes, the last one may exceed it
+	maxCount int           // max packets in one batch, no coalescing when less than 2
+	linger   time.Duration // the max time waiting for more packets
+}
+
+// the default write batch config
+func defaultWriteBatchConfig() writeBatchConfig {
+	return writeBatchConfig{
+		maxBytes: DefaultWriteBatchBytes,
+		maxCount: DefaultWriteBatchCount,
+		linger:   0,
+	}
+}
+
+// set the write batch config
+// maxCount less than 2 writes the packets one by one, linger trades latency for throughput
+func (this *AcceptorConf) SetWriteBatch(maxBytes int, maxCount int, linger time.Duration) {
+	this.writeBatch = writeBatchConfig{maxBytes: maxBytes, maxCount: maxCount, linger: linger}
+}
+
+// set the write batch config of the connections connected after
+// maxCount less than 2 writes the packets one by one, linger trades latency for throughput
+func (this *TcpConnector) SetWriteBatch(maxBytes int, maxCount int, linger time.Duration) {
+	this.config.writeBatch = writeBatchConfig{maxBytes: maxBytes, maxCount: maxCount, linger: linger}
+}
+
+// set the write batch config, it must be called before Start
+// maxCount less than 2 writes the packets one by one, linger trades latency for throughput.
+// it takes no effect in the datagram mode, each packet is a datagram
+func (this *Tcpcon) SetWriteBatch(maxBytes int, maxCount int, linger time.Duration) {
+	this.writeBatch = writeBatchConfig{maxBytes: maxBytes, maxCount: maxCount, linger: linger}
+}
+
+// collect the packets queued after the first one into the batch
+func (this *Tcpcon) collectBatch(first sendPacket) []sendPacket {
+	batch := append(this.batch[:0], first)
+	if this.datagramMode || this.writeBatch.maxCount < 2 {
+		return batch
+	}
+
+	size := first.buffer.Len()
+	var lingerTimer *time.Timer = nil
+	defer func() {
+		if lingerTimer != nil {
+			lingerTimer.Stop()
+		}
+	}()
+
+	for len(batch) < this.writeBatch.maxCount && size < this.writeBatch.maxBytes {
+		var p sendPacket
+		select {
+		case p = <-this.packetSendChan:
+		default:
+			if this.writeBatch.linger <= 0 {
+				return batch
+			}
+
+			if lingerTimer == nil {
+				lingerTimer = time.NewTimer(this.writeBatch.linger)
+			}
+
+			select {
+			case p = <-this.packetSendChan:
+			case <-lingerTimer.C:
+				return batch
+			case <-this.closeChan:
+				return batch
+			case <-this.drainChan:
+				return batch
+			}
+		}
+
+		// the send queue closed
+		if p.buffer == nil {
+			return batch
+		}
+
+		batch = append(batch, p)
+		size += p.buffer.Len()
+	}
+
+	return batch
+}
+
+// write the first packet with the packets queued after it, return false if write failed
+func (this *Tcpcon) writeBatchFrom(first sendPacket) bool {
+	batch := this.collectBatch(first)
+	this.batch = batch[:0]
+
+	size := 0
+	for _, p := range batch {
+		size += p.size
+	}
+	defer this.addQueuedBytes(-size)
+
+	var err error = nil
+	if len(batch) == 1 {
+		err = this.writePacket(batch[0])
+	} else if supportWritev(this.rawConn) {
+		err = this.writev(batch)
+	} else {
+		err = this.writeMerged(batch)
+	}
+
+	for _, p := range batch {
+		if p.pooled {
+			PutBuffer(p.buffer)
+		}
+		if p.future != nil {
+			p.future.packetDone(err)
+		}
+	}
+
+	// drop the references, the buffers may be reused by the others
+	clear(batch)
+
+	return err == nil
+}
+
+// is the writev used by net.Buffers for the connection
+func supportWritev(conn net.Conn) bool {
+	switch conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		return true
+	}
+	return false
+}
+
+// write the batch by one writev
+func (this *Tcpcon) writev(batch []sendPacket) error {
+	buffers := this.batchBuffers[:0]
+	for _, p := range batch {
+		buffers = append(buffers, p.buffer.Bytes())
+	}
+	this.batchBuffers = buffers[:0]
+
+	// WriteTo consumes the buffers
+	n, err := buffers.WriteTo(this.rawConn)
+	this.metrics.addBytesWritten(int(n))
+
+	clear(this.batchBuffers[:len(batch)])
+	return err
+}
+
+// merge the batch into one buffer and write it, for the connections without writev
+// like tls, so the batch goes out as one record
+func (this *Tcpcon) writeMerged(batch []sendPacket) error {
+	size := 0
+	for _, p := range batch {
+		size += p.buffer.Len()
+	}
+
+	merged := GetBuffer(size)
+	defer PutBuffer(merged)
+	for _, p := range batch {
+		merged.Write(p.buffer.Bytes())
+	}
+
+	n, err := this.rawConn.Write(merged.Bytes())
+	this.metrics.addBytesWritten(n)
+	return err
+}
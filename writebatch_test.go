@@ -0,0 +1,203 @@
+// File WriteBatch test
+
+package gonetio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record the bytes of each write, the writes block until released,
+// close the release channel to release all, or send to it to release one
+type recordingConn struct {
+	net.Conn
+	entered chan struct{} // signaled when a write entered
+	release chan struct{} // release the writes
+	err     error         // the error the writes return
+	mtx     sync.Mutex
+	writes  []string
+}
+
+func newRecordingConn(conn net.Conn) *recordingConn {
+	return &recordingConn{
+		Conn:    conn,
+		entered: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (this *recordingConn) Write(b []byte) (int, error) {
+	select {
+	case this.entered <- struct{}{}:
+	default:
+	}
+	<-this.release
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	this.mtx.Lock()
+	this.writes = append(this.writes, string(b))
+	this.mtx.Unlock()
+	return len(b), nil
+}
+
+func (this *recordingConn) getWrites() []string {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return append([]string{}, this.writes...)
+}
+
+// start a connection over the recording conn with the handler, if not nil
+func startRecordingCon(t *testing.T, queueSize int, handler IoHandler, setup func(*Tcpcon)) (*Tcpcon, *recordingConn) {
+	local, remote := net.Pipe()
+	raw := newRecordingConn(local)
+	con := NewConnFull(raw, queueSize, &sync.WaitGroup{}, 0)
+	chain := NewIoFilterChain(con)
+	if handler != nil {
+		chain.AddLast("handler", handler)
+	}
+	con.SetIoFilterChain(chain)
+	setup(con)
+	con.Start()
+
+	t.Cleanup(func() {
+		con.Close()
+		remote.Close()
+	})
+	return con, raw
+}
+
+// wait for the futures, fail on the error
+func waitWrites(t *testing.T, futures []*WriteFuture) {
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+			if err := future.Err(); err != nil {
+				t.Fatalf("write failed, %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for the write")
+		}
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	tests := []struct {
+		maxBytes int
+		maxCount int
+		writes   []string
+	}{
+		{1024, 64, []string{"a", "bcdef"}},
+		{1024, 3, []string{"a", "bcd", "ef"}},
+		{2, 64, []string{"a", "bc", "de", "f"}},
+		{1024, 1, []string{"a", "b", "c", "d", "e", "f"}},
+	}
+
+	for _, test := range tests {
+		con, raw := startRecordingCon(t, 64, nil, func(con *Tcpcon) {
+			con.SetWriteBatch(test.maxBytes, test.maxCount, 0)
+		})
+
+		// hold the write loop in the first write, so the others are queued
+		futures := []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+		<-raw.entered
+		for _, s := range []string{"b", "c", "d", "e", "f"} {
+			futures = append(futures, con.SendAsync(bytes.NewBufferString(s)))
+		}
+		close(raw.release)
+		waitWrites(t, futures)
+
+		if writes := raw.getWrites(); !reflect.DeepEqual(writes, test.writes) {
+			t.Fatalf("max bytes %d, max count %d, writes %q, expect %q", test.maxBytes, test.maxCount, writes, test.writes)
+		}
+		if queued := con.SendQueueBytes(); queued != 0 {
+			t.Fatalf("%d bytes queued after all written", queued)
+		}
+	}
+}
+
+func TestWriteBatchLinger(t *testing.T) {
+	tests := []struct {
+		linger time.Duration
+		writes []string
+	}{
+		{0, []string{"a", "b"}},
+		{time.Minute, []string{"ab"}},
+	}
+
+	for _, test := range tests {
+		con, raw := startRecordingCon(t, 64, nil, func(con *Tcpcon) {
+			con.SetWriteBatch(1024, 2, test.linger)
+		})
+		close(raw.release)
+
+		first := con.SendAsync(bytes.NewBufferString("a"))
+		if test.linger == 0 {
+			waitWrites(t, []*WriteFuture{first})
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		// the lingering batch is written once it's full
+		second := con.SendAsync(bytes.NewBufferString("b"))
+		waitWrites(t, []*WriteFuture{first, second})
+
+		if writes := raw.getWrites(); !reflect.DeepEqual(writes, test.writes) {
+			t.Fatalf("linger %v, writes %q, expect %q", test.linger, writes, test.writes)
+		}
+	}
+}
+
+// the batches are written by writev over tcp, in order
+func TestWriteBatchWritev(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	peerChan := make(chan net.Conn, 1)
+	go func() {
+		peer, _ := listener.Accept()
+		peerChan <- peer
+	}()
+
+	local, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := <-peerChan
+	defer peer.Close()
+
+	con := NewConnFull(local, 1024, &sync.WaitGroup{}, 0)
+	con.SetIoFilterChain(NewIoFilterChain(con))
+	con.SetWriteBatch(256, 16, 0)
+	con.Start()
+	defer con.Close()
+
+	expect := &bytes.Buffer{}
+	futures := []*WriteFuture{}
+	for i := 0; i < 1000; i++ {
+		s := fmt.Sprintf("%d,", i)
+		expect.WriteString(s)
+		futures = append(futures, con.SendAsync(bytes.NewBufferString(s)))
+	}
+
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data := make([]byte, expect.Len())
+	if _, err := io.ReadFull(peer, data); err != nil {
+		t.Fatalf("read from the peer: %v", err)
+	}
+	if !bytes.Equal(data, expect.Bytes()) {
+		t.Fatal("the peer read the packets out of order")
+	}
+	waitWrites(t, futures)
+}
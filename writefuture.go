@@ -0,0 +1,146 @@
+// File WriteFuture
+
+package gonetio
+
+import (
+	"errors"
+	"sync"
+)
+
+// error type
+var (
+	ErrEncodeFailed   = errors.New("Message encode failed")
+	ErrWriteNotQueued = errors.New("Message was not queued by the filter chain")
+)
+
+// the result of a write
+// it completes when all the packets of the message are handed to the raw connection,
+// or fails with the first error, like the encode failure, the send queue overflow,
+// the connection closed before written, or the error of the raw connection write
+type WriteFuture struct {
+	mtx       sync.Mutex
+	pending   int           // the packets queued and not written, plus one while the chain firing
+	queued    bool          // any packet queued
+	completed bool          // the future completed
+	err       error         // the error failed with
+	done      chan struct{} // closed when completed
+	callbacks []func(error) // called when completed
+	filter    IoFilter      // the filter the handlers see in FireWrite, moved along the chain
+}
+
+// new a future for the write fired
+func newWriteFuture() *WriteFuture {
+	return &WriteFuture{
+		pending: 1,
+		done:    make(chan struct{}),
+	}
+}
+
+// new a future failed with the error
+func newFailedWriteFuture(err error) *WriteFuture {
+	future := newWriteFuture()
+	future.fail(err)
+	return future
+}
+
+// get the channel closed when completed
+func (this *WriteFuture) Done() <-chan struct{} {
+	return this.done
+}
+
+// get the error the future failed with, nil if succeeded or not completed
+func (this *WriteFuture) Err() error {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	return this.err
+}
+
+// wait for completed, return the error failed with
+func (this *WriteFuture) Wait() error {
+	<-this.done
+	return this.Err()
+}
+
+// add the callback called when completed, with nil if succeeded
+// it's called at once if completed, otherwise in the goroutine completing the future,
+// the write loop mostly, so don't block in it
+func (this *WriteFuture) OnComplete(callback func(error)) {
+	this.mtx.Lock()
+	if !this.completed {
+		this.callbacks = append(this.callbacks, callback)
+		this.mtx.Unlock()
+		return
+	}
+	err := this.err
+	this.mtx.Unlock()
+
+	callback(err)
+}
+
+// a packet of the message queued
+func (this *WriteFuture) addPacket() {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	this.pending++
+	this.queued = true
+}
+
+// a packet of the message written, or failed with the error
+func (this *WriteFuture) packetDone(err error) {
+	if err != nil {
+		this.fail(err)
+		return
+	}
+	this.release()
+}
+
+// the chain firing returned, fails if nothing queued
+func (this *WriteFuture) fired() {
+	this.mtx.Lock()
+	queued := this.queued
+	this.mtx.Unlock()
+
+	if !queued {
+		this.fail(ErrWriteNotQueued)
+		return
+	}
+	this.release()
+}
+
+// release one pending, complete when no pending
+func (this *WriteFuture) release() {
+	this.mtx.Lock()
+	this.pending--
+	if this.pending > 0 || this.completed {
+		this.mtx.Unlock()
+		return
+	}
+	this.complete()
+}
+
+// fail with the error, the first error is kept
+func (this *WriteFuture) fail(err error) {
+	this.mtx.Lock()
+	if this.completed {
+		this.mtx.Unlock()
+		return
+	}
+	this.err = err
+	this.complete()
+}
+
+// complete the future, it must be called with the mutex locked, and it unlocks
+func (this *WriteFuture) complete() {
+	this.completed = true
+	close(this.done)
+	callbacks := this.callbacks
+	this.callbacks = nil
+	err := this.err
+	this.mtx.Unlock()
+
+	for _, callback := range callbacks {
+		callback(err)
+	}
+}
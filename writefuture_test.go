@@ -0,0 +1,209 @@
+// File WriteFuture test
+
+package gonetio
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteFuture(t *testing.T) {
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+
+	tests := []struct {
+		name  string
+		steps func(future *WriteFuture)
+		err   error
+	}{
+		{"all written", func(future *WriteFuture) {
+			future.addPacket()
+			future.addPacket()
+			future.fired()
+			future.packetDone(nil)
+			future.packetDone(nil)
+		}, nil},
+		{"written before fired", func(future *WriteFuture) {
+			future.addPacket()
+			future.packetDone(nil)
+			future.fired()
+		}, nil},
+		{"nothing queued", func(future *WriteFuture) {
+			future.fired()
+		}, ErrWriteNotQueued},
+		{"failed before fired", func(future *WriteFuture) {
+			future.fail(errFirst)
+			future.fired()
+		}, errFirst},
+		{"first error kept", func(future *WriteFuture) {
+			future.addPacket()
+			future.addPacket()
+			future.fired()
+			future.packetDone(errFirst)
+			future.packetDone(errSecond)
+		}, errFirst},
+		{"error after written", func(future *WriteFuture) {
+			future.addPacket()
+			future.fired()
+			future.packetDone(nil)
+			future.fail(errSecond)
+		}, nil},
+	}
+
+	for _, test := range tests {
+		future := newWriteFuture()
+		calls := int32(0)
+		future.OnComplete(func(err error) {
+			atomic.AddInt32(&calls, 1)
+			if err != test.err {
+				t.Errorf("%s: callback err %v, expect %v", test.name, err, test.err)
+			}
+		})
+
+		test.steps(future)
+
+		select {
+		case <-future.Done():
+		default:
+			t.Fatalf("%s: not completed", test.name)
+		}
+		if err := future.Wait(); err != test.err {
+			t.Fatalf("%s: err %v, expect %v", test.name, err, test.err)
+		}
+		if calls != 1 {
+			t.Fatalf("%s: callback called %d times", test.name, calls)
+		}
+
+		// called at once after completed
+		called := false
+		future.OnComplete(func(error) { called = true })
+		if !called {
+			t.Fatalf("%s: callback not called after completed", test.name)
+		}
+	}
+}
+
+func TestWriteFutureNotCompleted(t *testing.T) {
+	future := newWriteFuture()
+	future.addPacket()
+	future.fired()
+
+	select {
+	case <-future.Done():
+		t.Fatal("completed with a packet not written")
+	default:
+	}
+}
+
+// swallow the writes, queue nothing
+type swallowHandler struct {
+	IoHandlerImp
+}
+
+func newSwallowHandler() *swallowHandler {
+	handler := &swallowHandler{}
+	handler.SetBoundType(OutBound)
+	return handler
+}
+
+func (this *swallowHandler) Clone() IoHandler {
+	return newSwallowHandler()
+}
+
+func TestSendAsync(t *testing.T) {
+	errBroken := errors.New("broken")
+
+	tests := []struct {
+		name    string
+		handler IoHandler
+		setup   func(con *Tcpcon)
+		rawErr  error
+		prepare func(con *Tcpcon, raw *recordingConn) []*WriteFuture
+		errs    []error
+	}{
+		{"written", nil, nil, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			close(raw.release)
+			return []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+		}, []error{nil}},
+		{"not queued", newSwallowHandler(), nil, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			close(raw.release)
+			return []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+		}, []error{ErrWriteNotQueued}},
+		{"closed", nil, nil, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			close(raw.release)
+			con.Close()
+			return []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+		}, []error{ErrConnClosed}},
+		{"drop newest", nil, nil, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			futures := []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+			<-raw.entered
+			futures = append(futures, con.SendAsync(bytes.NewBufferString("b")), con.SendAsync(bytes.NewBufferString("c")))
+			close(raw.release)
+			return futures
+		}, []error{nil, nil, ErrWriteBlocking}},
+		{"drop oldest", nil, func(con *Tcpcon) { con.SetOverflowPolicy(OverflowDropOldest, 0) }, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			futures := []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+			<-raw.entered
+			futures = append(futures, con.SendAsync(bytes.NewBufferString("b")), con.SendAsync(bytes.NewBufferString("c")))
+			close(raw.release)
+			return futures
+		}, []error{nil, ErrWriteBlocking, nil}},
+		{"block timeout", nil, func(con *Tcpcon) { con.SetOverflowPolicy(OverflowBlock, 10*time.Millisecond) }, nil, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			futures := []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+			<-raw.entered
+			futures = append(futures, con.SendAsync(bytes.NewBufferString("b")), con.SendAsync(bytes.NewBufferString("c")))
+			close(raw.release)
+			return futures
+		}, []error{nil, nil, ErrWriteBlocking}},
+		{"write error", nil, nil, errBroken, func(con *Tcpcon, raw *recordingConn) []*WriteFuture {
+			futures := []*WriteFuture{con.SendAsync(bytes.NewBufferString("a"))}
+			<-raw.entered
+			futures = append(futures, con.SendAsync(bytes.NewBufferString("b")))
+			close(raw.release)
+			return futures
+		}, []error{errBroken, ErrConnClosed}},
+	}
+
+	for _, test := range tests {
+		con, raw := startRecordingCon(t, 1, test.handler, func(con *Tcpcon) {
+			con.SetWriteBatch(0, 1, 0)
+			if test.setup != nil {
+				test.setup(con)
+			}
+		})
+		raw.err = test.rawErr
+
+		futures := test.prepare(con, raw)
+		for i, future := range futures {
+			select {
+			case <-future.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%s: write %d not completed", test.name, i)
+			}
+			if err := future.Err(); !errors.Is(err, test.errs[i]) {
+				t.Fatalf("%s: write %d err %v, expect %v", test.name, i, err, test.errs[i])
+			}
+		}
+	}
+}
+
+func TestSendNotConnected(t *testing.T) {
+	pool := NewTcpconnectionPool()
+	if err := pool.Send(1, bytes.NewBufferString("a")); err != ErrConnNotFound {
+		t.Fatalf("pool send err %v, expect ErrConnNotFound", err)
+	}
+	if err := pool.SendAsync(1, bytes.NewBufferString("a")).Wait(); err != ErrConnNotFound {
+		t.Fatalf("pool send async err %v, expect ErrConnNotFound", err)
+	}
+
+	connector := NewConnector("future", 16, 0)
+	if err := connector.Send(bytes.NewBufferString("a")); err != ErrNotConnected {
+		t.Fatalf("connector send err %v, expect ErrNotConnected", err)
+	}
+	if err := connector.SendAsync(bytes.NewBufferString("a")).Wait(); err != ErrNotConnected {
+		t.Fatalf("connector send async err %v, expect ErrNotConnected", err)
+	}
+}